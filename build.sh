@@ -12,7 +12,7 @@ EXECUTABLE_NAME="bootstrap"
 mkdir -p "$BUILD_DIR"
 echo "Building..."
 cd src
-go build -o "../$BUILD_DIR/$EXECUTABLE_NAME" -ldflags="-s -w" .
+go build -o "../$BUILD_DIR/$EXECUTABLE_NAME" -ldflags="-s -w" ./cmd/bootstrap
 cd ..
 echo "DONE! '$EXECUTABLE_NAME' zai '$BUILD_DIR/'."
 cd "$BUILD_DIR"
@@ -0,0 +1,80 @@
+package inbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is a non-success response from the OpenAI API. Every Assistant method returns one
+// (wrapped; use errors.As) when OpenAI rejects a request.
+type APIError struct {
+	StatusCode int
+	Type       string // e.g. "invalid_request_error"
+	Code       string // e.g. "rate_limit_exceeded", may be empty
+	Param      string
+	Message    string
+	RequestID  string // x-request-id, for OpenAI support
+	Retryable  bool   // Whether the same request could succeed later
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "OpenAI API error (status %d", e.StatusCode)
+	if e.Type != "" {
+		fmt.Fprintf(&b, ", type %s", e.Type)
+	}
+	if e.Code != "" {
+		fmt.Fprintf(&b, ", code %s", e.Code)
+	}
+	if e.Param != "" {
+		fmt.Fprintf(&b, ", param %s", e.Param)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, ", request %s", e.RequestID)
+	}
+	fmt.Fprintf(&b, "): %s", e.Message)
+	return b.String()
+}
+
+// IsAuth reports a missing, invalid or unauthorised API key.
+func (e *APIError) IsAuth() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+func (e *APIError) IsRateLimit() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsNotFound reports an unknown thread, run, message or assistant ID.
+func (e *APIError) IsNotFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+func (e *APIError) IsServerError() bool {
+	return e.StatusCode >= 500
+}
+
+// newAPIError builds an APIError from a non-success response, keeping the raw body as the
+// message when it isn't OpenAI's usual error JSON.
+func newAPIError(resp *apiResponse) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("x-request-id"),
+		Retryable:  retryableStatus(resp.StatusCode, true),
+		Message:    strings.TrimSpace(string(resp.Body)),
+	}
+
+	var body OpenAIErrorResponse
+	if err := json.Unmarshal(resp.Body, &body); err == nil && body.Error.Message != "" {
+		apiErr.Type = body.Error.Type
+		apiErr.Code = body.Error.Code
+		apiErr.Param = body.Error.Param
+		apiErr.Message = body.Error.Message
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
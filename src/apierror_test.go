@@ -0,0 +1,94 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   APIError
+		text   string
+	}{
+		{
+			name:   "OpenAI error JSON",
+			status: http.StatusBadRequest,
+			body:   `{"error": {"message": "Invalid value", "type": "invalid_request_error", "code": "invalid_value", "param": "model"}}`,
+			want:   APIError{StatusCode: 400, Type: "invalid_request_error", Code: "invalid_value", Param: "model", Message: "Invalid value", RequestID: "req_1"},
+			text:   "OpenAI API error (status 400, type invalid_request_error, code invalid_value, param model, request req_1): Invalid value",
+		},
+		{
+			name:   "rate limited",
+			status: http.StatusTooManyRequests,
+			body:   `{"error": {"message": "Slow down", "type": "requests", "code": "rate_limit_exceeded"}}`,
+			want:   APIError{StatusCode: 429, Type: "requests", Code: "rate_limit_exceeded", Message: "Slow down", RequestID: "req_1", Retryable: true},
+			text:   "OpenAI API error (status 429, type requests, code rate_limit_exceeded, request req_1): Slow down",
+		},
+		{
+			name:   "a proxy's plain text",
+			status: http.StatusBadGateway,
+			body:   "  Bad gateway from upstream\n",
+			want:   APIError{StatusCode: 502, Message: "Bad gateway from upstream", RequestID: "req_1", Retryable: true},
+			text:   "OpenAI API error (status 502, request req_1): Bad gateway from upstream",
+		},
+		{
+			name:   "no body",
+			status: http.StatusUnauthorized,
+			want:   APIError{StatusCode: 401, Message: "Unauthorized", RequestID: "req_1"},
+			text:   "OpenAI API error (status 401, request req_1): Unauthorized",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("x-request-id", "req_1")
+			got := newAPIError(&apiResponse{StatusCode: tt.status, Header: header, Body: []byte(tt.body)})
+			if *got != tt.want {
+				t.Errorf("newAPIError() = %+v, want %+v", *got, tt.want)
+			}
+			if got.Error() != tt.text {
+				t.Errorf("Error() = %q, want %q", got.Error(), tt.text)
+			}
+		})
+	}
+}
+
+func TestAPIErrorKinds(t *testing.T) {
+	tests := []struct {
+		status                               int
+		auth, rateLimit, notFound, serverErr bool
+	}{
+		{status: 400},
+		{status: 401, auth: true},
+		{status: 403, auth: true},
+		{status: 404, notFound: true},
+		{status: 429, rateLimit: true},
+		{status: 500, serverErr: true},
+		{status: 503, serverErr: true},
+	}
+	for _, tt := range tests {
+		e := &APIError{StatusCode: tt.status}
+		if e.IsAuth() != tt.auth || e.IsRateLimit() != tt.rateLimit || e.IsNotFound() != tt.notFound || e.IsServerError() != tt.serverErr {
+			t.Errorf("status %d: IsAuth %v, IsRateLimit %v, IsNotFound %v, IsServerError %v", tt.status, e.IsAuth(), e.IsRateLimit(), e.IsNotFound(), e.IsServerError())
+		}
+	}
+}
+
+func TestAssistantReturnsAPIErrors(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.reply("POST /v1/threads/thread_1/messages", http.StatusUnauthorized, `{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error", "code": "invalid_api_key"}}`)
+
+	_, err := f.assistant(PollRuns).AddMessageToThreadContext(context.Background(), "hello")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.IsAuth() || apiErr.Code != "invalid_api_key" {
+		t.Fatalf("AddMessageToThreadContext() error = %v, want the wrapped 401", err)
+	}
+	if n := len(f.received("POST /v1/threads/thread_1/messages")); n != 1 {
+		t.Errorf("sent the message %d times, want once", n)
+	}
+}
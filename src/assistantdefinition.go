@@ -0,0 +1,389 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// AssistantDefinition is the reviewed, version-controlled description of a remote assistant.
+// SyncAssistant makes the assistant match it.
+type AssistantDefinition struct {
+	Name             string            `json:"name"`
+	Description      string            `json:"description,omitempty"`
+	Model            string            `json:"model"`
+	Instructions     string            `json:"instructions,omitempty"`
+	InstructionsFile string            `json:"instructions_file,omitempty"` // Relative to the definition file
+	Tools            []Tool            `json:"tools,omitempty"`
+	ResponseFormat   *ResponseFormat   `json:"response_format,omitempty"`  // Unset means "auto"
+	VectorStoreIDs   []string          `json:"vector_store_ids,omitempty"` // Environment variables like ${VECTOR_STORE_ID} are expanded
+	Temperature      *float64          `json:"temperature,omitempty"`
+	TopP             *float64          `json:"top_p,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// LoadAssistantDefinition reads a definition from a JSON file, inlining its instructions file.
+func LoadAssistantDefinition(path string) (*AssistantDefinition, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read assistant definition %s: %w", path, err)
+	}
+
+	definition := &AssistantDefinition{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(definition); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal assistant definition %s: %w", path, err)
+	}
+
+	if definition.InstructionsFile != "" {
+		if definition.Instructions != "" {
+			return nil, fmt.Errorf("assistant definition %s sets both instructions and instructions_file", path)
+		}
+		instructionsPath := definition.InstructionsFile
+		if !filepath.IsAbs(instructionsPath) {
+			instructionsPath = filepath.Join(filepath.Dir(path), instructionsPath)
+		}
+		instructions, err := os.ReadFile(instructionsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read instructions file %s: %w", instructionsPath, err)
+		}
+		definition.Instructions = strings.TrimSpace(string(instructions))
+	}
+	for i, id := range definition.VectorStoreIDs {
+		definition.VectorStoreIDs[i] = os.ExpandEnv(id)
+		if definition.VectorStoreIDs[i] == "" {
+			return nil, fmt.Errorf("assistant definition %s has vector store %q, which is empty; set the variables it names", path, id)
+		}
+	}
+
+	if err := definition.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid assistant definition %s: %w", path, err)
+	}
+	return definition, nil
+}
+
+// Validate checks the definition has what the API requires.
+func (d *AssistantDefinition) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if d.Model == "" {
+		return fmt.Errorf("model is required")
+	}
+	fileSearch := false
+	for i, tool := range d.Tools {
+		switch tool.Type {
+		case "function":
+			if tool.Function == nil || tool.Function.Name == "" {
+				return fmt.Errorf("function tool %d needs a function name", i)
+			}
+		case "file_search":
+			fileSearch = true
+		case "code_interpreter":
+		default:
+			return fmt.Errorf("tool %d has unknown type %q", i, tool.Type)
+		}
+	}
+	if len(d.VectorStoreIDs) > 0 && !fileSearch {
+		return fmt.Errorf("vector_store_ids need a file_search tool to be searched")
+	}
+	if len(d.VectorStoreIDs) > 1 {
+		return fmt.Errorf("vector_store_ids has %d stores, an assistant searches at most 1", len(d.VectorStoreIDs))
+	}
+	if len(d.Metadata) > 16 {
+		return fmt.Errorf("metadata has %d keys, at most 16 are allowed", len(d.Metadata))
+	}
+	return nil
+}
+
+// AssistantObject is an assistant as the API stores it.
+type AssistantObject struct {
+	ID             string            `json:"id"`
+	Object         string            `json:"object"`
+	CreatedAt      int64             `json:"created_at"`
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	Model          string            `json:"model"`
+	Instructions   string            `json:"instructions"`
+	Tools          []Tool            `json:"tools"`
+	ToolResources  *ToolResources    `json:"tool_resources"`
+	ResponseFormat json.RawMessage   `json:"response_format"` // "auto" or a ResponseFormat
+	Temperature    *float64          `json:"temperature"`
+	TopP           *float64          `json:"top_p"`
+	Metadata       map[string]string `json:"metadata"`
+}
+
+type ToolResources struct {
+	FileSearch *FileSearchResources `json:"file_search,omitempty"`
+}
+
+type FileSearchResources struct {
+	VectorStoreIDs []string `json:"vector_store_ids"`
+}
+
+type ListAssistantsResponse struct {
+	Object  string            `json:"object"`
+	Data    []AssistantObject `json:"data"`
+	FirstID string            `json:"first_id"`
+	LastID  string            `json:"last_id"`
+	HasMore bool              `json:"has_more"`
+}
+
+// assistantPayload creates or replaces an assistant. Tools and vector stores are always sent so
+// that removing them from the definition removes them from the assistant.
+type assistantPayload struct {
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	Model          string            `json:"model"`
+	Instructions   string            `json:"instructions"`
+	Tools          []Tool            `json:"tools"`
+	ToolResources  ToolResources     `json:"tool_resources"`
+	ResponseFormat interface{}       `json:"response_format"`
+	Temperature    *float64          `json:"temperature,omitempty"`
+	TopP           *float64          `json:"top_p,omitempty"`
+	Metadata       map[string]string `json:"metadata"`
+}
+
+func (d *AssistantDefinition) payload() assistantPayload {
+	payload := assistantPayload{
+		Name:           d.Name,
+		Description:    d.Description,
+		Model:          d.Model,
+		Instructions:   d.Instructions,
+		Tools:          append([]Tool{}, d.Tools...),
+		ToolResources:  ToolResources{FileSearch: &FileSearchResources{VectorStoreIDs: append([]string{}, d.VectorStoreIDs...)}},
+		ResponseFormat: "auto",
+		Temperature:    d.Temperature,
+		TopP:           d.TopP,
+		Metadata:       d.Metadata,
+	}
+	if d.ResponseFormat != nil {
+		payload.ResponseFormat = d.ResponseFormat
+	}
+	if payload.Metadata == nil {
+		payload.Metadata = map[string]string{}
+	}
+	return payload
+}
+
+// Drift lists how remote differs from the definition, one line per field, or nothing if it
+// matches. Temperature and top_p are only compared when the definition sets them.
+func (d *AssistantDefinition) Drift(remote *AssistantObject) []string {
+	var drift []string
+	differs := func(field string, want, got interface{}) {
+		drift = append(drift, fmt.Sprintf("%s: remote has %v, definition has %v", field, got, want))
+	}
+
+	if remote.Name != d.Name {
+		differs("name", fmt.Sprintf("%q", d.Name), fmt.Sprintf("%q", remote.Name))
+	}
+	if remote.Description != d.Description {
+		differs("description", fmt.Sprintf("%q", d.Description), fmt.Sprintf("%q", remote.Description))
+	}
+	if remote.Model != d.Model {
+		differs("model", d.Model, remote.Model)
+	}
+	if strings.TrimSpace(remote.Instructions) != strings.TrimSpace(d.Instructions) {
+		drift = append(drift, "instructions: remote text differs from the definition")
+	}
+	if !sameJSON(remote.Tools, d.Tools) {
+		differs("tools", toolNames(d.Tools), toolNames(remote.Tools))
+	}
+
+	var vectorStores []string
+	if remote.ToolResources != nil && remote.ToolResources.FileSearch != nil {
+		vectorStores = remote.ToolResources.FileSearch.VectorStoreIDs
+	}
+	if !sameJSON(vectorStores, d.VectorStoreIDs) {
+		differs("vector_store_ids", d.VectorStoreIDs, vectorStores)
+	}
+
+	var want interface{} = "auto"
+	if d.ResponseFormat != nil {
+		want = d.ResponseFormat
+	}
+	remoteFormat := remote.ResponseFormat
+	if len(remoteFormat) == 0 || string(remoteFormat) == "null" {
+		remoteFormat = json.RawMessage(`"auto"`)
+	}
+	if !sameJSON(remoteFormat, want) {
+		drift = append(drift, "response_format: remote differs from the definition")
+	}
+
+	if d.Temperature != nil && (remote.Temperature == nil || *remote.Temperature != *d.Temperature) {
+		differs("temperature", *d.Temperature, floatOrUnset(remote.Temperature))
+	}
+	if d.TopP != nil && (remote.TopP == nil || *remote.TopP != *d.TopP) {
+		differs("top_p", *d.TopP, floatOrUnset(remote.TopP))
+	}
+	if !sameJSON(remote.Metadata, d.Metadata) {
+		differs("metadata", d.Metadata, remote.Metadata)
+	}
+	return drift
+}
+
+// sameJSON reports whether a and b marshal to the same JSON, ignoring key order and formatting.
+// Empty lists and maps count as the same as none.
+func sameJSON(a, b interface{}) bool {
+	normalise := func(v interface{}) interface{} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err.Error()
+		}
+		var out interface{}
+		json.Unmarshal(b, &out)
+		switch value := out.(type) {
+		case []interface{}:
+			if len(value) == 0 {
+				return nil
+			}
+		case map[string]interface{}:
+			if len(value) == 0 {
+				return nil
+			}
+		}
+		return out
+	}
+	return reflect.DeepEqual(normalise(a), normalise(b))
+}
+
+func toolNames(tools []Tool) []string {
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function != nil {
+			names = append(names, tool.Type+":"+tool.Function.Name)
+		} else {
+			names = append(names, tool.Type)
+		}
+	}
+	return names
+}
+
+func floatOrUnset(v *float64) interface{} {
+	if v == nil {
+		return "unset"
+	}
+	return *v
+}
+
+// AssistantsClient manages assistants themselves, as opposed to Assistant, which runs one.
+type AssistantsClient struct {
+	openAIClient
+}
+
+func NewAssistantsClient(openAIKey string, options ...AssistantOption) *AssistantsClient {
+	c := &AssistantsClient{openAIClient: newOpenAIClient("Assistants", openAIKey, options)}
+	c.beta = OpenAIBetaHeader
+	return c
+}
+
+func (c *AssistantsClient) GetAssistant(ctx context.Context, assistantID string) (*AssistantObject, error) {
+	var assistant AssistantObject
+	if err := c.callJSON(ctx, "GET", c.endpoint("/assistants/%s", assistantID), nil, &assistant, true, "get assistant"); err != nil {
+		return nil, err
+	}
+	return &assistant, nil
+}
+
+func (c *AssistantsClient) CreateAssistant(ctx context.Context, definition *AssistantDefinition) (*AssistantObject, error) {
+	var assistant AssistantObject
+	if err := c.callJSON(ctx, "POST", c.endpoint("/assistants"), definition.payload(), &assistant, false, "create assistant"); err != nil {
+		return nil, err
+	}
+	return &assistant, nil
+}
+
+// UpdateAssistant replaces the assistant's settings with the definition's.
+func (c *AssistantsClient) UpdateAssistant(ctx context.Context, assistantID string, definition *AssistantDefinition) (*AssistantObject, error) {
+	var assistant AssistantObject
+	if err := c.callJSON(ctx, "POST", c.endpoint("/assistants/%s", assistantID), definition.payload(), &assistant, true, "update assistant"); err != nil {
+		return nil, err
+	}
+	return &assistant, nil
+}
+
+// FindAssistant looks through every assistant for one called name. It returns nil if there is
+// none and an error if the name is ambiguous.
+func (c *AssistantsClient) FindAssistant(ctx context.Context, name string) (*AssistantObject, error) {
+	var found *AssistantObject
+	after := ""
+	for {
+		query := url.Values{"limit": {"100"}}
+		if after != "" {
+			query.Set("after", after)
+		}
+		var page ListAssistantsResponse
+		if err := c.callJSON(ctx, "GET", withQuery(c.endpoint("/assistants"), query), nil, &page, true, "list assistants"); err != nil {
+			return nil, err
+		}
+		for i := range page.Data {
+			if page.Data[i].Name != name {
+				continue
+			}
+			if found != nil {
+				return nil, fmt.Errorf("assistants %s and %s are both called %q; pass the ID to use", found.ID, page.Data[i].ID, name)
+			}
+			found = &page.Data[i]
+		}
+		if !page.HasMore || page.LastID == "" {
+			return found, nil
+		}
+		after = page.LastID
+	}
+}
+
+// AssistantSyncResult is what SyncAssistant found and did.
+type AssistantSyncResult struct {
+	ID      string   // Empty if the assistant doesn't exist and apply was false
+	Drift   []string // How the remote assistant differed before any update
+	Created bool
+	Updated bool
+}
+
+// SyncAssistant compares the assistant with assistantID, or if that is empty the one with the
+// definition's name, against the definition. With apply set it creates or updates the assistant
+// to match; otherwise it only reports the drift.
+func (c *AssistantsClient) SyncAssistant(ctx context.Context, definition *AssistantDefinition, assistantID string, apply bool) (*AssistantSyncResult, error) {
+	var remote *AssistantObject
+	var err error
+	if assistantID != "" {
+		remote, err = c.GetAssistant(ctx, assistantID)
+	} else {
+		remote, err = c.FindAssistant(ctx, definition.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AssistantSyncResult{}
+	if remote == nil {
+		result.Drift = []string{fmt.Sprintf("assistant %q does not exist", definition.Name)}
+		if !apply {
+			return result, nil
+		}
+		created, err := c.CreateAssistant(ctx, definition)
+		if err != nil {
+			return nil, err
+		}
+		result.ID, result.Created = created.ID, true
+		return result, nil
+	}
+
+	result.ID = remote.ID
+	result.Drift = definition.Drift(remote)
+	if len(result.Drift) == 0 || !apply {
+		return result, nil
+	}
+	if _, err := c.UpdateAssistant(ctx, remote.ID, definition); err != nil {
+		return nil, err
+	}
+	result.Updated = true
+	return result, nil
+}
@@ -0,0 +1,274 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadAssistantDefinition(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("instructions.md", "\n  Pick widgets.\n\n")
+	t.Setenv("TEST_VECTOR_STORE", "vs_env")
+
+	tests := []struct {
+		name    string
+		json    string
+		want    string // Instructions
+		stores  string // Vector store IDs, comma separated
+		wantErr string
+	}{
+		{name: "inline instructions", json: `{"name": "Picker", "model": "gpt-4o", "instructions": "Pick spades."}`, want: "Pick spades."},
+		{name: "instructions file", json: `{"name": "Picker", "model": "gpt-4o", "instructions_file": "instructions.md"}`, want: "Pick widgets."},
+		{name: "both", json: `{"name": "Picker", "model": "gpt-4o", "instructions": "x", "instructions_file": "instructions.md"}`, wantErr: "both instructions and instructions_file"},
+		{name: "missing instructions file", json: `{"name": "Picker", "model": "gpt-4o", "instructions_file": "missing.md"}`, wantErr: "failed to read instructions file"},
+		{name: "unknown field", json: `{"name": "Picker", "model": "gpt-4o", "temprature": 0.2}`, wantErr: "unknown field"},
+		{name: "invalid", json: `{"name": "Picker"}`, wantErr: "model is required"},
+		{name: "vector store from the environment", json: `{"name": "Picker", "model": "gpt-4o", "instructions": "x", "tools": [{"type": "file_search"}], "vector_store_ids": ["${TEST_VECTOR_STORE}"]}`, want: "x", stores: "vs_env"},
+		{name: "vector store unset", json: `{"name": "Picker", "model": "gpt-4o", "tools": [{"type": "file_search"}], "vector_store_ids": ["${TEST_UNSET_VECTOR_STORE}"]}`, wantErr: "which is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			definition, err := LoadAssistantDefinition(write("assistant.json", tt.json))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadAssistantDefinition() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || definition.Instructions != tt.want || strings.Join(definition.VectorStoreIDs, ",") != tt.stores {
+				t.Fatalf("LoadAssistantDefinition() = %+v, %v; want instructions %q, vector stores %q", definition, err, tt.want, tt.stores)
+			}
+		})
+	}
+}
+
+// The repository's own definition must load, search the catalogue vector store and declare the
+// lookup tool the picker answers.
+func TestRepositoryAssistantDefinition(t *testing.T) {
+	t.Setenv("VECTOR_STORE_ID", "vs_catalogue")
+	definition, err := LoadAssistantDefinition("../assistant.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(definition.VectorStoreIDs, []string{"vs_catalogue"}) {
+		t.Errorf("vector_store_ids = %q, want VECTOR_STORE_ID", definition.VectorStoreIDs)
+	}
+	for _, tool := range definition.Tools {
+		if tool.Function == nil || tool.Function.Name != catalogueToolName {
+			continue
+		}
+		if tool.Function.Description != catalogueToolDescription || !sameJSON(tool.Function.Parameters, catalogueToolParameters) {
+			t.Errorf("%s in assistant.json is out of step with cataloguetool.go", catalogueToolName)
+		}
+		return
+	}
+	t.Errorf("assistant.json doesn't declare %s", catalogueToolName)
+}
+
+func TestAssistantDefinitionValidate(t *testing.T) {
+	metadata := map[string]string{}
+	for i := 0; i < 17; i++ {
+		metadata[string(rune('a'+i))] = "x"
+	}
+	tests := []struct {
+		name       string
+		definition AssistantDefinition
+		wantErr    string
+	}{
+		{name: "valid", definition: AssistantDefinition{Name: "Picker", Model: "gpt-4o", Tools: []Tool{{Type: "code_interpreter"}}}},
+		{name: "no name", definition: AssistantDefinition{Model: "gpt-4o"}, wantErr: "name is required"},
+		{name: "function without a name", definition: AssistantDefinition{Name: "Picker", Model: "gpt-4o", Tools: []Tool{{Type: "function"}}}, wantErr: "needs a function name"},
+		{name: "unknown tool", definition: AssistantDefinition{Name: "Picker", Model: "gpt-4o", Tools: []Tool{{Type: "web_search"}}}, wantErr: `unknown type "web_search"`},
+		{name: "vector store with file_search", definition: AssistantDefinition{Name: "Picker", Model: "gpt-4o", Tools: []Tool{{Type: "file_search"}}, VectorStoreIDs: []string{"vs_1"}}},
+		{name: "vector store without file_search", definition: AssistantDefinition{Name: "Picker", Model: "gpt-4o", VectorStoreIDs: []string{"vs_1"}}, wantErr: "need a file_search tool"},
+		{name: "two vector stores", definition: AssistantDefinition{Name: "Picker", Model: "gpt-4o", Tools: []Tool{{Type: "file_search"}}, VectorStoreIDs: []string{"vs_1", "vs_2"}}, wantErr: "at most 1"},
+		{name: "too much metadata", definition: AssistantDefinition{Name: "Picker", Model: "gpt-4o", Metadata: metadata}, wantErr: "at most 16"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.definition.Validate()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAssistantDefinitionDrift(t *testing.T) {
+	temperature := 0.2
+	definition := &AssistantDefinition{
+		Name:         "Picker",
+		Model:        "gpt-4o-mini",
+		Instructions: "Pick widgets.",
+		Tools:        []Tool{{Type: "function", Function: &FunctionDefinition{Name: "lookup_product", Parameters: json.RawMessage(`{"type": "object"}`)}}},
+		Temperature:  &temperature,
+		Metadata:     map[string]string{"managed_by": "process-inbound-email"},
+	}
+	matching := `{"id": "asst_1", "name": "Picker", "description": "", "model": "gpt-4o-mini", "instructions": "Pick widgets.\n",
+		"tools": [{"type": "function", "function": {"name": "lookup_product", "parameters": {"type":"object"}}}],
+		"tool_resources": {"file_search": {"vector_store_ids": []}}, "response_format": "auto", "temperature": 0.2, "top_p": 1,
+		"metadata": {"managed_by": "process-inbound-email"}}`
+
+	tests := []struct {
+		name   string
+		change func(remote *AssistantObject)
+		want   []string
+	}{
+		{name: "matching", change: func(*AssistantObject) {}},
+		{
+			name:   "model and instructions",
+			change: func(r *AssistantObject) { r.Model, r.Instructions = "gpt-4o", "Pick spades." },
+			want:   []string{"model: remote has gpt-4o, definition has gpt-4o-mini", "instructions: remote text differs from the definition"},
+		},
+		{
+			name:   "tools",
+			change: func(r *AssistantObject) { r.Tools = append(r.Tools, Tool{Type: "file_search"}) },
+			want:   []string{"tools: remote has [function:lookup_product file_search], definition has [function:lookup_product]"},
+		},
+		{
+			name:   "vector stores",
+			change: func(r *AssistantObject) { r.ToolResources.FileSearch.VectorStoreIDs = []string{"vs_1"} },
+			want:   []string{"vector_store_ids: remote has [vs_1], definition has []"},
+		},
+		{
+			name:   "response format",
+			change: func(r *AssistantObject) { r.ResponseFormat = json.RawMessage(`{"type": "json_object"}`) },
+			want:   []string{"response_format: remote differs from the definition"},
+		},
+		{
+			name:   "temperature unset",
+			change: func(r *AssistantObject) { r.Temperature = nil },
+			want:   []string{"temperature: remote has unset, definition has 0.2"},
+		},
+		{
+			name:   "metadata",
+			change: func(r *AssistantObject) { r.Metadata = nil },
+			want:   []string{"metadata: remote has map[], definition has map[managed_by:process-inbound-email]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var remote AssistantObject
+			if err := json.Unmarshal([]byte(matching), &remote); err != nil {
+				t.Fatal(err)
+			}
+			tt.change(&remote)
+			if got := definition.Drift(&remote); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Drift() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncAssistant(t *testing.T) {
+	definition := &AssistantDefinition{Name: "Picker", Model: "gpt-4o-mini", Instructions: "Pick widgets."}
+	current := `{"id": "asst_1", "name": "Picker", "model": "gpt-4o-mini", "instructions": "Pick widgets."}`
+	stale := `{"id": "asst_1", "name": "Picker", "model": "gpt-4o", "instructions": "Pick widgets."}`
+
+	tests := []struct {
+		name        string
+		assistantID string
+		apply       bool
+		pages       []string // Responses to listing assistants
+		remote      string   // Response to getting asst_1
+		want        AssistantSyncResult
+		wantErr     string
+		created     bool
+		updated     bool
+	}{
+		{
+			name:   "unchanged",
+			pages:  []string{`{"data": [` + current + `], "has_more": false}`},
+			apply:  true,
+			want:   AssistantSyncResult{ID: "asst_1"},
+			remote: current,
+		},
+		{
+			name:  "drift found by name across pages, not applied",
+			pages: []string{`{"data": [{"id": "asst_0", "name": "Other"}], "has_more": true, "last_id": "asst_0"}`, `{"data": [` + stale + `], "has_more": false}`},
+			want:  AssistantSyncResult{ID: "asst_1", Drift: []string{"model: remote has gpt-4o, definition has gpt-4o-mini"}},
+		},
+		{
+			name:        "drift by ID, applied",
+			assistantID: "asst_1",
+			remote:      stale,
+			apply:       true,
+			want:        AssistantSyncResult{ID: "asst_1", Drift: []string{"model: remote has gpt-4o, definition has gpt-4o-mini"}, Updated: true},
+			updated:     true,
+		},
+		{
+			name:  "missing, not applied",
+			pages: []string{`{"data": [], "has_more": false}`},
+			want:  AssistantSyncResult{Drift: []string{`assistant "Picker" does not exist`}},
+		},
+		{
+			name:    "missing, created",
+			pages:   []string{`{"data": [], "has_more": false}`},
+			apply:   true,
+			want:    AssistantSyncResult{ID: "asst_new", Drift: []string{`assistant "Picker" does not exist`}, Created: true},
+			created: true,
+		},
+		{
+			name:    "ambiguous name",
+			pages:   []string{`{"data": [{"id": "asst_1", "name": "Picker"}, {"id": "asst_2", "name": "Picker"}], "has_more": false}`},
+			wantErr: `assistants asst_1 and asst_2 are both called "Picker"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOpenAI(t)
+			if len(tt.pages) > 0 {
+				f.reply("GET /v1/assistants", http.StatusOK, tt.pages...)
+			}
+			if tt.remote != "" {
+				f.reply("GET /v1/assistants/asst_1", http.StatusOK, tt.remote)
+			}
+			f.reply("POST /v1/assistants", http.StatusOK, `{"id": "asst_new"}`)
+			f.reply("POST /v1/assistants/asst_1", http.StatusOK, current)
+			c := NewAssistantsClient("sk-test", WithBaseURL(f.URL+"/v1"))
+			c.silenceErrors = true
+
+			result, err := c.SyncAssistant(context.Background(), definition, tt.assistantID, tt.apply)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SyncAssistant() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*result, tt.want) {
+				t.Errorf("SyncAssistant() = %+v, want %+v", *result, tt.want)
+			}
+			if created := len(f.received("POST /v1/assistants")) > 0; created != tt.created {
+				t.Errorf("created = %v, want %v", created, tt.created)
+			}
+			updates := f.received("POST /v1/assistants/asst_1")
+			if updated := len(updates) > 0; updated != tt.updated {
+				t.Errorf("updated = %v, want %v", updated, tt.updated)
+			}
+			if len(updates) > 0 && !strings.Contains(updates[0].Body, `"tools":[]`) {
+				t.Errorf("update body = %s, want tools always sent", updates[0].Body)
+			}
+			for _, r := range f.received("GET /v1/assistants") {
+				if r.Header.Get("OpenAI-Beta") != OpenAIBetaHeader {
+					t.Errorf("listed assistants without the OpenAI-Beta header")
+				}
+			}
+		})
+	}
+}
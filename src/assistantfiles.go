@@ -0,0 +1,269 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File purposes for uploads.
+const (
+	FilePurposeAssistants string = "assistants" // Documents for file_search or code_interpreter
+	FilePurposeVision     string = "vision"     // Images shown to the model as image_file content
+)
+
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+// MessageAttachment makes an uploaded file available to the given tools for a message.
+type MessageAttachment struct {
+	FileID string `json:"file_id"`
+	Tools  []Tool `json:"tools"`
+}
+
+// MessageContentPart is one block of a message with more than plain text.
+type MessageContentPart struct {
+	Type      string     `json:"type"` // "text" or "image_file"
+	Text      string     `json:"text,omitempty"`
+	ImageFile *ImageFile `json:"image_file,omitempty"`
+}
+
+type ImageFile struct {
+	FileID string `json:"file_id"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// AttachmentOptions controls which email attachments AttachFiles uploads.
+type AttachmentOptions struct {
+	MaxBytes     int      // Larger attachments are skipped
+	MaxFiles     int      // Attachments after this many are skipped
+	AllowedTypes []string // Media types, or prefixes such as "image/"
+}
+
+// DefaultAttachmentOptions allows photos, order forms and spreadsheets.
+var DefaultAttachmentOptions = AttachmentOptions{
+	MaxBytes: 20 << 20,
+	MaxFiles: 5,
+	AllowedTypes: []string{
+		"image/png", "image/jpeg", "image/gif", "image/webp",
+		"application/pdf",
+		"application/msword",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"text/plain",
+		"text/csv",
+		"application/vnd.ms-excel",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	},
+}
+
+// AttachmentOptionsFromEnv reads ATTACHMENT_MAX_BYTES, ATTACHMENT_MAX_FILES and ATTACHMENT_TYPES
+// (comma separated), using DefaultAttachmentOptions for any that are unset.
+func AttachmentOptionsFromEnv() AttachmentOptions {
+	options := DefaultAttachmentOptions
+	if n, err := strconv.Atoi(os.Getenv("ATTACHMENT_MAX_BYTES")); err == nil {
+		options.MaxBytes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("ATTACHMENT_MAX_FILES")); err == nil {
+		options.MaxFiles = n
+	}
+	if types := os.Getenv("ATTACHMENT_TYPES"); types != "" {
+		options.AllowedTypes = nil
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				options.AllowedTypes = append(options.AllowedTypes, t)
+			}
+		}
+	}
+	return options
+}
+
+func (o AttachmentOptions) allows(attachment Attachment) bool {
+	if attachment.Size > o.MaxBytes {
+		return false
+	}
+	contentType := strings.ToLower(attachment.ContentType)
+	for _, allowed := range o.AllowedTypes {
+		allowed = strings.ToLower(allowed)
+		if contentType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(contentType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// attachmentTool picks the tool that can read a document: code_interpreter for spreadsheets,
+// which file_search can't index, and file_search for everything else.
+func attachmentTool(contentType string) string {
+	switch strings.ToLower(contentType) {
+	case "text/csv", "application/vnd.ms-excel", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+		return "code_interpreter"
+	}
+	return "file_search"
+}
+
+// UploadFile uploads data to OpenAI for use in threads or vector stores.
+func (c *openAIClient) UploadFile(ctx context.Context, filename, contentType string, data []byte, purpose string) (*File, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("purpose", purpose); err != nil {
+		return nil, fmt.Errorf("failed to build upload form: %w", err)
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, quoteEscaper.Replace(filename)))
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build upload form: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to build upload form: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build upload form: %w", err)
+	}
+
+	resp, err := c.sendForm(ctx, c.endpoint("/files"), body.Bytes(), form.FormDataContentType())
+	if err != nil {
+		c.logError(fmt.Sprintf("Error sending request to upload file: %v", err))
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(resp)
+		c.logError(fmt.Sprintf("Upload of %s failed: %v", filename, apiErr))
+		return nil, fmt.Errorf("failed to upload file: %w", apiErr)
+	}
+
+	var file File
+	if err := json.Unmarshal(resp.Body, &file); err != nil {
+		c.logError(fmt.Sprintf("Failed to unmarshal file response: %v, body: %s", err, string(resp.Body)))
+		return nil, fmt.Errorf("failed to unmarshal file response: %w", err)
+	}
+	return &file, nil
+}
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// GetFile looks up an uploaded or generated file.
+func (c *openAIClient) GetFile(ctx context.Context, fileID string) (*File, error) {
+	url := c.endpoint("/files/%s", fileID)
+	resp, err := c.send(ctx, "GET", url, nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get file %s: %w", fileID, newAPIError(resp))
+	}
+
+	var file File
+	if err := json.Unmarshal(resp.Body, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file response: %w", err)
+	}
+	return &file, nil
+}
+
+// DeleteFile deletes an uploaded file.
+func (c *openAIClient) DeleteFile(ctx context.Context, fileID string) error {
+	url := c.endpoint("/files/%s", fileID)
+	resp, err := c.send(ctx, "DELETE", url, nil, true)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete file %s: %w", fileID, newAPIError(resp))
+	}
+	return nil
+}
+
+// AttachFiles uploads the attachments that options allow and adds them to the next message sent
+// to the thread: images as image_file content, spreadsheets for code_interpreter and other
+// documents for file_search. Those tools are added to the run, alongside the assistant's own.
+// Call DeleteUploadedFiles once the reply is in.
+func (a *Assistant) AttachFiles(ctx context.Context, attachments []Attachment, options AttachmentOptions) error {
+	attached := 0
+	for _, attachment := range attachments {
+		if attached >= options.MaxFiles {
+			a.logError(fmt.Sprintf("Skipping attachment %s: more than %d files", attachment.Filename, options.MaxFiles))
+			continue
+		}
+		if !options.allows(attachment) {
+			a.logError(fmt.Sprintf("Skipping attachment %s (%s, %d bytes)", attachment.Filename, attachment.ContentType, attachment.Size))
+			continue
+		}
+
+		purpose := FilePurposeAssistants
+		if strings.HasPrefix(strings.ToLower(attachment.ContentType), "image/") {
+			purpose = FilePurposeVision
+		}
+		file, err := a.UploadFile(ctx, attachment.Filename, attachment.ContentType, attachment.Data, purpose)
+		if err != nil {
+			return err
+		}
+		a.uploadedFiles = append(a.uploadedFiles, file.ID)
+		attached++
+
+		if purpose == FilePurposeVision {
+			a.pendingImages = append(a.pendingImages, ImageFile{FileID: file.ID})
+			continue
+		}
+		tool := attachmentTool(attachment.ContentType)
+		a.pendingAttachments = append(a.pendingAttachments, MessageAttachment{FileID: file.ID, Tools: []Tool{{Type: tool}}})
+		if !slices.Contains(a.attachmentTools, tool) {
+			a.attachmentTools = append(a.attachmentTools, tool)
+		}
+	}
+	return nil
+}
+
+// DeleteUploadedFiles deletes every file the Assistant has uploaded. Like cancelRun it has its own
+// deadline, so it can be deferred past the caller's. Failures are logged and the first returned.
+func (a *Assistant) DeleteUploadedFiles() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var first error
+	for _, fileID := range a.uploadedFiles {
+		if err := a.DeleteFile(ctx, fileID); err != nil {
+			a.logError(fmt.Sprintf("Failed to delete file %s: %v", fileID, err))
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	a.uploadedFiles = nil
+	return first
+}
+
+// messagePayload builds the next user message, taking any files attached since the last one.
+func (a *Assistant) messagePayload(prompt string) AddMessagePayload {
+	payload := AddMessagePayload{
+		Role:        "user",
+		Content:     prompt,
+		Attachments: a.pendingAttachments,
+	}
+	if len(a.pendingImages) > 0 {
+		parts := []MessageContentPart{{Type: "text", Text: prompt}}
+		for i := range a.pendingImages {
+			parts = append(parts, MessageContentPart{Type: "image_file", ImageFile: &a.pendingImages[i]})
+		}
+		payload.Content = parts
+	}
+	return payload
+}
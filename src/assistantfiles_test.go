@@ -0,0 +1,192 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAttachmentOptionsAllows(t *testing.T) {
+	options := AttachmentOptions{MaxBytes: 100, AllowedTypes: []string{"application/pdf", "image/"}}
+	tests := []struct {
+		attachment Attachment
+		want       bool
+	}{
+		{Attachment{ContentType: "application/pdf", Size: 100}, true},
+		{Attachment{ContentType: "Application/PDF", Size: 10}, true},
+		{Attachment{ContentType: "image/heic", Size: 10}, true},
+		{Attachment{ContentType: "application/pdf", Size: 101}, false},
+		{Attachment{ContentType: "application/zip", Size: 10}, false},
+		{Attachment{ContentType: "imagery/png", Size: 10}, false},
+	}
+	for _, tt := range tests {
+		if got := options.allows(tt.attachment); got != tt.want {
+			t.Errorf("allows(%s, %d bytes) = %v, want %v", tt.attachment.ContentType, tt.attachment.Size, got, tt.want)
+		}
+	}
+}
+
+func TestAttachmentOptionsFromEnv(t *testing.T) {
+	t.Setenv("ATTACHMENT_MAX_BYTES", "")
+	t.Setenv("ATTACHMENT_MAX_FILES", "")
+	t.Setenv("ATTACHMENT_TYPES", "")
+	if got := AttachmentOptionsFromEnv(); got.MaxBytes != DefaultAttachmentOptions.MaxBytes || got.MaxFiles != DefaultAttachmentOptions.MaxFiles ||
+		len(got.AllowedTypes) != len(DefaultAttachmentOptions.AllowedTypes) {
+		t.Errorf("AttachmentOptionsFromEnv() = %+v, want the defaults", got)
+	}
+
+	t.Setenv("ATTACHMENT_MAX_BYTES", "1024")
+	t.Setenv("ATTACHMENT_MAX_FILES", "2")
+	t.Setenv("ATTACHMENT_TYPES", " image/ , application/pdf,,")
+	got := AttachmentOptionsFromEnv()
+	if got.MaxBytes != 1024 || got.MaxFiles != 2 || strings.Join(got.AllowedTypes, ",") != "image/,application/pdf" {
+		t.Errorf("AttachmentOptionsFromEnv() = %+v", got)
+	}
+}
+
+func TestAttachmentTool(t *testing.T) {
+	for contentType, want := range map[string]string{
+		"text/csv":                 "code_interpreter",
+		"application/vnd.ms-excel": "code_interpreter",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "code_interpreter",
+		"application/pdf": "file_search",
+		"text/plain":      "file_search",
+	} {
+		if got := attachmentTool(contentType); got != want {
+			t.Errorf("attachmentTool(%s) = %s, want %s", contentType, got, want)
+		}
+	}
+}
+
+// upload is a file as the fake received it.
+type upload struct {
+	purpose, filename, contentType, data string
+}
+
+// fakeUploads answers uploads with file_1, file_2... and records them.
+func (f *fakeOpenAI) fakeUploads(t *testing.T) func() []upload {
+	var mu sync.Mutex
+	var uploads []upload
+	f.handle("POST /v1/files", func(w http.ResponseWriter, r *http.Request) {
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			t.Errorf("upload Content-Type: %v", err)
+		}
+		var u upload
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(part)
+			switch part.FormName() {
+			case "purpose":
+				u.purpose = string(data)
+			case "file":
+				u.filename, u.contentType, u.data = part.FileName(), part.Header.Get("Content-Type"), string(data)
+			}
+		}
+		mu.Lock()
+		uploads = append(uploads, u)
+		id := fmt.Sprintf("file_%d", len(uploads))
+		mu.Unlock()
+		fmt.Fprintf(w, `{"id": %q, "filename": %q, "purpose": %q}`, id, u.filename, u.purpose)
+	})
+	return func() []upload {
+		mu.Lock()
+		defer mu.Unlock()
+		return uploads
+	}
+}
+
+func TestAttachFiles(t *testing.T) {
+	f := newFakeOpenAI(t)
+	uploads := f.fakeUploads(t)
+	f.fakeRun("completed")
+	f.reply("GET /v1/assistants/asst_1", http.StatusOK, `{"id": "asst_1", "tools": [{"type": "file_search"}]}`)
+	for _, id := range []string{"file_1", "file_2", "file_3"} {
+		f.reply("DELETE /v1/files/"+id, http.StatusOK, `{"deleted": true}`)
+	}
+
+	a := f.assistant(PollRuns)
+	attachments := []Attachment{
+		{Filename: "photo.jpg", ContentType: "image/jpeg", Size: 4, Data: []byte("jpeg")},
+		{Filename: "virus.exe", ContentType: "application/octet-stream", Size: 3, Data: []byte("exe")},
+		{Filename: `order "May".csv`, ContentType: "text/csv", Size: 7, Data: []byte("sku,qty")},
+		{Filename: "terms.pdf", ContentType: "application/pdf", Size: 3, Data: []byte("pdf")},
+		{Filename: "extra.pdf", ContentType: "application/pdf", Size: 3, Data: []byte("pdf")},
+	}
+	if err := a.AttachFiles(context.Background(), attachments, AttachmentOptions{MaxBytes: 100, MaxFiles: 3, AllowedTypes: []string{"image/", "text/csv", "application/pdf"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []upload{
+		{purpose: FilePurposeVision, filename: "photo.jpg", contentType: "image/jpeg", data: "jpeg"},
+		{purpose: FilePurposeAssistants, filename: `order "May".csv`, contentType: "text/csv", data: "sku,qty"},
+		{purpose: FilePurposeAssistants, filename: "terms.pdf", contentType: "application/pdf", data: "pdf"},
+	}
+	if got := uploads(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("uploads = %+v, want %+v", got, want)
+	}
+
+	if _, err := a.AddMessageToThreadContext(context.Background(), "see attached"); err != nil {
+		t.Fatal(err)
+	}
+	var message struct {
+		Content     []MessageContentPart `json:"content"`
+		Attachments []MessageAttachment  `json:"attachments"`
+	}
+	if err := json.Unmarshal([]byte(f.received("POST /v1/threads/thread_1/messages")[0].Body), &message); err != nil {
+		t.Fatal(err)
+	}
+	if len(message.Content) != 2 || message.Content[0].Text != "see attached" || message.Content[1].ImageFile.FileID != "file_1" {
+		t.Errorf("message content = %+v, want the text and the photo", message.Content)
+	}
+	if len(message.Attachments) != 2 || message.Attachments[0].FileID != "file_2" || message.Attachments[0].Tools[0].Type != "code_interpreter" ||
+		message.Attachments[1].FileID != "file_3" || message.Attachments[1].Tools[0].Type != "file_search" {
+		t.Errorf("message attachments = %+v", message.Attachments)
+	}
+	var run RunThreadPayload
+	json.Unmarshal([]byte(f.received("POST /v1/threads/thread_1/runs")[0].Body), &run)
+	if len(run.Tools) != 2 || run.Tools[0].Type != "file_search" || run.Tools[1].Type != "code_interpreter" {
+		t.Errorf("run tools = %+v, want file_search and code_interpreter", run.Tools)
+	}
+
+	// Files go with one message only.
+	if payload := a.messagePayload("thanks"); payload.Content != "thanks" || payload.Attachments != nil {
+		t.Errorf("next message = %+v, want plain text", payload)
+	}
+
+	if err := a.DeleteUploadedFiles(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"file_1", "file_2", "file_3"} {
+		if len(f.received("DELETE /v1/files/"+id)) != 1 {
+			t.Errorf("%s not deleted", id)
+		}
+	}
+}
+
+func TestAttachFilesUploadFails(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.reply("POST /v1/files", http.StatusBadRequest, `{"error": {"message": "File type not supported", "type": "invalid_request_error"}}`)
+	a := f.assistant(PollRuns)
+
+	err := a.AttachFiles(context.Background(), []Attachment{{Filename: "terms.pdf", ContentType: "application/pdf", Size: 3, Data: []byte("pdf")}}, DefaultAttachmentOptions)
+	var apiErr *APIError
+	if err == nil || !strings.Contains(err.Error(), "failed to upload file") || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("AttachFiles() error = %v, want the failed upload", err)
+	}
+	if len(a.uploadedFiles) != 0 || len(a.attachmentTools) != 0 {
+		t.Errorf("uploaded %v with tools %v after the upload failed", a.uploadedFiles, a.attachmentTools)
+	}
+}
@@ -0,0 +1,316 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling OpenAI while recent calls have kept failing.
+var ErrCircuitOpen = errors.New("OpenAI circuit breaker is open")
+
+// RetryPolicy controls how OpenAI requests are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // Including the first attempt
+	BaseDelay   time.Duration // Backoff before jitter doubles from here...
+	MaxDelay    time.Duration // ...up to here
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    20 * time.Second,
+}
+
+// apiResponse is a fully read OpenAI response, except for successful streaming requests.
+type apiResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Stream     io.ReadCloser // Unread body of a successful streaming request, in place of Body
+}
+
+// requestExecutor sends OpenAI requests with retries, rate limit awareness and a circuit breaker.
+type requestExecutor struct {
+	client  *http.Client
+	policy  RetryPolicy
+	breaker *circuitBreaker
+	limits  *rateLimiter
+}
+
+// Breakers and rate limits are shared by every Assistant talking to the same base URL, so that
+// their state survives across emails in a warm Lambda.
+var (
+	sharedLimitsMu sync.Mutex
+	breakers       = map[string]*circuitBreaker{}
+	rateLimiters   = map[string]*rateLimiter{}
+)
+
+func sharedLimits(baseURL string) (*circuitBreaker, *rateLimiter) {
+	sharedLimitsMu.Lock()
+	defer sharedLimitsMu.Unlock()
+
+	if breakers[baseURL] == nil {
+		breakers[baseURL] = &circuitBreaker{threshold: 5, cooldown: 30 * time.Second}
+		rateLimiters[baseURL] = &rateLimiter{}
+	}
+	return breakers[baseURL], rateLimiters[baseURL]
+}
+
+// do executes the request built by newRequest, retrying where safe. idempotent requests (reads,
+// cancels) are retried on any network error, 408, 409, 429 or 5xx. Others, which could create a
+// duplicate thread, message or run, are only retried when OpenAI cannot have acted on them: a 429
+// or a connection that was never established.
+// Non-2xx responses are returned, not turned into errors, once retries are exhausted.
+// For stream requests a 200 response's body is left for the caller to read and close.
+func (e *requestExecutor) do(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error), idempotent, stream bool) (*apiResponse, error) {
+	attempts := e.policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		if err := e.limits.wait(ctx); err != nil {
+			return nil, err
+		}
+		if !e.breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		req, err := newRequest(ctx)
+		if err != nil {
+			e.breaker.release()
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := e.send(req, stream)
+		retryable := false
+		var wait time.Duration
+		if err != nil {
+			if ctx.Err() != nil {
+				// Our own timeout or cancellation says nothing about OpenAI's health.
+				e.breaker.release()
+			} else {
+				e.breaker.record(false)
+			}
+			lastErr = err
+			retryable = ctx.Err() == nil && (idempotent || neverConnected(err))
+		} else {
+			e.breaker.record(resp.StatusCode < 500)
+			e.limits.update(resp.Header)
+			retryable = retryableStatus(resp.StatusCode, idempotent)
+			wait = retryAfter(resp.StatusCode, resp.Header)
+		}
+
+		if !retryable || attempt >= attempts {
+			if err != nil {
+				return nil, lastErr
+			}
+			return resp, nil
+		}
+
+		if backoff := e.backoff(attempt); backoff > wait {
+			wait = backoff
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			// No time left to retry, so report what we have.
+			if err != nil {
+				return nil, lastErr
+			}
+			return resp, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (e *requestExecutor) send(req *http.Request, stream bool) (*apiResponse, error) {
+	client := e.client
+	if stream {
+		// The client timeout includes reading the body, which for a stream lasts as long as the
+		// run does. The request context bounds it instead.
+		streaming := *client
+		streaming.Timeout = 0
+		client = &streaming
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if stream && resp.StatusCode == http.StatusOK {
+		return &apiResponse{StatusCode: resp.StatusCode, Header: resp.Header, Stream: resp.Body}, nil
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return &apiResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: bodyBytes}, nil
+}
+
+// backoff is exponential with full jitter.
+func (e *requestExecutor) backoff(attempt int) time.Duration {
+	ceiling := e.policy.BaseDelay << (attempt - 1)
+	if ceiling > e.policy.MaxDelay || ceiling <= 0 {
+		ceiling = e.policy.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+func retryableStatus(status int, idempotent bool) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+	return status == http.StatusRequestTimeout || status == http.StatusConflict || status >= 500
+}
+
+// neverConnected reports whether err happened before the request could reach OpenAI.
+func neverConnected(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// retryAfter reads how long OpenAI asked us to wait, from retry-after-ms, Retry-After
+// (seconds or an HTTP date) or, failing those and only for a 429, the x-ratelimit-reset-* headers.
+// Other statuses carry those headers too, but their resets say nothing about the failure.
+func retryAfter(status int, header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return time.Until(at)
+		}
+	}
+	if status != http.StatusTooManyRequests {
+		return 0
+	}
+	return rateLimitReset(header, true)
+}
+
+// rateLimitReset returns the longest reset among exhausted limits, or any limit if all is set.
+func rateLimitReset(header http.Header, all bool) time.Duration {
+	var longest time.Duration
+	for _, kind := range []string{"requests", "tokens"} {
+		if !all && header.Get("x-ratelimit-remaining-"+kind) != "0" {
+			continue
+		}
+		reset, err := time.ParseDuration(strings.TrimSpace(header.Get("x-ratelimit-reset-" + kind)))
+		if err == nil && reset > longest {
+			longest = reset
+		}
+	}
+	return longest
+}
+
+// rateLimiter holds requests back after OpenAI reports a limit as exhausted.
+type rateLimiter struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (l *rateLimiter) update(header http.Header) {
+	reset := rateLimitReset(header, false)
+	if reset <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(reset); until.After(l.until) {
+		l.until = until
+	}
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	delay := time.Until(l.until)
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// circuitBreaker opens after threshold consecutive failures (network errors or 5xx) and then
+// lets a single trial request through every cooldown until one succeeds.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// release ends a trial without counting it either way, for requests that never reached OpenAI
+// or were cancelled by the caller.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,283 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testExecutor returns an executor with a breaker and rate limiter of its own.
+func testExecutor(policy RetryPolicy) *requestExecutor {
+	return &requestExecutor{
+		client:  &http.Client{Timeout: 5 * time.Second},
+		policy:  policy,
+		breaker: &circuitBreaker{threshold: 5, cooldown: time.Minute},
+		limits:  &rateLimiter{},
+	}
+}
+
+func TestRequestExecutorDo(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int // Response statuses in turn, repeating the last
+		idempotent bool
+		attempts   int // Requests expected
+		want       int // Status returned
+	}{
+		{name: "success", statuses: []int{200}, idempotent: true, attempts: 1, want: 200},
+		{name: "server errors retried for reads", statuses: []int{503, 502, 200}, idempotent: true, attempts: 3, want: 200},
+		{name: "server errors not retried for writes", statuses: []int{503, 200}, attempts: 1, want: 503},
+		{name: "429 retried for writes", statuses: []int{429, 200}, attempts: 2, want: 200},
+		{name: "409 retried for reads", statuses: []int{409, 200}, idempotent: true, attempts: 2, want: 200},
+		{name: "client errors not retried", statuses: []int{400}, idempotent: true, attempts: 1, want: 400},
+		{name: "gives up after MaxAttempts", statuses: []int{500}, idempotent: true, attempts: 3, want: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := int(atomic.AddInt32(&n, 1)) - 1
+				w.WriteHeader(tt.statuses[min(i, len(tt.statuses)-1)])
+				io.WriteString(w, "{}")
+			}))
+			defer server.Close()
+
+			e := testExecutor(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+			resp, err := e.do(context.Background(), func(ctx context.Context) (*http.Request, error) {
+				return http.NewRequestWithContext(ctx, "POST", server.URL, nil)
+			}, tt.idempotent, false)
+			if err != nil {
+				t.Fatalf("do() error = %v", err)
+			}
+			if resp.StatusCode != tt.want || string(resp.Body) != "{}" {
+				t.Errorf("do() = %d %s, want %d", resp.StatusCode, resp.Body, tt.want)
+			}
+			if got := int(atomic.LoadInt32(&n)); got != tt.attempts {
+				t.Errorf("sent %d requests, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRequestExecutorNetworkErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close() // Nothing listens, so every dial fails
+
+	for _, idempotent := range []bool{true, false} {
+		var n int
+		e := testExecutor(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+		_, err := e.do(context.Background(), func(ctx context.Context) (*http.Request, error) {
+			n++
+			return http.NewRequestWithContext(ctx, "POST", url, nil)
+		}, idempotent, false)
+		// Even writes are retried, since a failed dial can't have reached OpenAI.
+		if err == nil || n != 3 {
+			t.Errorf("idempotent %v: do() = %v after %d attempts, want an error after 3", idempotent, err, n)
+		}
+	}
+}
+
+func TestRequestExecutorHonoursRetryAfter(t *testing.T) {
+	var n int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) == 1 {
+			w.Header().Set("retry-after-ms", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	e := testExecutor(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	started := time.Now()
+	resp, err := e.do(context.Background(), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	}, true, false)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("do() = %v, %v", resp, err)
+	}
+	if elapsed := time.Since(started); elapsed < 60*time.Millisecond {
+		t.Errorf("retried after %s, want the 60ms asked for", elapsed)
+	}
+
+	// With no time left to wait that long, the 429 is returned as it is.
+	atomic.StoreInt32(&n, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resp, err = e.do(ctx, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	}, true, false)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("do() near the deadline = %v, %v; want the 429", resp, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	e := testExecutor(RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	for attempt, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 40: time.Second} {
+		for i := 0; i < 20; i++ {
+			if got := e.backoff(attempt); got < 0 || got >= ceiling {
+				t.Fatalf("backoff(%d) = %s, want under %s", attempt, got, ceiling)
+			}
+		}
+	}
+	if got := testExecutor(RetryPolicy{}).backoff(1); got != 0 {
+		t.Errorf("backoff() without delays = %s, want 0", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		want   time.Duration
+	}{
+		{name: "nothing", status: 429},
+		{name: "milliseconds", status: 503, header: map[string]string{"retry-after-ms": "250", "Retry-After": "9"}, want: 250 * time.Millisecond},
+		{name: "seconds", status: 503, header: map[string]string{"Retry-After": "2"}, want: 2 * time.Second},
+		{name: "fractional seconds", status: 429, header: map[string]string{"Retry-After": "1.5"}, want: 1500 * time.Millisecond},
+		{name: "junk", status: 429, header: map[string]string{"Retry-After": "soon", "retry-after-ms": "-5"}},
+		{
+			name:   "a 429 falls back to the rate limit resets",
+			status: 429,
+			header: map[string]string{"x-ratelimit-reset-requests": "1s", "x-ratelimit-reset-tokens": "6m0s", "x-ratelimit-remaining-tokens": "100"},
+			want:   6 * time.Minute,
+		},
+		{
+			name:   "other statuses ignore the rate limit resets",
+			status: 503,
+			header: map[string]string{"x-ratelimit-reset-requests": "1s", "x-ratelimit-reset-tokens": "6m0s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			if got := retryAfter(tt.status, header); got != tt.want {
+				t.Errorf("retryAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	header := http.Header{}
+	header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if got := retryAfter(503, header); got < 58*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(HTTP date a minute away) = %s", got)
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	header := http.Header{}
+	header.Set("x-ratelimit-remaining-requests", "0")
+	header.Set("x-ratelimit-reset-requests", "2s")
+	header.Set("x-ratelimit-remaining-tokens", "5000")
+	header.Set("x-ratelimit-reset-tokens", "1m30s")
+
+	if got := rateLimitReset(header, false); got != 2*time.Second {
+		t.Errorf("rateLimitReset(exhausted) = %s, want the requests reset", got)
+	}
+	if got := rateLimitReset(header, true); got != 90*time.Second {
+		t.Errorf("rateLimitReset(all) = %s, want the longest reset", got)
+	}
+	if got := rateLimitReset(http.Header{}, true); got != 0 {
+		t.Errorf("rateLimitReset(no headers) = %s, want 0", got)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := &rateLimiter{}
+	header := http.Header{}
+	header.Set("x-ratelimit-remaining-requests", "1")
+	header.Set("x-ratelimit-reset-requests", "1h")
+	l.update(header)
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatalf("wait() with requests left = %v", err)
+	}
+
+	header.Set("x-ratelimit-remaining-requests", "0")
+	header.Set("x-ratelimit-reset-requests", "1h")
+	l.update(header)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait() with the limit exhausted = %v, want to be held until the deadline", err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &circuitBreaker{threshold: 2, cooldown: 20 * time.Millisecond}
+
+	b.record(false)
+	if !b.allow() {
+		t.Fatal("opened before the threshold")
+	}
+	b.record(true)
+	b.record(false)
+	if !b.allow() {
+		t.Fatal("a success didn't reset the failures")
+	}
+	b.record(false)
+	if b.allow() {
+		t.Fatal("still closed after threshold failures")
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("no trial let through after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("a second request let through during the trial")
+	}
+	b.release()
+	if !b.allow() {
+		t.Fatal("a released trial wasn't given back")
+	}
+	b.record(false)
+	if b.allow() {
+		t.Fatal("a failed trial didn't reopen the breaker")
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("no trial let through after the second cooldown")
+	}
+	b.record(true)
+	if !b.allow() || !b.allow() {
+		t.Fatal("a successful trial didn't close the breaker")
+	}
+}
+
+func TestRequestExecutorOpensCircuit(t *testing.T) {
+	var n int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	e := testExecutor(RetryPolicy{MaxAttempts: 1})
+	newRequest := func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := e.do(context.Background(), newRequest, true, false); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if _, err := e.do(context.Background(), newRequest, true, false); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("do() after 5 failures = %v, want %v", err, ErrCircuitOpen)
+	}
+	if got := atomic.LoadInt32(&n); got != 5 {
+		t.Errorf("OpenAI got %d requests, want 5", got)
+	}
+}
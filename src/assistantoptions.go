@@ -0,0 +1,83 @@
+package inbound
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// AssistantOption configures an OpenAI client (an Assistant, ChatClient or ResponsesClient)
+// beyond its key.
+type AssistantOption func(*openAIClient)
+
+// WithBaseURL points the client at another OpenAI-compatible API, such as a proxy or a local
+// stand-in server. The URL includes the version prefix, e.g. "http://localhost:8080/v1".
+func WithBaseURL(baseURL string) AssistantOption {
+	return func(a *openAIClient) {
+		a.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithHTTPClient replaces the default client, which has a 30 second timeout.
+func WithHTTPClient(client *http.Client) AssistantOption {
+	return func(a *openAIClient) {
+		a.executor.client = client
+	}
+}
+
+// WithTransport keeps the default client settings but sends requests through transport.
+func WithTransport(transport http.RoundTripper) AssistantOption {
+	return func(a *openAIClient) {
+		client := *a.executor.client
+		client.Transport = transport
+		a.executor.client = &client
+	}
+}
+
+// WithOrganization sets the OpenAI-Organization header.
+func WithOrganization(organization string) AssistantOption {
+	return func(a *openAIClient) {
+		a.organization = organization
+	}
+}
+
+// WithProject sets the OpenAI-Project header.
+func WithProject(project string) AssistantOption {
+	return func(a *openAIClient) {
+		a.project = project
+	}
+}
+
+// WithAzure talks to an Azure OpenAI resource instead: endpoint is e.g.
+// "https://my-resource.openai.azure.com", the key is sent as the api-key header and every
+// request carries the api-version query parameter. Assistant and model names are deployments.
+func WithAzure(endpoint, apiVersion string) AssistantOption {
+	return func(a *openAIClient) {
+		a.baseURL = strings.TrimRight(endpoint, "/") + "/openai"
+		a.apiVersion = apiVersion
+		a.azure = true
+	}
+}
+
+// AssistantOptionsFromEnv reads OPENAI_BASE_URL, OPENAI_ORGANIZATION, OPENAI_PROJECT and
+// AZURE_OPENAI_ENDPOINT with AZURE_OPENAI_API_VERSION.
+func AssistantOptionsFromEnv() []AssistantOption {
+	var options []AssistantOption
+	if v := os.Getenv("OPENAI_BASE_URL"); v != "" {
+		options = append(options, WithBaseURL(v))
+	}
+	if v := os.Getenv("OPENAI_ORGANIZATION"); v != "" {
+		options = append(options, WithOrganization(v))
+	}
+	if v := os.Getenv("OPENAI_PROJECT"); v != "" {
+		options = append(options, WithProject(v))
+	}
+	if v := os.Getenv("AZURE_OPENAI_ENDPOINT"); v != "" {
+		apiVersion := os.Getenv("AZURE_OPENAI_API_VERSION")
+		if apiVersion == "" {
+			apiVersion = "2024-05-01-preview"
+		}
+		options = append(options, WithAzure(v, apiVersion))
+	}
+	return options
+}
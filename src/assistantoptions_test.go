@@ -0,0 +1,149 @@
+package inbound
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAssistantOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want openAIClient
+	}{
+		{name: "defaults", want: openAIClient{baseURL: BaseURI + "/v1"}},
+		{
+			name: "proxy with organisation and project",
+			env:  map[string]string{"OPENAI_BASE_URL": "http://localhost:8080/v1/", "OPENAI_ORGANIZATION": "org_1", "OPENAI_PROJECT": "proj_1"},
+			want: openAIClient{baseURL: "http://localhost:8080/v1", organization: "org_1", project: "proj_1"},
+		},
+		{
+			name: "Azure with its default API version",
+			env:  map[string]string{"AZURE_OPENAI_ENDPOINT": "https://shop.openai.azure.com/"},
+			want: openAIClient{baseURL: "https://shop.openai.azure.com/openai", apiVersion: "2024-05-01-preview", azure: true},
+		},
+		{
+			name: "Azure with an API version",
+			env:  map[string]string{"AZURE_OPENAI_ENDPOINT": "https://shop.openai.azure.com", "AZURE_OPENAI_API_VERSION": "2024-10-01"},
+			want: openAIClient{baseURL: "https://shop.openai.azure.com/openai", apiVersion: "2024-10-01", azure: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"OPENAI_BASE_URL", "OPENAI_ORGANIZATION", "OPENAI_PROJECT", "AZURE_OPENAI_ENDPOINT", "AZURE_OPENAI_API_VERSION"} {
+				t.Setenv(name, tt.env[name])
+			}
+			c := newOpenAIClient("test", "sk-test", AssistantOptionsFromEnv())
+			if c.baseURL != tt.want.baseURL || c.organization != tt.want.organization || c.project != tt.want.project ||
+				c.apiVersion != tt.want.apiVersion || c.azure != tt.want.azure {
+				t.Errorf("client = %+v, want %+v", c, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		options func(f *fakeOpenAI) []AssistantOption
+		route   string
+		key     string
+		header  map[string]string
+		version string
+	}{
+		{
+			name:    "OpenAI",
+			options: func(f *fakeOpenAI) []AssistantOption { return []AssistantOption{WithBaseURL(f.URL + "/v1")} },
+			route:   "GET /v1/assistants/asst_1",
+			key:     "sk-test",
+			header:  map[string]string{"Authorization": "Bearer sk-test", "api-key": ""},
+		},
+		{
+			name: "organisation and project",
+			options: func(f *fakeOpenAI) []AssistantOption {
+				return []AssistantOption{WithBaseURL(f.URL + "/v1"), WithOrganization("org_1"), WithProject("proj_1")}
+			},
+			route:  "GET /v1/assistants/asst_1",
+			key:    "sk-test",
+			header: map[string]string{"OpenAI-Organization": "org_1", "OpenAI-Project": "proj_1"},
+		},
+		{
+			name: "Azure",
+			options: func(f *fakeOpenAI) []AssistantOption {
+				return []AssistantOption{WithAzure(f.URL, "2024-05-01-preview")}
+			},
+			route:   "GET /openai/assistants/asst_1",
+			key:     "azure-key",
+			header:  map[string]string{"api-key": "azure-key", "Authorization": ""},
+			version: "2024-05-01-preview",
+		},
+		{
+			name:    "a local server without a key",
+			options: func(f *fakeOpenAI) []AssistantOption { return []AssistantOption{WithBaseURL(f.URL + "/v1")} },
+			route:   "GET /v1/assistants/asst_1",
+			header:  map[string]string{"Authorization": "", "api-key": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOpenAI(t)
+			f.reply(tt.route, http.StatusOK, `{"id": "asst_1"}`)
+			c := newOpenAIClient("test", tt.key, tt.options(f))
+
+			var out AssistantObject
+			if err := c.callJSON(context.Background(), "GET", c.endpoint("/assistants/%s", "asst_1"), nil, &out, true, "get assistant"); err != nil {
+				t.Fatalf("callJSON() error = %v", err)
+			}
+			requests := f.received(tt.route)
+			if len(requests) != 1 || out.ID != "asst_1" {
+				t.Fatalf("requests to %s = %d, assistant %+v", tt.route, len(requests), out)
+			}
+			for name, want := range tt.header {
+				if got := requests[0].Header.Get(name); got != want {
+					t.Errorf("header %s = %q, want %q", name, got, want)
+				}
+			}
+			if got := requests[0].Query.Get("api-version"); got != tt.version {
+				t.Errorf("api-version = %q, want %q", got, tt.version)
+			}
+		})
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	openAI := &openAIClient{baseURL: "https://api.openai.com/v1"}
+	azure := &openAIClient{baseURL: "https://shop.openai.azure.com/openai", apiVersion: "2024-05-01-preview"}
+
+	if got, want := openAI.endpoint("/threads/%s/runs", "thread/1"), "https://api.openai.com/v1/threads/thread%2F1/runs"; got != want {
+		t.Errorf("endpoint() = %q, want %q", got, want)
+	}
+	if got, want := azure.endpoint("/threads"), "https://shop.openai.azure.com/openai/threads?api-version=2024-05-01-preview"; got != want {
+		t.Errorf("endpoint() = %q, want %q", got, want)
+	}
+	if got, want := azure.endpoint("/files?purpose=%s", "assistants"), "https://shop.openai.azure.com/openai/files?purpose=assistants&api-version=2024-05-01-preview"; got != want {
+		t.Errorf("endpoint() with a query = %q, want %q", got, want)
+	}
+
+	query := url.Values{"limit": {"100"}}
+	if got, want := withQuery(azure.endpoint("/threads"), query), "https://shop.openai.azure.com/openai/threads?api-version=2024-05-01-preview&limit=100"; got != want {
+		t.Errorf("withQuery() = %q, want %q", got, want)
+	}
+	if got, want := withQuery(openAI.endpoint("/threads"), url.Values{}), "https://api.openai.com/v1/threads"; got != want {
+		t.Errorf("withQuery(nothing) = %q, want %q", got, want)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	client := &http.Client{Timeout: time.Second}
+	if c := newOpenAIClient("test", "sk-test", []AssistantOption{WithHTTPClient(client)}); c.executor.client != client {
+		t.Errorf("WithHTTPClient() client not used")
+	}
+	transport := &http.Transport{}
+	c := newOpenAIClient("test", "sk-test", []AssistantOption{WithTransport(transport)})
+	if c.executor.client.Transport != transport || c.executor.client.Timeout != 30*time.Second {
+		t.Errorf("WithTransport() client = %+v, want the default timeout with the transport", c.executor.client)
+	}
+}
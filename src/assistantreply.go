@@ -0,0 +1,156 @@
+package inbound
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Reply is everything the assistant said during a run.
+type Reply struct {
+	RunID      string
+	MessageIDs []string
+	Text       string          // Text of every assistant message in the run, in order
+	Messages   []string        // Text of each assistant message
+	References []FileReference // Files cited or produced; citations appear in Text as [1], [2]...
+	Images     []ImageFile     // Images the assistant produced, e.g. charts from code_interpreter
+}
+
+// FileReference is a file_citation or file_path annotation resolved to its file.
+type FileReference struct {
+	Type     string // "file_citation" or "file_path"
+	FileID   string
+	Filename string // Empty if the file couldn't be looked up
+	Quote    string // Cited text, for file_citation
+	Text     string // The text the annotation covered in the message, e.g. sandbox:/mnt/data/order.csv
+}
+
+type Annotation struct {
+	Type         string `json:"type"` // "file_citation" or "file_path"
+	Text         string `json:"text"`
+	StartIndex   int    `json:"start_index"`
+	EndIndex     int    `json:"end_index"`
+	FileCitation *struct {
+		FileID string `json:"file_id"`
+		Quote  string `json:"quote"`
+	} `json:"file_citation,omitempty"`
+	FilePath *struct {
+		FileID string `json:"file_id"`
+	} `json:"file_path,omitempty"`
+}
+
+// LastReply returns the full reply from the last run that completed, or nil.
+func (a *Assistant) LastReply() *Reply {
+	return a.lastReply
+}
+
+// GetLastReplyContext fetches the assistant messages of the current run, or the newest assistant
+// message on the thread if no run has been started by this Assistant.
+func (a *Assistant) GetLastReplyContext(ctx context.Context) (*Reply, error) {
+	var messages []Message
+	var err error
+	if a.runID != "" {
+		messages, err = a.assistantMessages(ctx, ListMessagesOptions{Limit: 100, Order: "asc", RunID: a.runID}, false)
+	} else {
+		messages, err = a.assistantMessages(ctx, ListMessagesOptions{Limit: 100, Order: "desc"}, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		a.logError("No assistant message found in the thread.")
+		return nil, fmt.Errorf("no assistant message found in thread %s", a.threadID)
+	}
+
+	a.lastReply = a.buildReply(ctx, messages)
+	return a.lastReply, nil
+}
+
+// assistantMessages pages through the thread's messages, keeping the assistant's. With firstOnly
+// it stops at the first one found.
+func (a *Assistant) assistantMessages(ctx context.Context, options ListMessagesOptions, firstOnly bool) ([]Message, error) {
+	var messages []Message
+	it := a.Messages(ctx, options)
+	for it.Next() {
+		if message := it.Message(); message.Role == "assistant" {
+			messages = append(messages, *message)
+			if firstOnly {
+				break
+			}
+		}
+	}
+	return messages, it.Err()
+}
+
+// buildReply joins the messages' text and resolves their annotations. Each citation marker in
+// the text is replaced with its number in References.
+func (a *Assistant) buildReply(ctx context.Context, messages []Message) *Reply {
+	reply := &Reply{RunID: a.runID}
+	filenames := map[string]string{}
+
+	var texts []string
+	for _, message := range messages {
+		reply.MessageIDs = append(reply.MessageIDs, message.ID)
+
+		var blocks []string
+		for _, content := range message.Content {
+			switch content.Type {
+			case "text":
+				blocks = append(blocks, a.resolveAnnotations(ctx, content.Text, reply, filenames))
+			case "image_file":
+				if content.ImageFile != nil {
+					reply.Images = append(reply.Images, *content.ImageFile)
+				}
+			}
+		}
+		text := strings.Join(blocks, "\n")
+		reply.Messages = append(reply.Messages, text)
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	reply.Text = strings.Join(texts, "\n\n")
+	return reply
+}
+
+func (a *Assistant) resolveAnnotations(ctx context.Context, text Text, reply *Reply, filenames map[string]string) string {
+	value := text.Value
+	for _, annotation := range text.Annotations {
+		reference := FileReference{Type: annotation.Type, Text: annotation.Text}
+		switch {
+		case annotation.FileCitation != nil:
+			reference.FileID = annotation.FileCitation.FileID
+			reference.Quote = annotation.FileCitation.Quote
+		case annotation.FilePath != nil:
+			reference.FileID = annotation.FilePath.FileID
+		default:
+			continue
+		}
+
+		filename, ok := filenames[reference.FileID]
+		if !ok {
+			if file, err := a.GetFile(ctx, reference.FileID); err == nil {
+				filename = file.Filename
+			} else {
+				a.logError(fmt.Sprintf("Failed to look up cited file %s: %v", reference.FileID, err))
+			}
+			filenames[reference.FileID] = filename
+		}
+		reference.Filename = filename
+
+		reply.References = append(reply.References, reference)
+		if annotation.Type == "file_citation" && annotation.Text != "" {
+			value = strings.Replace(value, annotation.Text, fmt.Sprintf("[%d]", len(reply.References)), 1)
+		}
+	}
+	return value
+}
+
+// replyText is the reply as a plain string, as AddMessageToThread returns it.
+func replyText(reply *Reply) (string, error) {
+	if reply.Text == "" {
+		return "", fmt.Errorf("no text content found in the reply to run %s", reply.RunID)
+	}
+	return reply.Text, nil
+}
@@ -0,0 +1,103 @@
+package inbound
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetLastReplyContext(t *testing.T) {
+	const messages = "GET /v1/threads/thread_1/messages"
+	f := newFakeOpenAI(t)
+	f.handle(messages, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch after := r.URL.Query().Get("after"); {
+		case r.URL.Query().Get("run_id") == "":
+			// The thread's newest messages, newest first.
+			w.Write([]byte(`{"data": [
+				{"id": "msg_9", "role": "user", "content": [{"type": "text", "text": {"value": "thanks"}}]},
+				{"id": "msg_8", "role": "assistant", "content": [{"type": "text", "text": {"value": "Newest reply"}}]},
+				{"id": "msg_7", "role": "assistant", "content": [{"type": "text", "text": {"value": "Older reply"}}]}
+			], "has_more": false}`))
+		case after == "":
+			w.Write([]byte(`{"data": [
+				{"id": "msg_1", "role": "assistant", "run_id": "run_1", "content": [
+					{"type": "text", "text": {"value": "We stock the Blue Widget【4:0†catalogue.csv】.", "annotations": [
+						{"type": "file_citation", "text": "【4:0†catalogue.csv】", "file_citation": {"file_id": "file_cat", "quote": "BW-100,Blue Widget"}}
+					]}},
+					{"type": "image_file", "image_file": {"file_id": "file_chart"}}
+				]}
+			], "has_more": true, "last_id": "msg_1"}`))
+		case after == "msg_1":
+			w.Write([]byte(`{"data": [
+				{"id": "msg_2", "role": "assistant", "run_id": "run_1", "content": [
+					{"type": "text", "text": {"value": "Your quote is at sandbox:/mnt/data/quote.csv, as is【4:1†catalogue.csv】.", "annotations": [
+						{"type": "file_path", "text": "sandbox:/mnt/data/quote.csv", "file_path": {"file_id": "file_quote"}},
+						{"type": "file_citation", "text": "【4:1†catalogue.csv】", "file_citation": {"file_id": "file_cat"}}
+					]}}
+				]}
+			], "has_more": false, "last_id": "msg_2"}`))
+		}
+	})
+	f.reply("GET /v1/files/file_cat", http.StatusOK, `{"id": "file_cat", "filename": "catalogue.csv"}`)
+
+	t.Run("a run's messages across pages", func(t *testing.T) {
+		a := f.assistant(PollRuns)
+		a.runID = "run_1"
+		reply, err := a.GetLastReplyContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := &Reply{
+			RunID:      "run_1",
+			MessageIDs: []string{"msg_1", "msg_2"},
+			Messages:   []string{"We stock the Blue Widget[1].", "Your quote is at sandbox:/mnt/data/quote.csv, as is[3]."},
+			Text:       "We stock the Blue Widget[1].\n\nYour quote is at sandbox:/mnt/data/quote.csv, as is[3].",
+			References: []FileReference{
+				{Type: "file_citation", FileID: "file_cat", Filename: "catalogue.csv", Quote: "BW-100,Blue Widget", Text: "【4:0†catalogue.csv】"},
+				{Type: "file_path", FileID: "file_quote", Text: "sandbox:/mnt/data/quote.csv"}, // Its lookup 404s
+				{Type: "file_citation", FileID: "file_cat", Filename: "catalogue.csv", Text: "【4:1†catalogue.csv】"},
+			},
+			Images: []ImageFile{{FileID: "file_chart"}},
+		}
+		if !reflect.DeepEqual(reply, want) {
+			t.Errorf("GetLastReplyContext() = %+v\nwant %+v", reply, want)
+		}
+		if a.LastReply() != reply {
+			t.Error("LastReply() isn't the reply just fetched")
+		}
+		if n := len(f.received("GET /v1/files/file_cat")); n != 1 {
+			t.Errorf("looked catalogue.csv up %d times, want once", n)
+		}
+		for _, r := range f.received(messages) {
+			if r.Query.Get("order") != "asc" || r.Query.Get("limit") != "100" {
+				t.Errorf("listed messages with %v, want oldest first, 100 a page", r.Query)
+			}
+		}
+	})
+
+	t.Run("without a run, the newest assistant message", func(t *testing.T) {
+		a := f.assistant(PollRuns)
+		reply, err := a.GetLastReplyContext(context.Background())
+		if err != nil || reply.Text != "Newest reply" || !reflect.DeepEqual(reply.MessageIDs, []string{"msg_8"}) {
+			t.Errorf("GetLastReplyContext() = %+v, %v; want msg_8 only", reply, err)
+		}
+	})
+}
+
+func TestGetLastReplyContextEmpty(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.reply("GET /v1/threads/thread_1/messages", http.StatusOK, `{"data": [{"id": "msg_1", "role": "user", "run_id": "run_1"}], "has_more": false}`)
+	a := f.assistant(PollRuns)
+	a.runID = "run_1"
+
+	if _, err := a.GetLastReplyContext(context.Background()); err == nil || !strings.Contains(err.Error(), "no assistant message found in thread thread_1") {
+		t.Errorf("GetLastReplyContext() error = %v, want no assistant message", err)
+	}
+	if _, err := replyText(&Reply{RunID: "run_1"}); err == nil {
+		t.Error("replyText() of a reply without text succeeded")
+	}
+}
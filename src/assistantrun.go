@@ -0,0 +1,103 @@
+package inbound
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Run statuses reported by the Assistants API.
+const (
+	RunStatusQueued         string = "queued"
+	RunStatusInProgress     string = "in_progress"
+	RunStatusRequiresAction string = "requires_action"
+	RunStatusCancelling     string = "cancelling"
+	RunStatusCancelled      string = "cancelled"
+	RunStatusFailed         string = "failed"
+	RunStatusCompleted      string = "completed"
+	RunStatusIncomplete     string = "incomplete"
+	RunStatusExpired        string = "expired"
+)
+
+// ErrRunTimeout is returned (wrapped) when a run doesn't finish within PollOptions.Timeout.
+var ErrRunTimeout = errors.New("timed out waiting for run")
+
+type RunLastError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type RunIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+// RunError describes a run that ended without a usable reply.
+type RunError struct {
+	RunID             string
+	Status            string
+	LastError         *RunLastError         // Set for failed runs
+	IncompleteDetails *RunIncompleteDetails // Set for incomplete runs
+}
+
+func (e *RunError) Error() string {
+	switch {
+	case e.LastError != nil:
+		return fmt.Sprintf("run %s %s: %s: %s", e.RunID, e.Status, e.LastError.Code, e.LastError.Message)
+	case e.IncompleteDetails != nil:
+		return fmt.Sprintf("run %s %s: %s", e.RunID, e.Status, e.IncompleteDetails.Reason)
+	}
+	return fmt.Sprintf("run %s %s", e.RunID, e.Status)
+}
+
+// PollOptions controls how long and how often a run is polled.
+type PollOptions struct {
+	Timeout         time.Duration // Total time to wait for the run to finish
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+}
+
+// DefaultPollOptions starts polling quickly, since most product picks finish in a few seconds.
+var DefaultPollOptions = PollOptions{
+	Timeout:         60 * time.Second,
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     5 * time.Second,
+	Multiplier:      2,
+}
+
+// next returns the interval to wait after current.
+func (o PollOptions) next(current time.Duration) time.Duration {
+	next := time.Duration(float64(current) * o.Multiplier)
+	if next > o.MaxInterval {
+		next = o.MaxInterval
+	}
+	if next <= 0 {
+		next = o.InitialInterval
+	}
+	return next
+}
+
+// runTerminal reports whether a run in status will never change again.
+func runTerminal(status string) bool {
+	switch status {
+	case RunStatusCancelled, RunStatusFailed, RunStatusCompleted, RunStatusIncomplete, RunStatusExpired:
+		return true
+	}
+	return false
+}
+
+// runOutcome turns a finished (or stuck) run into an error, or nil if it completed.
+func runOutcome(run *PollRunResponse) error {
+	switch run.Status {
+	case RunStatusCompleted:
+		return nil
+	case RunStatusFailed, RunStatusCancelled, RunStatusExpired, RunStatusIncomplete, RunStatusRequiresAction:
+		return &RunError{
+			RunID:             run.ID,
+			Status:            run.Status,
+			LastError:         run.LastError,
+			IncompleteDetails: run.IncompleteDetails,
+		}
+	}
+	return fmt.Errorf("run %s has unexpected status %q", run.ID, run.Status)
+}
@@ -0,0 +1,212 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRunOutcome(t *testing.T) {
+	tests := []struct {
+		name   string
+		run    PollRunResponse
+		want   string // Error message, empty for nil
+		runErr bool   // Whether it is a *RunError
+	}{
+		{name: "completed", run: PollRunResponse{ID: "run_1", Status: RunStatusCompleted}},
+		{
+			name:   "failed with its last error",
+			run:    PollRunResponse{ID: "run_1", Status: RunStatusFailed, LastError: &RunLastError{Code: "server_error", Message: "boom"}},
+			want:   "run run_1 failed: server_error: boom",
+			runErr: true,
+		},
+		{
+			name:   "incomplete with its reason",
+			run:    PollRunResponse{ID: "run_1", Status: RunStatusIncomplete, IncompleteDetails: &RunIncompleteDetails{Reason: "max_completion_tokens"}},
+			want:   "run run_1 incomplete: max_completion_tokens",
+			runErr: true,
+		},
+		{name: "cancelled", run: PollRunResponse{ID: "run_1", Status: RunStatusCancelled}, want: "run run_1 cancelled", runErr: true},
+		{name: "expired", run: PollRunResponse{ID: "run_1", Status: RunStatusExpired}, want: "run run_1 expired", runErr: true},
+		{name: "stuck on an action", run: PollRunResponse{ID: "run_1", Status: RunStatusRequiresAction}, want: "run run_1 requires_action", runErr: true},
+		{name: "unknown status", run: PollRunResponse{ID: "run_1", Status: "paused"}, want: `run run_1 has unexpected status "paused"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runOutcome(&tt.run)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("runOutcome() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("runOutcome() = %v, want %q", err, tt.want)
+			}
+			var runErr *RunError
+			if errors.As(err, &runErr) != tt.runErr {
+				t.Errorf("runOutcome() is a *RunError = %v, want %v", !tt.runErr, tt.runErr)
+			}
+		})
+	}
+}
+
+func TestRunTerminal(t *testing.T) {
+	for status, want := range map[string]bool{
+		RunStatusQueued: false, RunStatusInProgress: false, RunStatusRequiresAction: false, RunStatusCancelling: false,
+		RunStatusCancelled: true, RunStatusFailed: true, RunStatusCompleted: true, RunStatusIncomplete: true, RunStatusExpired: true,
+	} {
+		if got := runTerminal(status); got != want {
+			t.Errorf("runTerminal(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestPollOptionsNext(t *testing.T) {
+	options := PollOptions{InitialInterval: 500 * time.Millisecond, MaxInterval: 5 * time.Second, Multiplier: 2}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	interval := options.InitialInterval
+	for i, w := range want {
+		interval = options.next(interval)
+		if interval != w {
+			t.Errorf("interval %d = %s, want %s", i+1, interval, w)
+		}
+	}
+	if got := (PollOptions{InitialInterval: time.Second, MaxInterval: time.Minute}).next(time.Second); got != time.Second {
+		t.Errorf("next() without a multiplier = %s, want the initial interval", got)
+	}
+}
+
+func TestPollThreadForReply(t *testing.T) {
+	requiresAction := `{"id": "run_1", "status": "requires_action", "required_action": {"type": "submit_tool_outputs",
+		"submit_tool_outputs": {"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "unknown_tool", "arguments": "{}"}}]}}}`
+
+	tests := []struct {
+		name      string
+		status    int      // Status of poll responses
+		failures  int      // Polls answered with a 503 first
+		runs      []string // Poll response bodies in turn
+		timeout   time.Duration
+		want      string
+		wantErr   func(error) bool
+		cancelled bool // Whether the run should have been cancelled
+	}{
+		{
+			name: "completes after queueing",
+			runs: []string{`{"id": "run_1", "status": "queued"}`, `{"id": "run_1", "status": "in_progress"}`, `{"id": "run_1", "status": "completed"}`},
+			want: "Blue Widget x5",
+		},
+		{
+			name:    "failed",
+			runs:    []string{`{"id": "run_1", "status": "failed", "last_error": {"code": "rate_limit_exceeded", "message": "slow down"}}`},
+			wantErr: isRunError(RunStatusFailed),
+		},
+		{
+			name:    "expired",
+			runs:    []string{`{"id": "run_1", "status": "expired"}`},
+			wantErr: isRunError(RunStatusExpired),
+		},
+		{
+			name:      "requires an action nothing can handle",
+			runs:      []string{requiresAction},
+			wantErr:   isRunError(RunStatusRequiresAction),
+			cancelled: true,
+		},
+		{
+			name:      "never finishes",
+			runs:      []string{`{"id": "run_1", "status": "in_progress"}`},
+			timeout:   30 * time.Millisecond,
+			wantErr:   func(err error) bool { return errors.Is(err, ErrRunTimeout) },
+			cancelled: true,
+		},
+		{
+			name:     "server errors while polling are retried",
+			failures: 3,
+			runs:     []string{`{"id": "run_1", "status": "completed"}`},
+			want:     "Blue Widget x5",
+		},
+		{
+			name:   "a run that can't be polled is cancelled",
+			status: http.StatusNotFound,
+			runs:   []string{`{"error": {"message": "No run found with id 'run_1'."}}`},
+			wantErr: func(err error) bool {
+				var apiErr *APIError
+				return errors.As(err, &apiErr) && apiErr.IsNotFound()
+			},
+			cancelled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOpenAI(t)
+			f.fakeRun()
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			f.reply(testRunRoute, status, tt.runs...)
+			if tt.failures > 0 {
+				polls := f.handlers[testRunRoute]
+				failures := 0
+				f.handle(testRunRoute, func(w http.ResponseWriter, r *http.Request) {
+					if failures < tt.failures {
+						failures++
+						http.Error(w, `{"error": {"message": "overloaded"}}`, http.StatusServiceUnavailable)
+						return
+					}
+					polls(w, r)
+				})
+			}
+
+			a := f.assistant(PollRuns)
+			if tt.timeout > 0 {
+				options := testPollOptions
+				options.Timeout = tt.timeout
+				a.SetPollOptions(options)
+			}
+			a.runID = "run_1"
+
+			got, err := a.pollThreadForReply(context.Background())
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("pollThreadForReply() error = %v", err)
+			case tt.wantErr != nil && !tt.wantErr(err):
+				t.Fatalf("pollThreadForReply() error = %v, not the one expected", err)
+			}
+			if got != tt.want {
+				t.Errorf("pollThreadForReply() = %q, want %q", got, tt.want)
+			}
+			if cancelled := len(f.received(testCancelRoute)) > 0; cancelled != tt.cancelled {
+				t.Errorf("run cancelled = %v, want %v", cancelled, tt.cancelled)
+			}
+		})
+	}
+}
+
+func isRunError(status string) func(error) bool {
+	return func(err error) bool {
+		var runErr *RunError
+		return errors.As(err, &runErr) && runErr.Status == status && runErr.RunID == "run_1"
+	}
+}
+
+func TestPollThreadForReplyBacksOff(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.fakeRun("in_progress", "in_progress", "in_progress", "in_progress", "completed")
+	a := f.assistant(PollRuns)
+	a.SetPollOptions(PollOptions{Timeout: time.Second, InitialInterval: 10 * time.Millisecond, MaxInterval: 40 * time.Millisecond, Multiplier: 2})
+	a.runID = "run_1"
+
+	started := time.Now()
+	if _, err := a.pollThreadForReply(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Waits of 10, 20, 40 and 40ms between the five polls.
+	if elapsed := time.Since(started); elapsed < 110*time.Millisecond {
+		t.Errorf("polled five times in %s, want at least 110ms of backoff", elapsed)
+	}
+}
@@ -0,0 +1,87 @@
+package inbound
+
+// RunOption overrides the assistant's stored settings for a single run.
+type RunOption func(*RunThreadPayload)
+
+type TruncationStrategy struct {
+	Type         string `json:"type"`                    // "auto" or "last_messages"
+	LastMessages int    `json:"last_messages,omitempty"` // For "last_messages"
+}
+
+// ToolChoiceFunction forces the run to call the named function tool.
+func ToolChoiceFunction(name string) interface{} {
+	return map[string]interface{}{"type": "function", "function": map[string]string{"name": name}}
+}
+
+// WithModel runs a different model (or Azure deployment) than the assistant's.
+func WithModel(model string) RunOption {
+	return func(p *RunThreadPayload) {
+		p.Model = model
+	}
+}
+
+// WithRunInstructions replaces the instructions for this run, taking precedence over
+// SetInstructions.
+func WithRunInstructions(instructions string) RunOption {
+	return func(p *RunThreadPayload) {
+		p.Instructions = instructions
+	}
+}
+
+// WithAdditionalInstructions appends to the instructions for this run, e.g. with context about
+// the customer such as their account tier, region or past orders.
+func WithAdditionalInstructions(instructions string) RunOption {
+	return func(p *RunThreadPayload) {
+		p.AdditionalInstructions = instructions
+	}
+}
+
+func WithTemperature(temperature float64) RunOption {
+	return func(p *RunThreadPayload) {
+		p.Temperature = &temperature
+	}
+}
+
+func WithTopP(topP float64) RunOption {
+	return func(p *RunThreadPayload) {
+		p.TopP = &topP
+	}
+}
+
+// WithMaxPromptTokens caps the prompt tokens used across the run. A run that needs more ends
+// incomplete.
+func WithMaxPromptTokens(tokens int) RunOption {
+	return func(p *RunThreadPayload) {
+		p.MaxPromptTokens = tokens
+	}
+}
+
+// WithMaxCompletionTokens caps the completion tokens used across the run. A run that needs more
+// ends incomplete.
+func WithMaxCompletionTokens(tokens int) RunOption {
+	return func(p *RunThreadPayload) {
+		p.MaxCompletionTokens = tokens
+	}
+}
+
+// WithTruncation limits how much of the thread is sent to the model, e.g.
+// TruncationStrategy{Type: "last_messages", LastMessages: 5}.
+func WithTruncation(strategy TruncationStrategy) RunOption {
+	return func(p *RunThreadPayload) {
+		p.TruncationStrategy = &strategy
+	}
+}
+
+// WithToolChoice is "none", "auto", "required" or a ToolChoiceFunction.
+func WithToolChoice(choice interface{}) RunOption {
+	return func(p *RunThreadPayload) {
+		p.ToolChoice = choice
+	}
+}
+
+// WithRunMetadata tags the run, e.g. with the email it is answering.
+func WithRunMetadata(metadata map[string]string) RunOption {
+	return func(p *RunThreadPayload) {
+		p.Metadata = metadata
+	}
+}
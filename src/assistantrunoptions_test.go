@@ -0,0 +1,106 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRunOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		instructions string // Set with SetInstructions
+		options      []RunOption
+		want         string // Run request body, less assistant_id
+	}{
+		{name: "no options", want: `{}`},
+		{
+			name:         "stored instructions",
+			instructions: "Pick widgets.",
+			want:         `{"instructions": "Pick widgets."}`,
+		},
+		{
+			name:         "run instructions take precedence",
+			instructions: "Pick widgets.",
+			options:      []RunOption{WithRunInstructions("Pick spades."), WithAdditionalInstructions("Trade account.")},
+			want:         `{"instructions": "Pick spades.", "additional_instructions": "Trade account."}`,
+		},
+		{
+			name:    "sampling",
+			options: []RunOption{WithModel("gpt-4o"), WithTemperature(0), WithTopP(0.5)},
+			want:    `{"model": "gpt-4o", "temperature": 0, "top_p": 0.5}`,
+		},
+		{
+			name: "limits",
+			options: []RunOption{
+				WithMaxPromptTokens(2000), WithMaxCompletionTokens(300),
+				WithTruncation(TruncationStrategy{Type: "last_messages", LastMessages: 5}),
+			},
+			want: `{"max_prompt_tokens": 2000, "max_completion_tokens": 300, "truncation_strategy": {"type": "last_messages", "last_messages": 5}}`,
+		},
+		{
+			name:    "tool choice and metadata",
+			options: []RunOption{WithToolChoice(ToolChoiceFunction("lookup_product")), WithRunMetadata(map[string]string{"ses_message_id": "ses-1"})},
+			want:    `{"tool_choice": {"type": "function", "function": {"name": "lookup_product"}}, "metadata": {"ses_message_id": "ses-1"}}`,
+		},
+		{
+			name:    "later options win",
+			options: []RunOption{WithToolChoice("required"), WithToolChoice("none")},
+			want:    `{"tool_choice": "none"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOpenAI(t)
+			f.fakeRun("completed")
+			a := f.assistant(PollRuns)
+			a.SetInstructions(tt.instructions)
+			if _, err := a.AddMessageToThreadContext(context.Background(), "hello", tt.options...); err != nil {
+				t.Fatal(err)
+			}
+
+			var got, want map[string]interface{}
+			if err := json.Unmarshal([]byte(f.received("POST /v1/threads/thread_1/runs")[0].Body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got["assistant_id"] != "asst_1" {
+				t.Errorf("assistant_id = %v", got["assistant_id"])
+			}
+			delete(got, "assistant_id")
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("run body = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRouteRunOptions(t *testing.T) {
+	temperature := 0.3
+	route := &Route{Name: "trade", Model: "gpt-4o", AdditionalInstructions: "Trade accounts only.", Temperature: &temperature}
+
+	var payload RunThreadPayload
+	for _, option := range runOptions(route, "ses-1") {
+		option(&payload)
+	}
+	want := RunThreadPayload{
+		Model:                  "gpt-4o",
+		AdditionalInstructions: "Trade accounts only.",
+		Temperature:            &temperature,
+		Metadata:               map[string]string{"ses_message_id": "ses-1", "route": "trade"},
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("runOptions() payload = %+v, want %+v", payload, want)
+	}
+
+	payload = RunThreadPayload{}
+	for _, option := range runOptions(&Route{Name: "default"}, "ses-2") {
+		option(&payload)
+	}
+	if payload.Model != "" || payload.Temperature != nil || payload.AdditionalInstructions != "" || payload.Metadata["route"] != "default" {
+		t.Errorf("runOptions() for a plain route = %+v, want only metadata", payload)
+	}
+}
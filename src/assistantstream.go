@@ -0,0 +1,302 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Events of a streamed run. Every thread.run.* event carries the run as it stands and every
+// thread.message.* event other than deltas carries the message.
+const (
+	StreamEventRunCreated        string = "thread.run.created"
+	StreamEventRunRequiresAction string = "thread.run.requires_action" // The run is waiting on tool calls
+	StreamEventRunCompleted      string = "thread.run.completed"
+	StreamEventMessageDelta      string = "thread.message.delta"
+	StreamEventMessageCompleted  string = "thread.message.completed"
+	StreamEventError             string = "error"
+	StreamEventDone              string = "done"
+)
+
+// errStreamUnavailable means a run couldn't be streamed to the end, so its reply must be polled for.
+var errStreamUnavailable = errors.New("run stream unavailable")
+
+// StreamEvent is one server-sent event from a streamed run. Run, Message, Delta or Err is set
+// depending on Type; run step events only have Data.
+type StreamEvent struct {
+	Type    string
+	Data    json.RawMessage
+	Run     *PollRunResponse
+	Message *Message
+	Delta   *MessageDelta
+	Err     *APIError
+}
+
+// StreamHandler receives each event of a streamed run as it arrives.
+type StreamHandler func(event *StreamEvent)
+
+type MessageDelta struct {
+	ID     string `json:"id"`
+	Object string `json:"object"`
+	Delta  struct {
+		Content []MessageDeltaContent `json:"content"`
+	} `json:"delta"`
+}
+
+type MessageDeltaContent struct {
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+	Text  *Text  `json:"text"`
+}
+
+// Text returns the text the delta adds to the message.
+func (d *MessageDelta) Text() string {
+	var b strings.Builder
+	for _, content := range d.Delta.Content {
+		if content.Text != nil {
+			b.WriteString(content.Text.Value)
+		}
+	}
+	return b.String()
+}
+
+// streamThreadForReply starts a streamed run by POSTing payload to url and follows it to the end,
+// answering registered tool calls along the way, like pollThreadForReply. It returns
+// errStreamUnavailable (wrapped) when the run should be polled for instead; a.runID is set if the
+// run was started.
+func (a *Assistant) streamThreadForReply(ctx context.Context, url string, payload interface{}, onEvent StreamHandler) (string, error) {
+	options := a.pollOptions
+	streamCtx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		a.logError(fmt.Sprintf("Failed to marshal run thread payload: %v", err))
+		return "", fmt.Errorf("failed to marshal run thread payload: %w", err)
+	}
+
+	var messages []Message
+	body, err := a.openRunStream(streamCtx, url, jsonPayload)
+	for {
+		var run *PollRunResponse
+		if err == nil {
+			var completed []Message
+			run, completed, err = a.readRunStream(body, onEvent)
+			messages = append(messages, completed...)
+			body.Close()
+		}
+
+		if streamCtx.Err() != nil {
+			a.stopRun()
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", fmt.Errorf("%w %s after %s", ErrRunTimeout, a.runID, options.Timeout)
+		}
+		if err != nil {
+			if !errors.Is(err, errStreamUnavailable) {
+				a.stopRun()
+			}
+			return "", err
+		}
+
+		a.recordUsage(run)
+		switch {
+		case run.Status == RunStatusCompleted:
+			if len(messages) == 0 {
+				return a.GetLastMessageContext(ctx)
+			}
+			a.lastReply = a.buildReply(ctx, messages)
+			return replyText(a.lastReply)
+		case run.Status == RunStatusRequiresAction && a.canHandle(run.RequiredAction):
+			outputs := a.callTools(streamCtx, run.RequiredAction.SubmitToolOutputs.ToolCalls)
+			jsonPayload, err = json.Marshal(SubmitToolOutputsPayload{ToolOutputs: outputs, Stream: true})
+			if err != nil {
+				a.logError(fmt.Sprintf("Failed to marshal tool outputs payload: %v", err))
+				a.stopRun()
+				return "", fmt.Errorf("failed to marshal tool outputs payload: %w", err)
+			}
+			body, err = a.openRunStream(streamCtx, a.endpoint("/threads/%s/runs/%s/submit_tool_outputs", a.threadID, a.runID), jsonPayload)
+		case run.Status == RunStatusRequiresAction:
+			// Nothing here can satisfy the action, so waiting would only run out the clock.
+			a.stopRun()
+			return "", runOutcome(run)
+		default:
+			a.logError(fmt.Sprintf("OpenAI run ended with status: %s", run.Status))
+			return "", runOutcome(run)
+		}
+	}
+}
+
+// openRunStream POSTs a streaming run request and returns the event stream. A server that
+// answers with the run as plain JSON instead (some compatible servers ignore stream) has still
+// started it, so its ID is kept and errStreamUnavailable returned.
+func (a *Assistant) openRunStream(ctx context.Context, url string, jsonPayload []byte) (io.ReadCloser, error) {
+	resp, err := a.stream(ctx, url, jsonPayload)
+	if err != nil {
+		a.logError(fmt.Sprintf("Error sending request to stream run: %v", err))
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(resp)
+		a.logError(fmt.Sprintf("Stream run failed: %v", apiErr))
+		if apiErr.Param == "stream" {
+			return nil, fmt.Errorf("%w: %w", errStreamUnavailable, apiErr)
+		}
+		return nil, fmt.Errorf("failed to stream run: %w", apiErr)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		return resp.Stream, nil
+	}
+	defer resp.Stream.Close()
+
+	var runResp RunThreadResponse
+	if err := json.NewDecoder(resp.Stream).Decode(&runResp); err != nil || runResp.ID == "" {
+		a.logError(fmt.Sprintf("Unexpected %s response to stream run: %v", contentType, err))
+		return nil, fmt.Errorf("unexpected %s response to stream run", contentType)
+	}
+	a.setRun(runResp.ID, runResp.ThreadID)
+	return nil, fmt.Errorf("%w: server replied with %s", errStreamUnavailable, contentType)
+}
+
+// readRunStream passes each event to onEvent until the stream ends, returning the run's final
+// state and the assistant messages completed along the way. A stream that breaks, reports an
+// error or ends before the run stops gives errStreamUnavailable.
+func (a *Assistant) readRunStream(body io.Reader, onEvent StreamHandler) (*PollRunResponse, []Message, error) {
+	var run *PollRunResponse
+	var messages []Message
+	err := readSSE(body, func(e sseEvent) error {
+		event, err := decodeStreamEvent(e)
+		if err != nil {
+			return err
+		}
+		if event.Run != nil {
+			run = event.Run
+			a.setRun(run.ID, run.ThreadID)
+		}
+		if event.Type == StreamEventMessageCompleted && event.Message.Role == "assistant" {
+			messages = append(messages, *event.Message)
+		}
+		if onEvent != nil {
+			onEvent(event)
+		}
+		if event.Err != nil {
+			return event.Err
+		}
+		return nil
+	})
+	if err != nil {
+		a.logError(fmt.Sprintf("Run stream failed: %v", err))
+		return nil, nil, fmt.Errorf("%w: %w", errStreamUnavailable, err)
+	}
+	if run == nil || !(runTerminal(run.Status) || run.Status == RunStatusRequiresAction) {
+		return nil, nil, fmt.Errorf("%w: stream ended before the run stopped", errStreamUnavailable)
+	}
+	return run, messages, nil
+}
+
+func decodeStreamEvent(e sseEvent) (*StreamEvent, error) {
+	event := &StreamEvent{Type: e.event}
+	if e.event == StreamEventDone {
+		return event, nil // Its data is just [DONE]
+	}
+	event.Data = json.RawMessage(e.data)
+
+	var target interface{}
+	switch {
+	case e.event == StreamEventError:
+		event.Err = streamError(e.data)
+		return event, nil
+	case e.event == StreamEventMessageDelta:
+		event.Delta = &MessageDelta{}
+		target = event.Delta
+	case strings.HasPrefix(e.event, "thread.run.step."):
+		return event, nil
+	case strings.HasPrefix(e.event, "thread.run."):
+		event.Run = &PollRunResponse{}
+		target = event.Run
+	case strings.HasPrefix(e.event, "thread.message."):
+		event.Message = &Message{}
+		target = event.Message
+	default:
+		return event, nil
+	}
+
+	if err := json.Unmarshal(event.Data, target); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s event: %w", e.event, err)
+	}
+	return event, nil
+}
+
+// streamError reads an error event, whose data is an error object with or without the usual
+// {"error": ...} wrapper.
+func streamError(data string) *APIError {
+	var body OpenAIErrorResponse
+	if err := json.Unmarshal([]byte(data), &body); err != nil || body.Error.Message == "" {
+		json.Unmarshal([]byte(data), &body.Error)
+	}
+	apiErr := &APIError{
+		Type:    body.Error.Type,
+		Code:    body.Error.Code,
+		Param:   body.Error.Param,
+		Message: body.Error.Message,
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(data)
+	}
+	return apiErr
+}
+
+// sseEvent is one event of a text/event-stream body.
+type sseEvent struct {
+	event string
+	data  string
+}
+
+// readSSE calls fn for each event in a text/event-stream body until the body ends or fn fails.
+// An event cut off by the end of the body is dropped.
+func readSSE(r io.Reader, fn func(sseEvent) error) error {
+	reader := bufio.NewReader(r)
+	var event sseEvent
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if event.event != "" || len(data) > 0 {
+				event.data = strings.Join(data, "\n")
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			event, data = sseEvent{}, nil
+		case strings.HasPrefix(line, ":"):
+			// Comment, sent as a keep-alive
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				event.event = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadSSE(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []sseEvent
+	}{
+		{
+			name: "single event",
+			body: "event: thread.run.created\ndata: {\"id\":\"run_1\"}\n\n",
+			want: []sseEvent{{event: "thread.run.created", data: `{"id":"run_1"}`}},
+		},
+		{
+			name: "multi-line data is joined with newlines",
+			body: "event: thread.message.delta\ndata: {\"a\":\ndata: 1}\n\n",
+			want: []sseEvent{{event: "thread.message.delta", data: "{\"a\":\n1}"}},
+		},
+		{
+			name: "comments are skipped",
+			body: ": keep-alive\n\nevent: done\n: still here\ndata: [DONE]\n\n",
+			want: []sseEvent{{event: "done", data: "[DONE]"}},
+		},
+		{
+			name: "missing trailing blank line drops the cut off event",
+			body: "event: thread.run.created\ndata: {}\n\nevent: thread.run.completed\ndata: {}\n",
+			want: []sseEvent{{event: "thread.run.created", data: "{}"}},
+		},
+		{
+			name: "missing final newline",
+			body: "event: thread.run.created\ndata: {}\n\nevent: done\ndata: [DONE]",
+			want: []sseEvent{{event: "thread.run.created", data: "{}"}},
+		},
+		{
+			name: "CRLF line endings",
+			body: "event: done\r\ndata: [DONE]\r\n\r\n",
+			want: []sseEvent{{event: "done", data: "[DONE]"}},
+		},
+		{
+			name: "no space after the colon",
+			body: "event:error\ndata:{\"message\":\"boom\"}\n\n",
+			want: []sseEvent{{event: "error", data: `{"message":"boom"}`}},
+		},
+		{
+			name: "only the first space of a value is stripped",
+			body: "data:  indented\n\n",
+			want: []sseEvent{{data: " indented"}},
+		},
+		{
+			name: "data without an event name",
+			body: "data: {}\n\n",
+			want: []sseEvent{{data: "{}"}},
+		},
+		{
+			name: "id, retry and unknown fields are ignored",
+			body: "id: 7\nretry: 1000\nevent: done\nfoo: bar\ndata: [DONE]\n\n",
+			want: []sseEvent{{event: "done", data: "[DONE]"}},
+		},
+		{
+			name: "repeated blank lines between events",
+			body: "event: a\ndata: 1\n\n\n\nevent: b\ndata: 2\n\n",
+			want: []sseEvent{{event: "a", data: "1"}, {event: "b", data: "2"}},
+		},
+		{
+			name: "empty body",
+			body: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []sseEvent
+			err := readSSE(strings.NewReader(tt.body), func(event sseEvent) error {
+				got = append(got, event)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("readSSE() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readSSE() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSSEErrors(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := readSSE(strings.NewReader("data: 1\n\ndata: 2\n\n"), func(sseEvent) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("readSSE() with failing handler = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+
+	broken := errors.New("connection reset")
+	err = readSSE(io.MultiReader(strings.NewReader("data: 1\n"), iotest.ErrReader(broken)), func(sseEvent) error {
+		t.Error("handler called for an event cut off by a read error")
+		return nil
+	})
+	if !errors.Is(err, broken) {
+		t.Errorf("readSSE() with failing reader = %v, want %v", err, broken)
+	}
+}
+
+// sse writes events, given as name and one-line data pairs, as a text/event-stream body.
+func sse(events ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i+1 < len(events); i += 2 {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", events[i], events[i+1])
+		}
+	}
+}
+
+func TestAddMessageToThreadStream(t *testing.T) {
+	const (
+		runs    = "POST /v1/threads/thread_1/runs"
+		outputs = "POST /v1/threads/thread_1/runs/run_1/submit_tool_outputs"
+		created = `{"id": "run_1", "thread_id": "thread_1", "status": "queued"}`
+		done    = `{"id": "run_1", "thread_id": "thread_1", "status": "completed", "model": "gpt-4o", "usage": {"total_tokens": 15}}`
+		message = `{"id": "msg_2", "role": "assistant", "run_id": "run_1", "content": [{"type": "text", "text": {"value": "Red Widget x2"}}]}`
+		delta   = `{"id": "msg_2", "delta": {"content": [{"index": 0, "type": "text", "text": {"value": "Red "}}]}}`
+		action  = `{"id": "run_1", "thread_id": "thread_1", "status": "requires_action", "required_action": {"type": "submit_tool_outputs", "submit_tool_outputs": {"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup_product", "arguments": "{}"}}]}}}`
+	)
+
+	tests := []struct {
+		name    string
+		run     http.HandlerFunc
+		outputs http.HandlerFunc
+		want    string
+		events  []string // Types seen by the handler
+		polled  bool
+	}{
+		{
+			name:   "streamed to the end",
+			run:    sse(StreamEventRunCreated, created, StreamEventMessageDelta, delta, StreamEventMessageCompleted, message, StreamEventRunCompleted, done, StreamEventDone, "[DONE]"),
+			want:   "Red Widget x2",
+			events: []string{StreamEventRunCreated, StreamEventMessageDelta, StreamEventMessageCompleted, StreamEventRunCompleted, StreamEventDone},
+		},
+		{
+			name:    "tool calls continue the stream",
+			run:     sse(StreamEventRunCreated, created, StreamEventRunRequiresAction, action),
+			outputs: sse(StreamEventMessageCompleted, message, StreamEventRunCompleted, done, StreamEventDone, "[DONE]"),
+			want:    "Red Widget x2",
+			events:  []string{StreamEventRunCreated, StreamEventRunRequiresAction, StreamEventMessageCompleted, StreamEventRunCompleted, StreamEventDone},
+		},
+		{
+			name:   "completed without messages fetches the reply",
+			run:    sse(StreamEventRunCreated, created, StreamEventRunCompleted, done),
+			want:   "Blue Widget x5",
+			events: []string{StreamEventRunCreated, StreamEventRunCompleted},
+		},
+		{
+			name: "a server that ignores stream is polled",
+			run: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, created)
+			},
+			want:   "Blue Widget x5",
+			polled: true,
+		},
+		{
+			name:   "a stream that breaks is polled",
+			run:    sse(StreamEventRunCreated, created, StreamEventMessageDelta, delta),
+			want:   "Blue Widget x5",
+			events: []string{StreamEventRunCreated, StreamEventMessageDelta},
+			polled: true,
+		},
+		{
+			name:   "an error event is polled",
+			run:    sse(StreamEventRunCreated, created, StreamEventError, `{"message": "stream interrupted", "type": "server_error"}`),
+			want:   "Blue Widget x5",
+			events: []string{StreamEventRunCreated, StreamEventError},
+			polled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOpenAI(t)
+			f.fakeRun("completed")
+			f.handle(runs, tt.run)
+			if tt.outputs != nil {
+				f.handle(outputs, tt.outputs)
+			}
+			a := f.assistant(0)
+			a.RegisterDeclaredTool("lookup_product", "", nil, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+				return `{"products": []}`, nil
+			})
+
+			var events []string
+			reply, err := a.AddMessageToThreadStream(context.Background(), "2 red widgets", func(event *StreamEvent) {
+				events = append(events, event.Type)
+			})
+			if err != nil || reply != tt.want {
+				t.Fatalf("AddMessageToThreadStream() = %q, %v; want %q", reply, err, tt.want)
+			}
+			if !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("events = %q, want %q", events, tt.events)
+			}
+			if polled := len(f.received(testRunRoute)) > 0; polled != tt.polled {
+				t.Errorf("polled = %v, want %v", polled, tt.polled)
+			}
+			requests := f.received(runs)
+			if len(requests) != 1 || !strings.Contains(requests[0].Body, `"stream":true`) {
+				t.Errorf("run requests = %+v, want one streamed run", requests)
+			}
+			if tt.outputs != nil && len(f.received(outputs)) != 1 {
+				t.Errorf("tool outputs submitted %d times, want once", len(f.received(outputs)))
+			}
+		})
+	}
+}
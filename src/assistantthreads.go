@@ -0,0 +1,217 @@
+package inbound
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Thread is an Assistants thread.
+type Thread = CreateThreadResponse
+
+type CreateThreadPayload struct {
+	Messages []AddMessagePayload `json:"messages,omitempty"`
+	Metadata map[string]string   `json:"metadata,omitempty"`
+}
+
+type CreateThreadAndRunPayload struct {
+	RunThreadPayload
+	Thread CreateThreadPayload `json:"thread"`
+}
+
+type metadataPayload struct {
+	Metadata map[string]string `json:"metadata"`
+}
+
+type deleteResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+// CreateThread creates a thread, optionally holding messages and tagged with metadata (up to 16
+// keys), and makes it the Assistant's current thread.
+func (a *Assistant) CreateThread(ctx context.Context, messages []AddMessagePayload, metadata map[string]string) (*Thread, error) {
+	var thread Thread
+	payload := CreateThreadPayload{Messages: messages, Metadata: metadata}
+	if err := a.callJSON(ctx, "POST", a.endpoint("/threads"), payload, &thread, false, "create thread"); err != nil {
+		return nil, err
+	}
+
+	a.threadID = thread.ID
+	return &thread, nil
+}
+
+// CreateThreadAndRun creates a thread holding messages and runs the assistant on it in one call,
+// returning the reply like AddMessageToThreadContext. The new thread becomes current.
+func (a *Assistant) CreateThreadAndRun(ctx context.Context, messages []AddMessagePayload, metadata map[string]string, options ...RunOption) (string, error) {
+	thread := &CreateThreadPayload{Messages: messages, Metadata: metadata}
+	return a.runForReply(ctx, a.endpoint("/threads/runs"), thread, nil, options)
+}
+
+func (a *Assistant) GetThread(ctx context.Context, threadID string) (*Thread, error) {
+	var thread Thread
+	if err := a.callJSON(ctx, "GET", a.endpoint("/threads/%s", threadID), nil, &thread, true, "get thread"); err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// UpdateThreadMetadata replaces a thread's metadata.
+func (a *Assistant) UpdateThreadMetadata(ctx context.Context, threadID string, metadata map[string]string) (*Thread, error) {
+	var thread Thread
+	payload := metadataPayload{Metadata: metadata}
+	if err := a.callJSON(ctx, "POST", a.endpoint("/threads/%s", threadID), payload, &thread, true, "update thread"); err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// DeleteThread deletes a thread and its messages. OpenAI has no way to list threads, so keep the
+// IDs of any that need cleaning up later; the pipeline logs them with the SES message ID.
+func (a *Assistant) DeleteThread(ctx context.Context, threadID string) error {
+	var deleted deleteResponse
+	if err := a.callJSON(ctx, "DELETE", a.endpoint("/threads/%s", threadID), nil, &deleted, true, "delete thread"); err != nil {
+		return err
+	}
+	if !deleted.Deleted {
+		return fmt.Errorf("thread %s was not deleted", threadID)
+	}
+
+	if threadID == a.threadID {
+		a.threadID, a.runID = "", ""
+	}
+	return nil
+}
+
+// CreateMessage adds a message to the current thread without running the assistant.
+func (a *Assistant) CreateMessage(ctx context.Context, message AddMessagePayload) (*Message, error) {
+	if a.threadID == "" {
+		return nil, fmt.Errorf("thread not initialized. Call NewAssistant or ResetThread first")
+	}
+
+	var created Message
+	if err := a.callJSON(ctx, "POST", a.endpoint("/threads/%s/messages", a.threadID), message, &created, false, "add message"); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetMessage fetches a message from the current thread.
+func (a *Assistant) GetMessage(ctx context.Context, messageID string) (*Message, error) {
+	var message Message
+	if err := a.callJSON(ctx, "GET", a.endpoint("/threads/%s/messages/%s", a.threadID, messageID), nil, &message, true, "get message"); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// UpdateMessageMetadata replaces the metadata of a message in the current thread.
+func (a *Assistant) UpdateMessageMetadata(ctx context.Context, messageID string, metadata map[string]string) (*Message, error) {
+	var message Message
+	payload := metadataPayload{Metadata: metadata}
+	if err := a.callJSON(ctx, "POST", a.endpoint("/threads/%s/messages/%s", a.threadID, messageID), payload, &message, true, "update message"); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// DeleteMessage deletes a message from the current thread.
+func (a *Assistant) DeleteMessage(ctx context.Context, messageID string) error {
+	var deleted deleteResponse
+	if err := a.callJSON(ctx, "DELETE", a.endpoint("/threads/%s/messages/%s", a.threadID, messageID), nil, &deleted, true, "delete message"); err != nil {
+		return err
+	}
+	if !deleted.Deleted {
+		return fmt.Errorf("message %s was not deleted", messageID)
+	}
+	return nil
+}
+
+// ListMessagesOptions filters and orders a listing of the current thread's messages.
+type ListMessagesOptions struct {
+	Limit  int    // Per page, 1 to 100; OpenAI defaults to 20
+	Order  string // "asc" or "desc" (default) by creation time
+	After  string // Message ID to list after
+	Before string // Message ID to list before
+	RunID  string // Only messages created by this run
+}
+
+func (o ListMessagesOptions) query() url.Values {
+	query := url.Values{}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	for key, value := range map[string]string{"order": o.Order, "after": o.After, "before": o.Before, "run_id": o.RunID} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	return query
+}
+
+// ListMessages fetches one page of the current thread's messages. Use Messages to go through
+// them all.
+func (a *Assistant) ListMessages(ctx context.Context, options ListMessagesOptions) (*ListMessagesResponse, error) {
+	requestURL := withQuery(a.endpoint("/threads/%s/messages", a.threadID), options.query())
+
+	var page ListMessagesResponse
+	if err := a.callJSON(ctx, "GET", requestURL, nil, &page, true, "list messages"); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// MessageIterator pages through the current thread's messages:
+//
+//	it := assistant.Messages(ctx, ListMessagesOptions{Order: "asc"})
+//	for it.Next() {
+//		message := it.Message()
+//	}
+//	if err := it.Err(); err != nil {
+type MessageIterator struct {
+	ctx       context.Context
+	assistant *Assistant
+	options   ListMessagesOptions
+
+	page    []Message
+	index   int
+	message *Message
+	done    bool
+	err     error
+}
+
+// Messages returns an iterator over the current thread's messages, fetching pages as needed.
+func (a *Assistant) Messages(ctx context.Context, options ListMessagesOptions) *MessageIterator {
+	return &MessageIterator{ctx: ctx, assistant: a, options: options}
+}
+
+// Next moves to the next message, returning false at the end or on an error.
+func (it *MessageIterator) Next() bool {
+	for it.index >= len(it.page) {
+		if it.done || it.err != nil {
+			return false
+		}
+		page, err := it.assistant.ListMessages(it.ctx, it.options)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.index = page.Data, 0
+		it.done = !page.HasMore || page.LastID == ""
+		it.options.After = page.LastID
+	}
+
+	it.message = &it.page[it.index]
+	it.index++
+	return true
+}
+
+func (it *MessageIterator) Message() *Message {
+	return it.message
+}
+
+func (it *MessageIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,153 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestThreadsAndMessages(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.reply("POST /v1/threads", http.StatusOK, `{"id": "thread_1", "metadata": {"ses_message_id": "ses-1"}}`)
+	f.reply("GET /v1/threads/thread_1", http.StatusOK, `{"id": "thread_1"}`)
+	f.reply("POST /v1/threads/thread_1", http.StatusOK, `{"id": "thread_1", "metadata": {"route": "orders"}}`)
+	f.reply("POST /v1/threads/thread_1/messages", http.StatusOK, `{"id": "msg_1", "role": "user"}`)
+	f.reply("GET /v1/threads/thread_1/messages/msg_1", http.StatusOK, `{"id": "msg_1", "role": "user"}`)
+	f.reply("POST /v1/threads/thread_1/messages/msg_1", http.StatusOK, `{"id": "msg_1", "metadata": {"seen": "yes"}}`)
+	f.reply("DELETE /v1/threads/thread_1/messages/msg_1", http.StatusOK, `{"id": "msg_1", "deleted": true}`)
+	f.reply("DELETE /v1/threads/thread_1", http.StatusOK, `{"id": "thread_1", "deleted": true}`)
+	f.reply("DELETE /v1/threads/thread_2", http.StatusOK, `{"id": "thread_2", "deleted": false}`)
+
+	a := f.assistant(PollRuns)
+	a.threadID = ""
+	ctx := context.Background()
+
+	if _, err := a.CreateMessage(ctx, AddMessagePayload{Role: "user", Content: "hi"}); err == nil {
+		t.Error("CreateMessage() without a thread succeeded")
+	}
+	thread, err := a.CreateThread(ctx, nil, map[string]string{"ses_message_id": "ses-1"})
+	if err != nil || thread.ID != "thread_1" || a.GetThreadID() != "thread_1" {
+		t.Fatalf("CreateThread() = %+v, %v; want thread_1 made current", thread, err)
+	}
+	if body := f.received("POST /v1/threads")[0].Body; !strings.Contains(body, `"metadata":{"ses_message_id":"ses-1"}`) || strings.Contains(body, "messages") {
+		t.Errorf("create thread body = %s", body)
+	}
+	if _, err := a.GetThread(ctx, "thread_1"); err != nil {
+		t.Error(err)
+	}
+	if _, err := a.UpdateThreadMetadata(ctx, "thread_1", map[string]string{"route": "orders"}); err != nil {
+		t.Error(err)
+	}
+
+	message, err := a.CreateMessage(ctx, AddMessagePayload{Role: "user", Content: "hi"})
+	if err != nil || message.ID != "msg_1" {
+		t.Fatalf("CreateMessage() = %+v, %v", message, err)
+	}
+	if _, err := a.GetMessage(ctx, "msg_1"); err != nil {
+		t.Error(err)
+	}
+	if _, err := a.UpdateMessageMetadata(ctx, "msg_1", map[string]string{"seen": "yes"}); err != nil {
+		t.Error(err)
+	}
+	if body := f.received("POST /v1/threads/thread_1/messages/msg_1")[0].Body; body != `{"metadata":{"seen":"yes"}}` {
+		t.Errorf("update message body = %s", body)
+	}
+	if err := a.DeleteMessage(ctx, "msg_1"); err != nil {
+		t.Error(err)
+	}
+
+	if err := a.DeleteThread(ctx, "thread_2"); err == nil || !strings.Contains(err.Error(), "was not deleted") {
+		t.Errorf("DeleteThread() of an undeleted thread = %v", err)
+	}
+	if err := a.DeleteThread(ctx, "thread_1"); err != nil || a.GetThreadID() != "" {
+		t.Errorf("DeleteThread() = %v, current thread %q; want it forgotten", err, a.GetThreadID())
+	}
+	if err := a.DeleteThread(ctx, "thread_3"); err == nil {
+		t.Error("DeleteThread() of an unknown thread succeeded")
+	}
+}
+
+func TestMessageIterator(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.handle("GET /v1/threads/thread_1/messages", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("after") {
+		case "":
+			w.Write([]byte(`{"data": [{"id": "msg_1"}, {"id": "msg_2"}], "has_more": true, "last_id": "msg_2"}`))
+		case "msg_2":
+			w.Write([]byte(`{"data": [], "has_more": true, "last_id": "msg_2b"}`))
+		case "msg_2b":
+			w.Write([]byte(`{"data": [{"id": "msg_3"}], "has_more": false, "last_id": "msg_3"}`))
+		}
+	})
+	a := f.assistant(PollRuns)
+
+	var ids []string
+	it := a.Messages(context.Background(), ListMessagesOptions{Limit: 2, Order: "asc", RunID: "run_1"})
+	for it.Next() {
+		ids = append(ids, it.Message().ID)
+	}
+	if err := it.Err(); err != nil || strings.Join(ids, ",") != "msg_1,msg_2,msg_3" {
+		t.Errorf("iterated %q, %v; want every message", ids, err)
+	}
+	if it.Next() {
+		t.Error("Next() after the end = true")
+	}
+	requests := f.received("GET /v1/threads/thread_1/messages")
+	if len(requests) != 3 {
+		t.Fatalf("fetched %d pages, want 3", len(requests))
+	}
+	if q := requests[0].Query; q.Get("limit") != "2" || q.Get("order") != "asc" || q.Get("run_id") != "run_1" || q.Has("before") {
+		t.Errorf("first page query = %v", q)
+	}
+
+	f.reply("GET /v1/threads/thread_1/messages", http.StatusNotFound, `{"error": {"message": "No thread found"}}`)
+	it = a.Messages(context.Background(), ListMessagesOptions{})
+	if it.Next() || it.Err() == nil {
+		t.Errorf("iterating a missing thread: Err() = %v, want the failure", it.Err())
+	}
+}
+
+func TestCreateThreadAndRun(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.fakeRun("completed")
+	f.reply("POST /v1/threads/runs", http.StatusOK, `{"id": "run_1", "thread_id": "thread_1", "status": "queued"}`)
+	a := f.assistant(PollRuns)
+	a.threadID = ""
+
+	reply, err := a.CreateThreadAndRun(context.Background(), []AddMessagePayload{{Role: "user", Content: "5 blue widgets"}}, map[string]string{"ses_message_id": "ses-1"})
+	if err != nil || reply != "Blue Widget x5" {
+		t.Fatalf("CreateThreadAndRun() = %q, %v", reply, err)
+	}
+	if a.GetThreadID() != "thread_1" {
+		t.Errorf("current thread = %q, want the one created", a.GetThreadID())
+	}
+	var payload CreateThreadAndRunPayload
+	if err := json.Unmarshal([]byte(f.received("POST /v1/threads/runs")[0].Body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.AssistantID != "asst_1" || len(payload.Thread.Messages) != 1 || payload.Thread.Metadata["ses_message_id"] != "ses-1" {
+		t.Errorf("create and run payload = %+v", payload)
+	}
+	if n := len(f.received("POST /v1/threads/thread_1/messages")); n != 0 {
+		t.Errorf("added %d messages separately, want them in the new thread", n)
+	}
+}
+
+func TestAssistantsPickerTagsThread(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.fakeRun("completed")
+	f.reply("POST /v1/threads", http.StatusOK, `{"id": "thread_1"}`)
+	p := &assistantsPicker{openAIKey: "sk-test", options: []AssistantOption{WithBaseURL(f.URL + "/v1")}}
+
+	answer, err := p.Pick(context.Background(), &Route{Name: "orders", AssistantID: "asst_1"}, "ses-1", &EmailContent{PlainText: "5 blue widgets"})
+	if err != nil || answer.Text != "Blue Widget x5" {
+		t.Fatalf("Pick() = %+v, %v", answer, err)
+	}
+	var thread CreateThreadPayload
+	json.Unmarshal([]byte(f.received("POST /v1/threads")[0].Body), &thread)
+	if thread.Metadata["ses_message_id"] != "ses-1" || thread.Metadata["route"] != "orders" {
+		t.Errorf("thread metadata = %v, want the SES message ID and route", thread.Metadata)
+	}
+}
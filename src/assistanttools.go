@@ -0,0 +1,204 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// ToolFunc handles one function call from a run. arguments is the JSON object the model produced
+// for the tool's schema; the returned string is submitted back to the run as the tool output.
+type ToolFunc func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      bool            `json:"strict,omitempty"` // Hold the model to Parameters exactly
+}
+
+type Tool struct {
+	Type     string              `json:"type"`
+	Function *FunctionDefinition `json:"function,omitempty"`
+}
+
+type registeredTool struct {
+	definition FunctionDefinition
+	fn         ToolFunc
+	declared   bool // The remote assistant already has the tool, so runs needn't send it
+}
+
+type RequiredAction struct {
+	Type              string `json:"type"`
+	SubmitToolOutputs struct {
+		ToolCalls []ToolCall `json:"tool_calls"`
+	} `json:"submit_tool_outputs"`
+}
+
+type ToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type ToolOutput struct {
+	ToolCallID string `json:"tool_call_id"`
+	Output     string `json:"output"`
+}
+
+type SubmitToolOutputsPayload struct {
+	ToolOutputs []ToolOutput `json:"tool_outputs"`
+	Stream      bool         `json:"stream,omitempty"`
+}
+
+// RegisterTool makes fn callable by the model as a function tool. parameters is the JSON schema
+// of its arguments. Registered tools are sent with every run alongside the tools stored on the
+// remote assistant, which are fetched once for the purpose.
+func (a *Assistant) RegisterTool(name, description string, parameters json.RawMessage, fn ToolFunc) error {
+	return a.registerTool(name, description, parameters, fn, false)
+}
+
+// RegisterDeclaredTool answers calls to a function tool that the remote assistant already
+// declares, e.g. in assistant.json. Unlike RegisterTool it leaves the assistant's own tools in
+// place, unless something else makes the run replace them.
+func (a *Assistant) RegisterDeclaredTool(name, description string, parameters json.RawMessage, fn ToolFunc) error {
+	return a.registerTool(name, description, parameters, fn, true)
+}
+
+func (a *Assistant) registerTool(name, description string, parameters json.RawMessage, fn ToolFunc, declared bool) error {
+	if name == "" || fn == nil {
+		return fmt.Errorf("tool needs a name and a function")
+	}
+	if len(parameters) > 0 && !json.Valid(parameters) {
+		return fmt.Errorf("tool %s has invalid JSON schema", name)
+	}
+	if a.tools == nil {
+		a.tools = map[string]*registeredTool{}
+	}
+	a.tools[name] = &registeredTool{
+		definition: FunctionDefinition{Name: name, Description: description, Parameters: parameters},
+		fn:         fn,
+		declared:   declared,
+	}
+	return nil
+}
+
+// replacesTools reports whether runs must send their own tools: a registered tool isn't declared
+// on the assistant or attached files need built-in tools.
+func (a *Assistant) replacesTools() bool {
+	replace := len(a.attachmentTools) > 0
+	for _, tool := range a.tools {
+		replace = replace || !tool.declared
+	}
+	return replace
+}
+
+// loadStoredTools fetches the tools stored on the remote assistant, once, when runs will replace
+// them, so that runTools can keep them.
+func (a *Assistant) loadStoredTools(ctx context.Context) error {
+	if a.storedTools != nil || !a.replacesTools() {
+		return nil
+	}
+	var remote AssistantObject
+	if err := a.callJSON(ctx, "GET", a.endpoint("/assistants/%s", a.assistantID), nil, &remote, true, "get assistant"); err != nil {
+		return fmt.Errorf("failed to get the assistant's tools: %w", err)
+	}
+	a.storedTools = append([]Tool{}, remote.Tools...)
+	return nil
+}
+
+// runTools lists the tools for a run payload, or nil to keep the assistant's own. When they have
+// to be replaced (see replacesTools), the run gets every registered tool, then the assistant's
+// stored tools, such as file_search over the catalogue, then the built-in tools attachments need.
+func (a *Assistant) runTools() []Tool {
+	if !a.replacesTools() {
+		return nil
+	}
+
+	tools := make([]Tool, 0, len(a.tools)+len(a.storedTools)+len(a.attachmentTools))
+	seen := map[string]bool{}
+	add := func(tool Tool) {
+		key := tool.Type
+		if tool.Function != nil {
+			key += ":" + tool.Function.Name
+		}
+		if !seen[key] {
+			seen[key] = true
+			tools = append(tools, tool)
+		}
+	}
+
+	names := make([]string, 0, len(a.tools))
+	for name := range a.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		definition := a.tools[name].definition
+		add(Tool{Type: "function", Function: &definition})
+	}
+	for _, tool := range a.storedTools {
+		add(tool)
+	}
+	for _, tool := range a.attachmentTools {
+		add(Tool{Type: tool})
+	}
+	return tools
+}
+
+// canHandle reports whether every tool call in the action is for a registered tool.
+func (a *Assistant) canHandle(action *RequiredAction) bool {
+	if action == nil || action.Type != "submit_tool_outputs" || len(a.tools) == 0 {
+		return false
+	}
+	for _, call := range action.SubmitToolOutputs.ToolCalls {
+		if _, ok := a.tools[call.Function.Name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// callTools runs each requested tool. A failing tool reports its error to the model as its
+// output rather than failing the run, so the model can recover or explain.
+func (a *Assistant) callTools(ctx context.Context, calls []ToolCall) []ToolOutput {
+	outputs := make([]ToolOutput, 0, len(calls))
+	for _, call := range calls {
+		output, err := a.tools[call.Function.Name].fn(ctx, json.RawMessage(call.Function.Arguments))
+		if err != nil {
+			a.logError(fmt.Sprintf("Tool %s failed: %v", call.Function.Name, err))
+			errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+			output = string(errJSON)
+		}
+		outputs = append(outputs, ToolOutput{ToolCallID: call.ID, Output: output})
+	}
+	return outputs
+}
+
+// submitToolOutputs hands tool results back to the current run so it can continue.
+func (a *Assistant) submitToolOutputs(ctx context.Context, outputs []ToolOutput) error {
+	jsonPayload, err := json.Marshal(SubmitToolOutputsPayload{ToolOutputs: outputs})
+	if err != nil {
+		a.logError(fmt.Sprintf("Failed to marshal tool outputs payload: %v", err))
+		return fmt.Errorf("failed to marshal tool outputs payload: %w", err)
+	}
+
+	url := a.endpoint("/threads/%s/runs/%s/submit_tool_outputs", a.threadID, a.runID)
+	resp, err := a.send(ctx, "POST", url, jsonPayload, false)
+	if err != nil {
+		a.logError(fmt.Sprintf("Error sending request to submit tool outputs: %v", err))
+		return fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(resp)
+		a.logError(fmt.Sprintf("Submit tool outputs failed: %v", apiErr))
+		return fmt.Errorf("failed to submit tool outputs: %w", apiErr)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func echoTool(ctx context.Context, arguments json.RawMessage) (string, error) {
+	return string(arguments), nil
+}
+
+func TestRunTools(t *testing.T) {
+	const getAssistant = "GET /v1/assistants/asst_1"
+	stored := `{"id": "asst_1", "tools": [
+		{"type": "function", "function": {"name": "lookup_product", "parameters": {"type": "object"}}},
+		{"type": "file_search"}
+	]}`
+
+	tests := []struct {
+		name        string
+		declared    bool     // Register lookup_product as declared
+		other       bool     // Register an undeclared send_quote tool
+		attachments []string // Built-in tools attachments need
+		want        []string // Tools sent with the run, nil to keep the assistant's
+		fetched     bool     // Whether the assistant's tools were fetched
+	}{
+		{name: "declared tools keep the assistant's own", declared: true},
+		{
+			name:     "an undeclared tool keeps file_search",
+			declared: true, other: true,
+			want:    []string{"function:lookup_product", "function:send_quote", "file_search"},
+			fetched: true,
+		},
+		{
+			name:        "attachments keep file_search and add code_interpreter",
+			attachments: []string{"file_search", "code_interpreter"},
+			want:        []string{"function:lookup_product", "file_search", "code_interpreter"},
+			fetched:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOpenAI(t)
+			f.fakeRun("completed")
+			f.reply(getAssistant, http.StatusOK, stored)
+			a := f.assistant(PollRuns)
+			if tt.declared {
+				if err := a.RegisterDeclaredTool("lookup_product", "", nil, echoTool); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.other {
+				if err := a.RegisterTool("send_quote", "", json.RawMessage(`{"type": "object"}`), echoTool); err != nil {
+					t.Fatal(err)
+				}
+			}
+			a.attachmentTools = tt.attachments
+
+			for i := 0; i < 2; i++ {
+				if _, err := a.AddMessageToThreadContext(context.Background(), "hello"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			runs := f.received("POST /v1/threads/thread_1/runs")
+			var payload RunThreadPayload
+			if err := json.Unmarshal([]byte(runs[len(runs)-1].Body), &payload); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, tool := range payload.Tools {
+				if tool.Function != nil {
+					got = append(got, tool.Type+":"+tool.Function.Name)
+				} else {
+					got = append(got, tool.Type)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("run tools = %q, want %q", got, tt.want)
+			}
+			fetched := len(f.received(getAssistant))
+			if tt.fetched && fetched != 1 || !tt.fetched && fetched != 0 {
+				t.Errorf("fetched the assistant %d times, fetched = %v", fetched, tt.fetched)
+			}
+		})
+	}
+}
+
+func TestRunToolsFetchFails(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.fakeRun("completed")
+	a := f.assistant(PollRuns)
+	a.attachmentTools = []string{"file_search"}
+
+	var apiErr *APIError
+	if _, err := a.AddMessageToThreadContext(context.Background(), "hello"); !errors.As(err, &apiErr) || !apiErr.IsNotFound() {
+		t.Fatalf("AddMessageToThreadContext() error = %v, want the failed assistant fetch", err)
+	}
+	if n := len(f.received("POST /v1/threads/thread_1/runs")); n != 0 {
+		t.Errorf("started %d runs without the assistant's tools", n)
+	}
+}
+
+func TestToolCalls(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.fakeRun()
+	f.reply(testRunRoute, http.StatusOK,
+		`{"id": "run_1", "status": "requires_action", "required_action": {"type": "submit_tool_outputs", "submit_tool_outputs": {"tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "lookup_product", "arguments": "{\"query\": \"widget\"}"}},
+			{"id": "call_2", "type": "function", "function": {"name": "broken", "arguments": "{}"}}
+		]}}}`,
+		`{"id": "run_1", "status": "completed"}`)
+	f.reply("POST /v1/threads/thread_1/runs/run_1/submit_tool_outputs", http.StatusOK, `{"id": "run_1", "status": "queued"}`)
+
+	a := f.assistant(PollRuns)
+	a.RegisterDeclaredTool("lookup_product", "", nil, echoTool)
+	a.RegisterDeclaredTool("broken", "", nil, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		return "", errors.New("out of order")
+	})
+
+	if reply, err := a.AddMessageToThreadContext(context.Background(), "hello"); err != nil || reply != "Blue Widget x5" {
+		t.Fatalf("AddMessageToThreadContext() = %q, %v", reply, err)
+	}
+	submitted := f.received("POST /v1/threads/thread_1/runs/run_1/submit_tool_outputs")
+	if len(submitted) != 1 {
+		t.Fatalf("submitted tool outputs %d times, want once", len(submitted))
+	}
+	var payload SubmitToolOutputsPayload
+	if err := json.Unmarshal([]byte(submitted[0].Body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := []ToolOutput{{ToolCallID: "call_1", Output: `{"query": "widget"}`}, {ToolCallID: "call_2", Output: `{"error":"out of order"}`}}
+	if len(payload.ToolOutputs) != 2 || payload.ToolOutputs[0] != want[0] || payload.ToolOutputs[1] != want[1] {
+		t.Errorf("tool outputs = %+v, want %+v", payload.ToolOutputs, want)
+	}
+}
+
+func TestCanHandle(t *testing.T) {
+	a := &Assistant{}
+	action := &RequiredAction{Type: "submit_tool_outputs"}
+	action.SubmitToolOutputs.ToolCalls = []ToolCall{{ID: "call_1"}}
+	action.SubmitToolOutputs.ToolCalls[0].Function.Name = "lookup_product"
+	if a.canHandle(action) {
+		t.Error("canHandle() without tools = true")
+	}
+	a.RegisterDeclaredTool("lookup_product", "", nil, echoTool)
+	if !a.canHandle(action) {
+		t.Error("canHandle() for a registered tool = false")
+	}
+	action.SubmitToolOutputs.ToolCalls[0].Function.Name = "send_quote"
+	if a.canHandle(action) {
+		t.Error("canHandle() for an unknown tool = true")
+	}
+	if a.canHandle(nil) {
+		t.Error("canHandle(nil) = true")
+	}
+}
+
+func TestRegisterTool(t *testing.T) {
+	a := &Assistant{}
+	if err := a.RegisterTool("", "", nil, echoTool); err == nil {
+		t.Error("RegisterTool() without a name succeeded")
+	}
+	if err := a.RegisterTool("lookup", "", nil, nil); err == nil {
+		t.Error("RegisterTool() without a function succeeded")
+	}
+	if err := a.RegisterTool("lookup", "", json.RawMessage(`{"type":`), echoTool); err == nil {
+		t.Error("RegisterTool() with an invalid schema succeeded")
+	}
+}
+
+func TestCatalogueLookup(t *testing.T) {
+	catalogue, err := NewCatalogue([]Product{
+		{SKU: "BW-100", Name: "Blue Widget", Attributes: map[string]string{"Stock": "12", "Price": "4.50", "Colour": "blue"}},
+		{SKU: "RW-100", Name: "Red Widget"},
+		{SKU: "GS-200", Name: "Garden Spade"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    []string // SKUs, best first
+		wantErr bool
+	}{
+		{name: "by sku", query: "gs-200", want: []string{"GS-200"}},
+		{name: "by name", query: "blue widget", want: []string{"BW-100", "RW-100"}},
+		{name: "nothing close", query: "lawn mower"},
+		{name: "empty query", query: " ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arguments, _ := json.Marshal(map[string]string{"query": tt.query})
+			out, err := catalogue.Lookup(context.Background(), arguments)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var result struct {
+				Products []catalogueToolResult `json:"products"`
+			}
+			if err := json.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("Lookup() = %s: %v", out, err)
+			}
+			var got []string
+			for _, p := range result.Products {
+				got = append(got, p.SKU)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Lookup(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+			if len(result.Products) > 0 && result.Products[0].SKU == "BW-100" {
+				if p := result.Products[0]; p.Stock != "12" || p.Price != "4.50" || p.Attributes["Colour"] != "blue" {
+					t.Errorf("Lookup() product = %+v, want stock, price and attributes split out", p)
+				}
+			}
+		})
+	}
+
+	if _, err := catalogue.Lookup(context.Background(), json.RawMessage(`"widget"`)); err == nil {
+		t.Error("Lookup() with arguments that aren't an object succeeded")
+	}
+}
@@ -0,0 +1,168 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backfill feeds historical mailbox exports through a Pipeline.
+type Backfill struct {
+	Pipeline      *Pipeline
+	Workers       int           // Emails processed concurrently, at least 1
+	Checkpoint    string        // File of finished message IDs, appended as work completes. Empty disables resuming.
+	ProgressEvery time.Duration // How often to log progress, 0 disables it
+	MboxFormat    MboxFormat
+}
+
+type BackfillStats struct {
+	Processed int64
+	Skipped   int64 // Already in the checkpoint from an earlier run
+	Failed    int64
+}
+
+// Run processes every message in sources. Failed messages are logged and left out of the
+// checkpoint so the next run retries them.
+func (b *Backfill) Run(ctx context.Context, sources []string) (*BackfillStats, error) {
+	done, err := loadCheckpoint(b.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint *os.File
+	if b.Checkpoint != "" {
+		checkpoint, err = os.OpenFile(b.Checkpoint, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open checkpoint %s: %w", b.Checkpoint, err)
+		}
+		defer checkpoint.Close()
+	}
+	var checkpointMu sync.Mutex
+
+	workers := b.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	stats := &BackfillStats{}
+	started := time.Now()
+	queue := make(chan *MailboxMessage, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range queue {
+				if err := b.processOne(ctx, m); err != nil {
+					log.Printf("Backfill: %s failed: %v", m.ID, err)
+					atomic.AddInt64(&stats.Failed, 1)
+					continue
+				}
+				if checkpoint != nil {
+					checkpointMu.Lock()
+					_, err := fmt.Fprintln(checkpoint, m.ID)
+					checkpointMu.Unlock()
+					if err != nil {
+						log.Printf("Backfill: failed to record %s in checkpoint: %v", m.ID, err)
+					}
+				}
+				atomic.AddInt64(&stats.Processed, 1)
+			}
+		}()
+	}
+
+	stopProgress := make(chan struct{})
+	if b.ProgressEvery > 0 {
+		go func() {
+			ticker := time.NewTicker(b.ProgressEvery)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					b.logProgress(stats, started)
+				case <-stopProgress:
+					return
+				}
+			}
+		}()
+	}
+
+	errStopped := errors.New("backfill stopped")
+	readErr := EachLocalMessage(sources, b.MboxFormat, func(m *MailboxMessage) error {
+		if done[m.ID] {
+			atomic.AddInt64(&stats.Skipped, 1)
+			return nil
+		}
+		select {
+		case queue <- m:
+			return nil
+		case <-ctx.Done():
+			return errStopped
+		}
+	})
+	close(queue)
+	wg.Wait()
+	close(stopProgress)
+	b.logProgress(stats, started)
+
+	if errors.Is(readErr, errStopped) {
+		return stats, ctx.Err()
+	}
+	if readErr != nil {
+		return stats, fmt.Errorf("failed to read mail sources: %w", readErr)
+	}
+	return stats, nil
+}
+
+func (b *Backfill) processOne(ctx context.Context, m *MailboxMessage) error {
+	msg, err := ParseEmailBody(bytes.NewReader(m.Raw))
+	if err != nil {
+		return fmt.Errorf("parse email error: %w", err)
+	}
+	return b.Pipeline.Process(ctx, m.ID, msg, parseAddressList(msg.To))
+}
+
+func (b *Backfill) logProgress(stats *BackfillStats, started time.Time) {
+	processed := atomic.LoadInt64(&stats.Processed)
+	elapsed := time.Since(started)
+	rate := float64(processed) / elapsed.Seconds()
+	log.Printf("Backfill progress: %d processed, %d skipped, %d failed, %.1f emails/s, %s elapsed",
+		processed, atomic.LoadInt64(&stats.Skipped), atomic.LoadInt64(&stats.Failed), rate, elapsed.Round(time.Second))
+}
+
+// loadCheckpoint returns the message IDs recorded by earlier runs.
+func loadCheckpoint(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	if path == "" {
+		return done, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			done[id] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+	}
+	return done, nil
+}
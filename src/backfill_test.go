@@ -0,0 +1,118 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// pickerFunc adapts a function to ProductPicker.
+type pickerFunc func(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error)
+
+func (f pickerFunc) Pick(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+	return f(ctx, route, messageID, msg)
+}
+
+// testPipeline answers every email with pick, routing everything to the default route.
+func testPipeline(t *testing.T, pick pickerFunc) *Pipeline {
+	t.Helper()
+	t.Setenv("ROUTING_TABLE", `{"default": {"assistant_id": "asst_test"}}`)
+	routes, err := LoadRoutingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Pipeline{Routes: routes, Picker: pick}
+}
+
+func TestBackfillRun(t *testing.T) {
+	dir := t.TempDir()
+	mbox := "From a Mon Jan  1 00:00:00 2024\nSubject: one\n\nHi\n\n" +
+		"From b Mon Jan  1 00:00:01 2024\nSubject: fail\n\nHi\n\n" +
+		"From c Mon Jan  1 00:00:02 2024\nSubject: three\n\nHi\n"
+	if err := os.WriteFile(filepath.Join(dir, "archive.mbox"), []byte(mbox), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "single.eml"), []byte("Subject: four\r\n\r\nHi\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := filepath.Join(t.TempDir(), "backfill.checkpoint")
+
+	var mu sync.Mutex
+	var picked []string
+	failing := true
+	pipeline := testPipeline(t, func(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if msg.Subject == "fail" && failing {
+			return nil, errors.New("boom")
+		}
+		picked = append(picked, msg.Subject)
+		return &Answer{Text: "ok"}, nil
+	})
+	sources, err := CollectMailSources([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := []struct {
+		name    string
+		failing bool
+		want    BackfillStats
+		picked  []string
+	}{
+		{"first run records what succeeded", true, BackfillStats{Processed: 3, Failed: 1}, []string{"four", "one", "three"}},
+		{"second run retries only the failure", false, BackfillStats{Processed: 1, Skipped: 3}, []string{"fail"}},
+		{"third run has nothing left", false, BackfillStats{Skipped: 4}, nil},
+	}
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			failing, picked = run.failing, nil
+			backfill := &Backfill{Pipeline: pipeline, Workers: 3, Checkpoint: checkpoint}
+			stats, err := backfill.Run(context.Background(), sources)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if *stats != run.want {
+				t.Errorf("Run() stats = %+v, want %+v", *stats, run.want)
+			}
+			sort.Strings(picked)
+			if strings.Join(picked, ",") != strings.Join(run.picked, ",") {
+				t.Errorf("picked %q, want %q", picked, run.picked)
+			}
+		})
+	}
+
+	done, err := loadCheckpoint(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{archiveID(dir, 1), archiveID(dir, 2), archiveID(dir, 3), filepath.Join(dir, "single.eml")} {
+		if !done[id] {
+			t.Errorf("checkpoint is missing %s: %v", id, done)
+		}
+	}
+}
+
+func archiveID(dir string, n int) string {
+	return fmt.Sprintf("%s#%d", filepath.Join(dir, "archive.mbox"), n)
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	if done, err := loadCheckpoint(path); err != nil || len(done) != 0 {
+		t.Errorf("loadCheckpoint(missing) = %v, %v; want nothing done", done, err)
+	}
+	if err := os.WriteFile(path, []byte("a\n\n  b  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	done, err := loadCheckpoint(path)
+	if err != nil || len(done) != 2 || !done["a"] || !done["b"] {
+		t.Errorf("loadCheckpoint() = %v, %v; want a and b", done, err)
+	}
+}
@@ -0,0 +1,164 @@
+package inbound
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Product is one row of the product catalogue.
+type Product struct {
+	SKU        string            `json:"sku"`
+	Name       string            `json:"name"`
+	Aliases    []string          `json:"aliases,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Catalogue is the product catalogue, exported from the shop as CSV or JSON.
+type Catalogue struct {
+	Products []Product
+	bySKU    map[string]*Product
+}
+
+// LoadCatalogue reads a catalogue export. JSON files hold an array of Products. CSV files need a
+// header row with a sku column; name and aliases (separated by ; or |) columns are optional and
+// every other column becomes an attribute.
+func LoadCatalogue(path string) (*Catalogue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open catalogue %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var products []Product
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.NewDecoder(f).Decode(&products); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal catalogue %s: %w", path, err)
+		}
+	} else {
+		products, err = readCatalogueCSV(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalogue %s: %w", path, err)
+		}
+	}
+	return NewCatalogue(products)
+}
+
+// CatalogueFromEnv loads the catalogue from CATALOGUE_FILE, or returns nil if it is unset.
+func CatalogueFromEnv() (*Catalogue, error) {
+	path := os.Getenv("CATALOGUE_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadCatalogue(path)
+}
+
+// NewCatalogue indexes products, which must have unique SKUs.
+func NewCatalogue(products []Product) (*Catalogue, error) {
+	c := &Catalogue{Products: products, bySKU: make(map[string]*Product, len(products))}
+	for i := range c.Products {
+		p := &c.Products[i]
+		p.SKU = strings.TrimSpace(p.SKU)
+		if p.SKU == "" {
+			return nil, fmt.Errorf("catalogue row %d has no sku", i+1)
+		}
+		if _, ok := c.bySKU[p.SKU]; ok {
+			return nil, fmt.Errorf("catalogue has sku %s more than once", p.SKU)
+		}
+		c.bySKU[p.SKU] = p
+	}
+	return c, nil
+}
+
+func readCatalogueCSV(r io.Reader) ([]Product, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+	if !slices.ContainsFunc(header, func(name string) bool { return strings.EqualFold(name, "sku") }) {
+		return nil, fmt.Errorf("header has no sku column")
+	}
+
+	var products []Product
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return products, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		product := Product{}
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(header[i]) {
+			case "sku":
+				product.SKU = value
+			case "name":
+				product.Name = value
+			case "aliases":
+				for _, alias := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '|' }) {
+					if alias = strings.TrimSpace(alias); alias != "" {
+						product.Aliases = append(product.Aliases, alias)
+					}
+				}
+			default:
+				if value == "" {
+					continue
+				}
+				if product.Attributes == nil {
+					product.Attributes = map[string]string{}
+				}
+				product.Attributes[header[i]] = value
+			}
+		}
+		if product.SKU == "" && product.Name == "" {
+			continue // Blank line
+		}
+		products = append(products, product)
+	}
+}
+
+// Product looks up a product by SKU.
+func (c *Catalogue) Product(sku string) (*Product, bool) {
+	p, ok := c.bySKU[strings.TrimSpace(sku)]
+	return p, ok
+}
+
+// Document renders the product as the text indexed for file_search.
+func (p *Product) Document() string {
+	var b strings.Builder
+	name := p.Name
+	if name == "" {
+		name = p.SKU
+	}
+	fmt.Fprintf(&b, "# %s\n\nSKU: %s\n", name, p.SKU)
+	if len(p.Aliases) > 0 {
+		fmt.Fprintf(&b, "Also known as: %s\n", strings.Join(p.Aliases, ", "))
+	}
+
+	names := make([]string, 0, len(p.Attributes))
+	for name := range p.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\n", name, p.Attributes[name])
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package inbound
+
+import (
+	"strings"
+	"unicode"
+)
+
+// normaliseText lowercases s and turns every run of anything but letters and digits into a
+// single space, so "Widget-Pro (Blue)" and "widget pro blue" compare equal.
+func normaliseText(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// skuKey is how SKUs are compared: without case or separators, so "ab-123" finds "AB123".
+func skuKey(s string) string {
+	return strings.ReplaceAll(normaliseText(s), " ", "")
+}
+
+// Match finds the product query most likely means, comparing it with every SKU, name and alias.
+// The score runs from 0 to 1, with 1 for an exact match once case and punctuation are ignored.
+// Only names and aliases match approximately; a SKU matches exactly or not at all.
+func (c *Catalogue) Match(query string) (*Product, float64) {
+	if p, ok := c.Product(query); ok {
+		return p, 1
+	}
+	key, text := skuKey(query), normaliseText(query)
+	if key == "" {
+		return nil, 0
+	}
+
+	var best *Product
+	bestScore := 0.0
+	for i := range c.Products {
+		p := &c.Products[i]
+		if score := matchScore(p, key, text); score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best, bestScore
+}
+
+// matchScore is how well a query, as its SKU key and normalised text, matches p. A SKU one
+// character off is usually another product, so SKUs score 1 or nothing.
+func matchScore(p *Product, key, text string) float64 {
+	score := 0.0
+	if key == skuKey(p.SKU) {
+		score = 1
+	}
+	for _, name := range append([]string{p.Name}, p.Aliases...) {
+		if name == "" {
+			continue
+		}
+		if normalised := normaliseText(name); normalised == text {
+			score = 1
+		} else {
+			score = max(score, diceCoefficient(text, normalised))
+		}
+	}
+	return score
+}
+
+// Mentions lists the products whose SKU, name or an alias appears in text as whole words.
+func (c *Catalogue) Mentions(text string) []*Product {
+	padded := " " + normaliseText(text) + " "
+	keys := map[string]bool{}
+	for _, word := range strings.Fields(padded) {
+		keys[word] = true
+	}
+
+	var found []*Product
+	for i := range c.Products {
+		p := &c.Products[i]
+		mentioned := keys[skuKey(p.SKU)] || strings.Contains(padded, " "+normaliseText(p.SKU)+" ")
+		for _, name := range append([]string{p.Name}, p.Aliases...) {
+			if normalised := normaliseText(name); !mentioned && normalised != "" {
+				mentioned = strings.Contains(padded, " "+normalised+" ")
+			}
+		}
+		if mentioned {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// diceCoefficient compares the character pairs of a and b, which copes with reordered and extra
+// words better than edit distance does.
+func diceCoefficient(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	pairs := func(s string) map[string]int {
+		counts := map[string]int{}
+		runes := []rune(s)
+		for i := 0; i+1 < len(runes); i++ {
+			counts[string(runes[i:i+2])]++
+		}
+		return counts
+	}
+	pa, pb := pairs(a), pairs(b)
+	total := 0
+	for _, n := range pa {
+		total += n
+	}
+	for _, n := range pb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	shared := 0
+	for pair, n := range pa {
+		shared += min(n, pb[pair])
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+// levenshteinRatio is 1 minus the edit distance between a and b over the longer one's length.
+func levenshteinRatio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
@@ -0,0 +1,87 @@
+package inbound
+
+import (
+	"math"
+	"testing"
+)
+
+func testCatalogue(t *testing.T) *Catalogue {
+	t.Helper()
+	catalogue, err := NewCatalogue([]Product{
+		{SKU: "BW-100", Name: "Blue Widget", Aliases: []string{"azure widget"}},
+		{SKU: "RW-100", Name: "Red Widget"},
+		{SKU: "GS-200", Name: "Green Sprocket"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return catalogue
+}
+
+func TestLevenshteinRatio(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{a: "", b: "", want: 1},
+		{a: "bw100", b: "bw100", want: 1},
+		{a: "bw100", b: "bw101", want: 0.8},
+		{a: "bw100", b: "rw100", want: 0.8},
+		{a: "bw10", b: "bw100", want: 0.8},
+		{a: "abc", b: "", want: 0},
+		{a: "kitten", b: "sitting", want: 1 - 3.0/7},
+		{a: "café", b: "cafe", want: 0.75},
+	}
+	for _, tt := range tests {
+		if got := levenshteinRatio(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("levenshteinRatio(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDiceCoefficient(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{a: "blue widget", b: "blue widget", want: 1},
+		{a: "blue widgets", b: "blue widget", want: 20.0 / 21},
+		{a: "widget blue", b: "blue widget", want: 0.8},
+		{a: "abc", b: "xyz", want: 0},
+		{a: "a", b: "b", want: 0},
+		{a: "", b: "", want: 1},
+		{a: "aaaa", b: "aa", want: 0.5},
+	}
+	for _, tt := range tests {
+		if got := diceCoefficient(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("diceCoefficient(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCatalogueMatch(t *testing.T) {
+	catalogue := testCatalogue(t)
+	tests := []struct {
+		query    string
+		wantSKU  string
+		minScore float64 // The score is at least this, and below 1 unless it is 1
+	}{
+		{query: "BW-100", wantSKU: "BW-100", minScore: 1},
+		{query: " bw 100 ", wantSKU: "BW-100", minScore: 1},
+		{query: "Azure Widget", wantSKU: "BW-100", minScore: 1},
+		{query: "blue widgets", wantSKU: "BW-100", minScore: 0.9},
+		{query: "BW-101"},
+		{query: "RW-10"},
+		{query: "!!"},
+	}
+	for _, tt := range tests {
+		product, score := catalogue.Match(tt.query)
+		sku := ""
+		if product != nil && score > 0 {
+			sku = product.SKU
+		}
+		if sku != tt.wantSKU || score < tt.minScore || tt.minScore < 1 && score == 1 {
+			t.Errorf("Match(%q) = %s, %.2f; want %s scoring at least %.2f", tt.query, sku, score, tt.wantSKU, tt.minScore)
+		}
+	}
+}
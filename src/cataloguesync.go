@@ -0,0 +1,171 @@
+package inbound
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Catalogue rows are uploaded one file per product, named catalogue_<sku hash>_<content hash>.md,
+// so a sync can tell from the vector store alone which rows are missing, changed or gone.
+const catalogueFilePrefix = "catalogue_"
+
+// CatalogueSyncStats counts what SyncCatalogue did with each product.
+type CatalogueSyncStats struct {
+	Unchanged int
+	Added     int
+	Updated   int
+	Removed   int // Products no longer in the catalogue
+	Failed    int // Files that failed to upload or ingest; the next sync retries them
+}
+
+func catalogueFileName(p *Product) string {
+	return catalogueFilePrefix + shortHash(p.SKU) + "_" + shortHash(p.Document()) + ".md"
+}
+
+// parseCatalogueFileName splits a catalogue file name into its SKU and content hashes.
+func parseCatalogueFileName(name string) (skuHash, contentHash string, ok bool) {
+	rest, found := strings.CutPrefix(name, catalogueFilePrefix)
+	if !found {
+		return "", "", false
+	}
+	rest, found = strings.CutSuffix(rest, ".md")
+	if !found {
+		return "", "", false
+	}
+	return strings.Cut(rest, "_")
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SyncCatalogue makes the catalogue files in a vector store match catalogue, uploading only
+// products that are new or changed and removing those that were changed or dropped. Other files
+// in the store are left alone. With dryRun set it only counts what it would do.
+func (c *AssistantsClient) SyncCatalogue(ctx context.Context, vectorStoreID string, catalogue *Catalogue, dryRun bool) (*CatalogueSyncStats, error) {
+	storeFiles, err := c.ListVectorStoreFiles(ctx, vectorStoreID)
+	if err != nil {
+		return nil, err
+	}
+	uploaded, err := c.ListFiles(ctx, FilePurposeAssistants)
+	if err != nil {
+		return nil, err
+	}
+	filenames := make(map[string]string, len(uploaded))
+	for _, f := range uploaded {
+		filenames[f.ID] = f.Filename
+	}
+
+	wanted := make(map[string]*Product, len(catalogue.Products))
+	wantedSKUs := make(map[string]bool, len(catalogue.Products))
+	for i := range catalogue.Products {
+		p := &catalogue.Products[i]
+		wanted[catalogueFileName(p)] = p
+		wantedSKUs[shortHash(p.SKU)] = true
+	}
+
+	// Sort the store's catalogue files into those to keep and those to remove. Files whose
+	// ingestion failed are removed so they get redone.
+	stats := &CatalogueSyncStats{}
+	present := map[string]bool{}
+	existingSKUs := map[string]bool{}
+	var stale []string
+	for _, f := range storeFiles {
+		name := filenames[f.ID]
+		skuHash, _, ok := parseCatalogueFileName(name)
+		if !ok {
+			continue // Not ours
+		}
+		existingSKUs[skuHash] = true
+		if wanted[name] == nil || present[name] || f.Status == VectorStoreStatusFailed || f.Status == VectorStoreStatusCancelled {
+			stale = append(stale, f.ID)
+			continue
+		}
+		present[name] = true
+		stats.Unchanged++
+	}
+
+	var missing []*Product
+	for name, p := range wanted {
+		if present[name] {
+			continue
+		}
+		missing = append(missing, p)
+		if existingSKUs[shortHash(p.SKU)] {
+			stats.Updated++
+		} else {
+			stats.Added++
+		}
+	}
+	for skuHash := range existingSKUs {
+		if !wantedSKUs[skuHash] {
+			stats.Removed++
+		}
+	}
+	if dryRun {
+		return stats, nil
+	}
+
+	// Add the new versions before removing the old, so the store is never missing a product.
+	var fileIDs []string
+	for _, p := range missing {
+		file, err := c.UploadFile(ctx, catalogueFileName(p), "text/markdown", []byte(p.Document()), FilePurposeAssistants)
+		if err != nil {
+			if ctx.Err() != nil {
+				c.deleteFiles(fileIDs)
+				return nil, ctx.Err()
+			}
+			c.logError(fmt.Sprintf("Failed to upload product %s: %v", p.SKU, err))
+			stats.Failed++
+			continue
+		}
+		fileIDs = append(fileIDs, file.ID)
+	}
+	for start := 0; start < len(fileIDs); start += maxFileBatch {
+		end := min(start+maxFileBatch, len(fileIDs))
+		batch, err := c.CreateFileBatch(ctx, vectorStoreID, fileIDs[start:end])
+		if err != nil {
+			c.deleteFiles(fileIDs[start:])
+			return nil, err
+		}
+		batch, err = c.WaitForFileBatch(ctx, vectorStoreID, batch.ID, IngestionPollOptions)
+		if err != nil {
+			// This batch's files are in the store, where the next sync keeps or removes them,
+			// but the files of later batches are in no store at all.
+			c.deleteFiles(fileIDs[end:])
+			return nil, err
+		}
+		log.Printf("File batch %s %s: %d of %d files ingested\n", batch.ID, batch.Status, batch.FileCounts.Completed, batch.FileCounts.Total)
+		stats.Failed += batch.FileCounts.Failed + batch.FileCounts.Cancelled
+	}
+
+	for _, fileID := range stale {
+		if err := c.RemoveVectorStoreFile(ctx, vectorStoreID, fileID); err != nil {
+			return nil, err
+		}
+		if err := c.DeleteFile(ctx, fileID); err != nil {
+			c.logError(fmt.Sprintf("Failed to delete file %s: %v", fileID, err))
+		}
+	}
+	return stats, nil
+}
+
+// deleteFiles deletes files uploaded for a sync that failed before they reached the vector store,
+// so retries don't leave copies behind. Like DeleteUploadedFiles it has its own deadline, as the
+// sync's may be what ran out.
+func (c *AssistantsClient) deleteFiles(fileIDs []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, fileID := range fileIDs {
+		if err := c.DeleteFile(ctx, fileID); err != nil {
+			c.logError(fmt.Sprintf("Failed to delete file %s: %v", fileID, err))
+		}
+	}
+}
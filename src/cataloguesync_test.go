@@ -0,0 +1,135 @@
+package inbound
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSyncCatalogue(t *testing.T) {
+	catalogue := &Catalogue{Products: []Product{
+		{SKU: "BW-100", Name: "Blue Widget"},
+		{SKU: "RW-100", Name: "Red Widget", Aliases: []string{"crimson widget"}},
+		{SKU: "GS-200", Name: "Green Sprocket"},
+	}}
+	unchanged := catalogueFileName(&catalogue.Products[0])
+	updated := catalogueFileName(&Product{SKU: "RW-100", Name: "Red Widget"})
+	removed := catalogueFileName(&Product{SKU: "OLD-1", Name: "Discontinued"})
+
+	const (
+		storeFiles = "GET /v1/vector_stores/vs_1/files"
+		files      = "GET /v1/files"
+		batches    = "POST /v1/vector_stores/vs_1/file_batches"
+		batch      = "GET /v1/vector_stores/vs_1/file_batches/batch_1"
+	)
+	tests := []struct {
+		name        string
+		dryRun      bool
+		batchStatus int    // Of creating the file batch
+		batchReply  string // To getting the file batch
+		want        CatalogueSyncStats
+		wantErr     bool
+		removed     []string // Files taken out of the store
+		deleted     []string // Files deleted
+	}{
+		{
+			name:       "sync",
+			batchReply: `{"id": "batch_1", "status": "completed", "file_counts": {"completed": 1, "failed": 1, "total": 2}}`,
+			want:       CatalogueSyncStats{Unchanged: 1, Added: 1, Updated: 1, Removed: 1, Failed: 1},
+			removed:    []string{"file_dup", "file_red", "file_old"},
+			deleted:    []string{"file_dup", "file_red", "file_old"},
+		},
+		{
+			name:   "dry run",
+			dryRun: true,
+			want:   CatalogueSyncStats{Unchanged: 1, Added: 1, Updated: 1, Removed: 1},
+		},
+		{
+			name:        "batch not created",
+			batchStatus: http.StatusBadRequest,
+			wantErr:     true,
+			deleted:     []string{"file_1", "file_2"},
+		},
+		{
+			name:       "batch not ingested",
+			batchReply: `{"error": {"message": "No such batch"}}`,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOpenAI(t)
+			f.reply(storeFiles, http.StatusOK, `{"data": [
+				{"id": "file_blue", "status": "completed"},
+				{"id": "file_dup", "status": "failed"},
+				{"id": "file_red", "status": "completed"},
+				{"id": "file_old", "status": "completed"},
+				{"id": "file_notes", "status": "completed"}
+			], "has_more": false}`)
+			f.reply(files, http.StatusOK, `{"data": [
+				{"id": "file_blue", "filename": "`+unchanged+`"},
+				{"id": "file_dup", "filename": "`+unchanged+`"},
+				{"id": "file_red", "filename": "`+updated+`"},
+				{"id": "file_old", "filename": "`+removed+`"},
+				{"id": "file_notes", "filename": "notes.pdf"}
+			]}`)
+			uploads := f.fakeUploads(t)
+			f.reply(batches, max(tt.batchStatus, http.StatusOK), `{"id": "batch_1", "status": "in_progress"}`)
+			if tt.batchReply != "" {
+				status := http.StatusOK
+				if tt.wantErr {
+					status = http.StatusNotFound
+				}
+				f.reply(batch, status, tt.batchReply)
+			}
+			for _, id := range []string{"file_dup", "file_red", "file_old"} {
+				f.reply("DELETE /v1/vector_stores/vs_1/files/"+id, http.StatusOK, `{"id": "`+id+`", "deleted": true}`)
+			}
+			for _, id := range []string{"file_1", "file_2", "file_dup", "file_red", "file_old"} {
+				f.reply("DELETE /v1/files/"+id, http.StatusOK, `{"id": "`+id+`", "deleted": true}`)
+			}
+			c := NewAssistantsClient("sk-test", WithBaseURL(f.URL+"/v1"))
+			c.silenceErrors = true
+
+			stats, err := c.SyncCatalogue(context.Background(), "vs_1", catalogue, tt.dryRun)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SyncCatalogue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *stats != tt.want {
+				t.Errorf("SyncCatalogue() = %+v, want %+v", *stats, tt.want)
+			}
+
+			var uploaded []string
+			for _, u := range uploads() {
+				uploaded = append(uploaded, u.filename)
+			}
+			wantUploads := []string{catalogueFileName(&catalogue.Products[1]), catalogueFileName(&catalogue.Products[2])}
+			if tt.dryRun {
+				wantUploads = nil
+			}
+			sort.Strings(uploaded)
+			sort.Strings(wantUploads)
+			if !reflect.DeepEqual(uploaded, wantUploads) {
+				t.Errorf("uploaded %q, want %q", uploaded, wantUploads)
+			}
+
+			var gotRemoved, gotDeleted []string
+			for _, id := range []string{"file_1", "file_2", "file_blue", "file_dup", "file_red", "file_old", "file_notes"} {
+				if len(f.received("DELETE /v1/vector_stores/vs_1/files/"+id)) > 0 {
+					gotRemoved = append(gotRemoved, id)
+				}
+				if len(f.received("DELETE /v1/files/"+id)) > 0 {
+					gotDeleted = append(gotDeleted, id)
+				}
+			}
+			if !reflect.DeepEqual(gotRemoved, tt.removed) {
+				t.Errorf("removed %q from the store, want %q", gotRemoved, tt.removed)
+			}
+			if !reflect.DeepEqual(gotDeleted, tt.deleted) {
+				t.Errorf("deleted %q, want %q", gotDeleted, tt.deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// catalogueToolName is the function tool the product picker calls to look products up mid-run.
+// assistant.json declares it with this description and catalogueToolParameters, so keep them in
+// step.
+const catalogueToolName = "lookup_product"
+
+const catalogueToolDescription = "Look up catalogue products by SKU or name, returning their stock and price."
+
+var catalogueToolParameters = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"query": {"type": "string", "description": "A SKU or the product as the customer described it"}
+	},
+	"required": ["query"],
+	"additionalProperties": false
+}`)
+
+// Closest matches the lookup tool returns, and how close they must be.
+const (
+	catalogueToolMaxResults = 5
+	catalogueToolMinScore   = 0.5
+)
+
+// catalogueToolResult is a product as the lookup tool reports it. Stock and price come from the
+// catalogue's stock and price columns; the other columns are in Attributes.
+type catalogueToolResult struct {
+	SKU        string            `json:"sku"`
+	Name       string            `json:"name"`
+	Stock      string            `json:"stock,omitempty"`
+	Price      string            `json:"price,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Match      float64           `json:"match"`
+}
+
+// Lookup answers the lookup_product tool with the products closest to the query.
+func (c *Catalogue) Lookup(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("failed to unmarshal %s arguments: %w", catalogueToolName, err)
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return "", fmt.Errorf("%s needs a query", catalogueToolName)
+	}
+
+	key, text := skuKey(args.Query), normaliseText(args.Query)
+	results := []catalogueToolResult{}
+	for i := range c.Products {
+		p := &c.Products[i]
+		score := matchScore(p, key, text)
+		if exact, ok := c.Product(args.Query); ok && exact == p {
+			score = 1
+		}
+		if score < catalogueToolMinScore {
+			continue
+		}
+		result := catalogueToolResult{SKU: p.SKU, Name: p.Name, Match: score}
+		for column, value := range p.Attributes {
+			switch strings.ToLower(column) {
+			case "stock":
+				result.Stock = value
+			case "price":
+				result.Price = value
+			default:
+				if result.Attributes == nil {
+					result.Attributes = map[string]string{}
+				}
+				result.Attributes[column] = value
+			}
+		}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Match > results[j].Match })
+	if len(results) > catalogueToolMaxResults {
+		results = results[:catalogueToolMaxResults]
+	}
+
+	b, err := json.Marshal(map[string]interface{}{"products": results})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s results: %w", catalogueToolName, err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,78 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ChatClient calls the stateless Chat Completions API, which OpenAI-compatible local servers
+// such as Ollama and llama.cpp also implement.
+type ChatClient struct {
+	openAIClient
+}
+
+type ChatMessage struct {
+	Role    string `json:"role"` // "system", "user" or "assistant"
+	Content string `json:"content"`
+}
+
+type ChatCompletionRequest struct {
+	Model          string          `json:"model"`
+	Messages       []ChatMessage   `json:"messages"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+}
+
+type ChatCompletionResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index        int         `json:"index"`
+		Message      ChatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+func NewChatClient(openAIKey string, options ...AssistantOption) *ChatClient {
+	return &ChatClient{openAIClient: newOpenAIClient("Chat", openAIKey, options)}
+}
+
+// CreateChatCompletion sends one chat completion request. On Azure the model is the deployment name.
+func (c *ChatClient) CreateChatCompletion(ctx context.Context, request *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	jsonPayload, err := json.Marshal(request)
+	if err != nil {
+		c.logError(fmt.Sprintf("Failed to marshal chat completion payload: %v", err))
+		return nil, fmt.Errorf("failed to marshal chat completion payload: %w", err)
+	}
+
+	url := c.endpoint("/chat/completions")
+	if c.azure {
+		url = c.endpoint("/deployments/%s/chat/completions", request.Model)
+	}
+	resp, err := c.send(ctx, "POST", url, jsonPayload, false)
+	if err != nil {
+		c.logError(fmt.Sprintf("Error sending request for chat completion: %v", err))
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(resp)
+		c.logError(fmt.Sprintf("Chat completion failed: %v", apiErr))
+		return nil, fmt.Errorf("chat completion failed: %w", apiErr)
+	}
+
+	var completion ChatCompletionResponse
+	if err := json.Unmarshal(resp.Body, &completion); err != nil {
+		c.logError(fmt.Sprintf("Failed to unmarshal chat completion response: %v, body: %s", err, string(resp.Body)))
+		return nil, fmt.Errorf("failed to unmarshal chat completion response: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("chat completion %s returned no choices", completion.ID)
+	}
+	return &completion, nil
+}
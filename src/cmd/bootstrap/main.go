@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	inbound "process-inbound-email/src"
+)
+
+// handleRequest accepts SES, S3, SNS and SQS triggers; see inbound.Pipeline.HandleEvent.
+// SQS batches are answered with an events.SQSEventResponse listing only the failed messages.
+func handleRequest(ctx context.Context, event json.RawMessage) (interface{}, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("eu-west-1"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	routes, err := inbound.LoadRoutingTable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routing table: %w", err)
+	}
+
+	prices, err := inbound.PriceTableFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	catalogue, err := inbound.CatalogueFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	picker, err := inbound.ProductPickerFromEnv(catalogue)
+	if err != nil {
+		return nil, err
+	}
+	fallback, err := inbound.RulePickerFromEnv(catalogue)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := inbound.RedactorFromEnv(catalogue)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := &inbound.Pipeline{
+		Routes:    routes,
+		Store:     &inbound.S3Store{Client: s3.New(sess), Bucket: "databater-emails-recieved"},
+		Picker:    picker,
+		Prices:    prices,
+		Validator: inbound.PickValidatorFromEnv(catalogue),
+		Fallback:  fallback,
+		Redactor:  redactor,
+	}
+	defer pipeline.LogUsage()
+
+	if inbound.IsSQSEvent(event) {
+		var sqsEvent events.SQSEvent
+		if err := json.Unmarshal(event, &sqsEvent); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal SQS event: %w", err)
+		}
+		batch, err := inbound.NewSQSBatchHandler(pipeline, sqs.New(sess))
+		if err != nil {
+			return nil, err
+		}
+		return batch.Handle(ctx, sqsEvent), nil
+	}
+
+	return nil, pipeline.HandleEvent(ctx, event)
+}
+
+func main() {
+	lambda.Start(handleRequest)
+}
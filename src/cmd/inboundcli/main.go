@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	inbound "process-inbound-email/src"
+)
+
+const cliUsage = `usage: inboundcli <command> [flags] [paths...]
+
+commands:
+  parse     parse .eml/.mbox files or directories and print EmailContent as JSON
+  simulate  run the pipeline against local emails as if SES had delivered them
+  backfill  run historical mbox/Maildir exports through the pipeline with checkpoints
+  assistant create or update the OpenAI assistant from a definition file and print its ID
+  catalogue-sync  push a catalogue export (CSV/JSON) into a vector store, uploading only changed products
+`
+
+func main() {
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+// runCLI runs the local debugging commands and returns the process exit code.
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "parse":
+		err = cliParse(args[1:])
+	case "simulate":
+		err = cliSimulate(args[1:])
+	case "backfill":
+		err = cliBackfill(args[1:])
+	case "assistant":
+		err = cliAssistant(args[1:])
+	case "catalogue-sync":
+		err = cliCatalogueSync(args[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, cliUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], cliUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type parsedEmail struct {
+	Source string                `json:"source"`
+	Email  *inbound.EmailContent `json:"email,omitempty"`
+	Error  string                `json:"error,omitempty"`
+}
+
+func cliParse(args []string) error {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	mboxFormat := flags.String("mbox-format", "mboxrd", "mbox quoting variant: mboxrd, mboxo, mboxcl or mboxcl2")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	format, err := inbound.ParseMboxFormat(*mboxFormat)
+	if err != nil {
+		return err
+	}
+
+	sources, err := inbound.CollectMailSources(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return inbound.EachLocalMessage(sources, format, func(m *inbound.MailboxMessage) error {
+		out := parsedEmail{Source: m.ID}
+		msg, err := inbound.ParseEmailBody(bytes.NewReader(m.Raw))
+		if err != nil {
+			out.Error = err.Error()
+		} else {
+			out.Email = msg
+		}
+		return encoder.Encode(out)
+	})
+}
+
+func cliSimulate(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	eventFile := flags.String("event", "", "SES, S3, SNS or SQS event JSON to replay; object keys are looked up as files in -dir")
+	dir := flags.String("dir", ".", "directory holding the raw emails referenced by -event")
+	useAssistant := flags.Bool("assistant", false, "call the configured LLM backend (LLM_BACKEND) instead of a fake")
+	fakeReply := flags.String("fake-reply", "fake assistant reply", "reply returned by the fake assistant")
+	mboxFormat := flags.String("mbox-format", "mboxrd", "mbox quoting variant: mboxrd, mboxo, mboxcl or mboxcl2")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	format, err := inbound.ParseMboxFormat(*mboxFormat)
+	if err != nil {
+		return err
+	}
+
+	pipeline, err := localPipeline(*useAssistant, *fakeReply)
+	if err != nil {
+		return err
+	}
+	defer pipeline.LogUsage()
+	ctx := context.Background()
+
+	if *eventFile != "" {
+		b, err := os.ReadFile(*eventFile)
+		if err != nil {
+			return fmt.Errorf("failed to read event %s: %w", *eventFile, err)
+		}
+		pipeline.Store = &inbound.DirStore{Dir: *dir}
+		if !inbound.IsSQSEvent(b) {
+			return pipeline.HandleEvent(ctx, b)
+		}
+
+		var sqsEvent events.SQSEvent
+		if err := json.Unmarshal(b, &sqsEvent); err != nil {
+			return fmt.Errorf("failed to unmarshal SQS event: %w", err)
+		}
+		batch, err := inbound.NewSQSBatchHandler(pipeline, nil)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(batch.Handle(ctx, sqsEvent))
+	}
+
+	sources, err := inbound.CollectMailSources(flags.Args())
+	if err != nil {
+		return err
+	}
+	messages := map[string][]byte{}
+	pipeline.Store = inbound.MapStore(messages)
+
+	return inbound.EachLocalMessage(sources, format, func(m *inbound.MailboxMessage) error {
+		msg, err := inbound.ParseEmailBody(bytes.NewReader(m.Raw))
+		if err != nil {
+			return fmt.Errorf("parse email %s: %w", m.ID, err)
+		}
+		messages[m.ID] = m.Raw
+		return pipeline.HandleSES(ctx, inbound.SimulatedSESEvent(m.ID, msg))
+	})
+}
+
+func cliBackfill(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	workers := flags.Int("workers", 4, "number of emails processed concurrently")
+	checkpoint := flags.String("checkpoint", "backfill.checkpoint", "file recording finished message IDs; rerun with the same file to resume")
+	progress := flags.Duration("progress", 10*time.Second, "how often to log progress")
+	useAssistant := flags.Bool("assistant", false, "call the configured LLM backend (LLM_BACKEND) instead of a fake")
+	fakeReply := flags.String("fake-reply", "fake assistant reply", "reply returned by the fake assistant")
+	mboxFormat := flags.String("mbox-format", "mboxrd", "mbox quoting variant: mboxrd, mboxo, mboxcl or mboxcl2")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	format, err := inbound.ParseMboxFormat(*mboxFormat)
+	if err != nil {
+		return err
+	}
+
+	sources, err := inbound.CollectMailSources(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	pipeline, err := localPipeline(*useAssistant, *fakeReply)
+	if err != nil {
+		return err
+	}
+	defer pipeline.LogUsage()
+
+	backfill := &inbound.Backfill{
+		Pipeline:      pipeline,
+		Workers:       *workers,
+		Checkpoint:    *checkpoint,
+		ProgressEvery: *progress,
+		MboxFormat:    format,
+	}
+	stats, err := backfill.Run(context.Background(), sources)
+	if err != nil {
+		return err
+	}
+	if stats.Failed > 0 {
+		return fmt.Errorf("%d emails failed; rerun to retry them", stats.Failed)
+	}
+	return nil
+}
+
+func cliAssistant(args []string) error {
+	flags := flag.NewFlagSet("assistant", flag.ContinueOnError)
+	definitionFile := flags.String("definition", "assistant.json", "assistant definition JSON file")
+	assistantID := flags.String("id", os.Getenv("ASSISTANT_PRODUCT_PICKER"), "assistant to sync; empty looks it up by the definition's name")
+	check := flags.Bool("check", false, "only report drift, failing if the assistant doesn't match")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	definition, err := inbound.LoadAssistantDefinition(*definitionFile)
+	if err != nil {
+		return err
+	}
+	openAIKey, err := inbound.GetOpenAICredential()
+	if err != nil {
+		return err
+	}
+
+	client := inbound.NewAssistantsClient(openAIKey, inbound.AssistantOptionsFromEnv()...)
+	result, err := client.SyncAssistant(context.Background(), definition, *assistantID, !*check)
+	if err != nil {
+		return err
+	}
+
+	for _, drift := range result.Drift {
+		fmt.Fprintf(os.Stderr, "drift: %s\n", drift)
+	}
+	switch {
+	case result.Created:
+		fmt.Fprintf(os.Stderr, "created assistant %s\n", result.ID)
+	case result.Updated:
+		fmt.Fprintf(os.Stderr, "updated assistant %s\n", result.ID)
+	case *check && len(result.Drift) > 0:
+		return fmt.Errorf("assistant %q does not match %s", definition.Name, *definitionFile)
+	}
+	fmt.Println(result.ID)
+	return nil
+}
+
+func cliCatalogueSync(args []string) error {
+	flags := flag.NewFlagSet("catalogue-sync", flag.ContinueOnError)
+	catalogueFile := flags.String("catalogue", os.Getenv("CATALOGUE_FILE"), "catalogue export, .csv or .json")
+	vectorStoreID := flags.String("vector-store", os.Getenv("VECTOR_STORE_ID"), "vector store to sync; empty finds or creates one called -name")
+	name := flags.String("name", "Product catalogue", "name of the vector store when -vector-store is empty")
+	assistantID := flags.String("attach", "", "assistant to sync from -definition once the catalogue is in its vector store")
+	definitionFile := flags.String("definition", "assistant.json", "assistant definition for -attach, which must declare the vector store")
+	dryRun := flags.Bool("dry-run", false, "only report what would change")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *catalogueFile == "" {
+		return fmt.Errorf("-catalogue or CATALOGUE_FILE is required")
+	}
+
+	catalogue, err := inbound.LoadCatalogue(*catalogueFile)
+	if err != nil {
+		return err
+	}
+	// The assistant is synced from its definition, like the assistant command does, so the
+	// two never disagree about which vector store it searches.
+	var definition *inbound.AssistantDefinition
+	if *assistantID != "" {
+		definition, err = inbound.LoadAssistantDefinition(*definitionFile)
+		if err != nil {
+			return err
+		}
+		if len(definition.VectorStoreIDs) == 0 {
+			return fmt.Errorf("%s declares no vector_store_ids to attach", *definitionFile)
+		}
+		if *vectorStoreID == "" {
+			*vectorStoreID = definition.VectorStoreIDs[0]
+		}
+		if !slices.Contains(definition.VectorStoreIDs, *vectorStoreID) {
+			return fmt.Errorf("vector store %s is not in the vector_store_ids of %s", *vectorStoreID, *definitionFile)
+		}
+	}
+	openAIKey, err := inbound.GetOpenAICredential()
+	if err != nil {
+		return err
+	}
+	client := inbound.NewAssistantsClient(openAIKey, inbound.AssistantOptionsFromEnv()...)
+	ctx := context.Background()
+
+	if *vectorStoreID == "" {
+		store, err := client.FindVectorStore(ctx, *name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case store != nil:
+			*vectorStoreID = store.ID
+		case *dryRun:
+			fmt.Fprintf(os.Stderr, "would create vector store %q and add %d products\n", *name, len(catalogue.Products))
+			return nil
+		default:
+			store, err = client.CreateVectorStore(ctx, *name, nil)
+			if err != nil {
+				return err
+			}
+			*vectorStoreID = store.ID
+			fmt.Fprintf(os.Stderr, "created vector store %s\n", store.ID)
+		}
+	}
+
+	stats, err := client.SyncCatalogue(ctx, *vectorStoreID, catalogue, *dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d unchanged, %d added, %d updated, %d removed, %d failed\n", stats.Unchanged, stats.Added, stats.Updated, stats.Removed, stats.Failed)
+
+	if definition != nil && !*dryRun {
+		result, err := client.SyncAssistant(ctx, definition, *assistantID, true)
+		if err != nil {
+			return err
+		}
+		if result.Updated {
+			fmt.Fprintf(os.Stderr, "updated assistant %s\n", result.ID)
+		}
+	}
+	fmt.Println(*vectorStoreID)
+	if stats.Failed > 0 {
+		return fmt.Errorf("%d products failed; rerun to retry them", stats.Failed)
+	}
+	return nil
+}
+
+// localPipeline builds a Pipeline for CLI runs, answering with a fake unless useAssistant is set.
+func localPipeline(useAssistant bool, fakeReply string) (*inbound.Pipeline, error) {
+	routes, err := inbound.LoadRoutingTable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routing table: %w", err)
+	}
+
+	prices, err := inbound.PriceTableFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	catalogue, err := inbound.CatalogueFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	fallback, err := inbound.RulePickerFromEnv(catalogue)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := inbound.RedactorFromEnv(catalogue)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := &inbound.Pipeline{
+		Routes:    routes,
+		Picker:    &inbound.FakePicker{Reply: fakeReply},
+		Prices:    prices,
+		Validator: inbound.PickValidatorFromEnv(catalogue),
+		Fallback:  fallback,
+		Redactor:  redactor,
+	}
+	if useAssistant {
+		pipeline.Picker, err = inbound.ProductPickerFromEnv(catalogue)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCLIOutput runs the CLI with args and returns its exit code and what it wrote to stdout.
+func runCLIOutput(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	code := runCLI(args)
+	w.Close()
+	return code, <-out
+}
+
+// localEnv clears the settings that would make a local run reach OpenAI or AWS.
+func localEnv(t *testing.T) {
+	for _, name := range []string{"ROUTING_TABLE", "ROUTING_TABLE_FILE", "CATALOGUE_FILE", "MODEL_PRICES", "MODEL_PRICES_FILE", "REDACT_PATTERNS", "REDACT_PATTERNS_FILE", "METRICS_NAMESPACE", "AWS_LAMBDA_FUNCTION_NAME"} {
+		t.Setenv(name, "")
+	}
+}
+
+const testEmail = "From: Jo <jo@example.com>\r\nTo: orders@example.com\r\nSubject: Widgets\r\n\r\n5 x Blue Widget\r\n"
+
+func TestRunCLI(t *testing.T) {
+	localEnv(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "order.eml"), []byte(testEmail), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mbox := "From jo@example.com Mon Jan  1 00:00:00 2024\n" + strings.ReplaceAll(testEmail, "\r\n", "\n") +
+		"\nFrom jo@example.com Mon Jan  1 00:00:01 2024\n" + strings.ReplaceAll(testEmail, "\r\n", "\n")
+	if err := os.WriteFile(filepath.Join(dir, "archive.mbox"), []byte(mbox), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	event := `{"Records":[{"eventSource":"aws:ses","ses":{"mail":{"messageId":"order.eml"},"receipt":{"recipients":["orders@example.com"]}}}]}`
+	if err := os.WriteFile(filepath.Join(dir, "event.json"), []byte(event), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	definition := `{"name": "Picker", "model": "gpt-4o", "instructions": "x", "tools": [{"type": "file_search"}], "vector_store_ids": ["vs_1"]}`
+	if err := os.WriteFile(filepath.Join(dir, "assistant.json"), []byte(definition), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "catalogue.csv"), []byte("sku,name\nBW-100,Blue Widget\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sqsEvent := `{"Records":[{"eventSource":"aws:sqs","messageId":"q1","body":` + quote(t, event) + `},` +
+		`{"eventSource":"aws:sqs","messageId":"q2","body":` + quote(t, strings.ReplaceAll(event, "order.eml", "missing.eml")) + `}]}`
+	if err := os.WriteFile(filepath.Join(dir, "sqs.json"), []byte(sqsEvent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		want string // Expected in stdout
+	}{
+		{name: "no command", code: 2},
+		{name: "unknown command", args: []string{"frobnicate"}, code: 2},
+		{name: "help", args: []string{"help"}, code: 0, want: "usage: inboundcli"},
+		{name: "parse without paths", args: []string{"parse"}, code: 1},
+		{name: "parse with a bad mbox format", args: []string{"parse", "-mbox-format", "maildir", dir}, code: 1},
+		{name: "parse a directory", args: []string{"parse", dir}, code: 0, want: `"subject": "Widgets"`},
+		{name: "simulate emails", args: []string{"simulate", filepath.Join(dir, "order.eml")}, code: 0},
+		{name: "simulate an SES event", args: []string{"simulate", "-event", filepath.Join(dir, "event.json"), "-dir", dir}, code: 0},
+		{name: "simulate an SQS event", args: []string{"simulate", "-event", filepath.Join(dir, "sqs.json"), "-dir", dir}, code: 0, want: `"itemIdentifier": "q2"`},
+		{name: "simulate a missing event", args: []string{"simulate", "-event", filepath.Join(dir, "missing.json")}, code: 1},
+		{name: "catalogue sync without a catalogue", args: []string{"catalogue-sync"}, code: 1},
+		{name: "catalogue sync attaching a store the definition lacks", args: []string{"catalogue-sync", "-catalogue", filepath.Join(dir, "catalogue.csv"), "-definition", filepath.Join(dir, "assistant.json"), "-vector-store", "vs_other", "-attach", "asst_1"}, code: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, out := runCLIOutput(t, tt.args...)
+			if code != tt.code {
+				t.Errorf("runCLI(%q) = %d, want %d", tt.args, code, tt.code)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("runCLI(%q) printed %q, want it to contain %q", tt.args, out, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	localEnv(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "order.eml")
+	if err := os.WriteFile(path, []byte(testEmail), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, out := runCLIOutput(t, "parse", path)
+	if code != 0 {
+		t.Fatalf("parse exited with %d", code)
+	}
+	var parsed parsedEmail
+	if err := json.Unmarshal([]byte(out), &parsed); err != nil {
+		t.Fatalf("parse printed %q: %v", out, err)
+	}
+	if parsed.Source != path || parsed.Email == nil || parsed.Email.From != "Jo <jo@example.com>" || strings.TrimSpace(parsed.Email.PlainText) != "5 x Blue Widget" {
+		t.Errorf("parse printed %+v", parsed)
+	}
+}
+
+func quote(t *testing.T, s string) string {
+	t.Helper()
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,266 @@
+package inbound
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// InboundEmail is a received email as described by whichever trigger delivered it.
+type InboundEmail struct {
+	Source     string // Trigger that delivered it, e.g. "aws:ses" or "aws:sqs/aws:sns"
+	MessageID  string
+	Recipients []string
+	Raw        []byte // Inline MIME content, when the notification carried it
+	Bucket     string // Otherwise, where to fetch it from. Empty means the store's default bucket.
+	Key        string
+}
+
+// sesNotification is the SES receipt notification published to SNS by an SNS or S3 action.
+type sesNotification struct {
+	NotificationType string                    `json:"notificationType"`
+	Mail             events.SimpleEmailMessage `json:"mail"`
+	Receipt          struct {
+		Recipients []string `json:"recipients"`
+		Action     struct {
+			Type       string `json:"type"`
+			BucketName string `json:"bucketName"`
+			ObjectKey  string `json:"objectKey"`
+			Encoding   string `json:"encoding"` // BASE64 or UTF8, SNS actions only
+		} `json:"action"`
+	} `json:"receipt"`
+	Content string `json:"content"`
+}
+
+// snsEnvelope is an SNS message as delivered to SQS without raw message delivery.
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// eventProbe is just enough of any Lambda event to tell them apart.
+type eventProbe struct {
+	Records []struct {
+		EventSource string `json:"eventSource"` // SNS records spell this EventSource; json matching is case-insensitive
+	} `json:"Records"`
+	NotificationType string `json:"notificationType"`
+	Type             string `json:"Type"`
+	Event            string `json:"Event"`
+}
+
+// HandleEvent accepts a direct SES event, an S3 ObjectCreated event, an SNS event carrying an SES
+// notification or S3 event, or an SQS event wrapping any of those, and processes every email in it.
+func (p *Pipeline) HandleEvent(ctx context.Context, payload []byte) error {
+	emails, err := inboundFromJSON(payload, "")
+	if err != nil {
+		return err
+	}
+	return p.handleInbound(ctx, emails)
+}
+
+// IsSQSEvent reports whether payload is an SQS event, which is answered with a batch response.
+func IsSQSEvent(payload []byte) bool {
+	var probe eventProbe
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return false
+	}
+	return len(probe.Records) > 0 && probe.Records[0].EventSource == "aws:sqs"
+}
+
+// inboundFromJSON detects the shape of payload and extracts the emails it refers to.
+// via records the triggers already unwrapped, for logging.
+func inboundFromJSON(payload []byte, via string) ([]*InboundEmail, error) {
+	var probe eventProbe
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+
+	switch {
+	case len(probe.Records) > 0:
+		switch source := probe.Records[0].EventSource; source {
+		case "aws:ses":
+			var sesEvent events.SimpleEmailEvent
+			if err := json.Unmarshal(payload, &sesEvent); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal SES event: %w", err)
+			}
+			return inboundFromSES(sesEvent), nil
+		case "aws:s3":
+			var s3Event events.S3Event
+			if err := json.Unmarshal(payload, &s3Event); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal S3 event: %w", err)
+			}
+			return inboundFromS3(s3Event, via+source)
+		case "aws:sns":
+			var snsEvent events.SNSEvent
+			if err := json.Unmarshal(payload, &snsEvent); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal SNS event: %w", err)
+			}
+			var emails []*InboundEmail
+			for _, record := range snsEvent.Records {
+				found, err := inboundFromJSON([]byte(record.SNS.Message), via+source+"/")
+				if err != nil {
+					return nil, fmt.Errorf("SNS message %s: %w", record.SNS.MessageID, err)
+				}
+				emails = append(emails, found...)
+			}
+			return emails, nil
+		case "aws:sqs":
+			var sqsEvent events.SQSEvent
+			if err := json.Unmarshal(payload, &sqsEvent); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal SQS event: %w", err)
+			}
+			var emails []*InboundEmail
+			for _, record := range sqsEvent.Records {
+				found, err := inboundFromSQS(record, via)
+				if err != nil {
+					return nil, err
+				}
+				emails = append(emails, found...)
+			}
+			return emails, nil
+		default:
+			return nil, fmt.Errorf("unsupported event source %q", source)
+		}
+
+	case probe.Type == "Notification":
+		var envelope snsEnvelope
+		if err := json.Unmarshal(payload, &envelope); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal SNS envelope: %w", err)
+		}
+		return inboundFromJSON([]byte(envelope.Message), via+"aws:sns/")
+
+	case probe.NotificationType != "":
+		var notification sesNotification
+		if err := json.Unmarshal(payload, &notification); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal SES notification: %w", err)
+		}
+		email, err := inboundFromSESNotification(&notification, via+"aws:ses")
+		if err != nil || email == nil {
+			return nil, err
+		}
+		return []*InboundEmail{email}, nil
+
+	case probe.Event == "s3:TestEvent" || probe.Type == "SubscriptionConfirmation":
+		log.Printf("Ignoring %s%s%s test/confirmation message", via, probe.Event, probe.Type)
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unrecognised event payload")
+}
+
+// inboundFromSQS unwraps one SQS message body, which may be an SNS envelope (or raw SNS delivery).
+func inboundFromSQS(record events.SQSMessage, via string) ([]*InboundEmail, error) {
+	emails, err := inboundFromJSON([]byte(record.Body), via+"aws:sqs/")
+	if err != nil {
+		return nil, fmt.Errorf("SQS message %s: %w", record.MessageId, err)
+	}
+	return emails, nil
+}
+
+func inboundFromSES(sesEvent events.SimpleEmailEvent) []*InboundEmail {
+	emails := make([]*InboundEmail, 0, len(sesEvent.Records))
+	for _, record := range sesEvent.Records {
+		sesMail := record.SES.Mail
+		sesReceipt := record.SES.Receipt
+
+		// Recipients are personal data, so only the verdicts are logged.
+		log.Printf("[%s - %s] Mail = %s, Spam = %s, Virus = %s, SPF = %s, DKIM = %s, DMARC = %s\n", record.EventVersion, record.EventSource, sesMail.MessageID,
+			sesReceipt.SpamVerdict.Status, sesReceipt.VirusVerdict.Status, sesReceipt.SPFVerdict.Status, sesReceipt.DKIMVerdict.Status, sesReceipt.DMARCVerdict.Status)
+
+		recipients := sesReceipt.Recipients
+		if len(recipients) == 0 {
+			recipients = sesMail.Destination
+		}
+		emails = append(emails, &InboundEmail{
+			Source:     record.EventSource,
+			MessageID:  sesMail.MessageID,
+			Recipients: recipients,
+			Key:        sesMail.MessageID,
+		})
+	}
+	return emails
+}
+
+func inboundFromS3(s3Event events.S3Event, via string) ([]*InboundEmail, error) {
+	var emails []*InboundEmail
+	for _, record := range s3Event.Records {
+		// Object keys arrive URL encoded, with spaces as '+'.
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode S3 key %q: %w", record.S3.Object.Key, err)
+		}
+		log.Printf("[%s] %s for s3://%s/%s\n", via, record.EventName, record.S3.Bucket.Name, key)
+
+		emails = append(emails, &InboundEmail{
+			Source: via,
+			Bucket: record.S3.Bucket.Name,
+			Key:    key,
+		})
+	}
+	return emails, nil
+}
+
+// inboundFromSESNotification handles "Received" notifications. SNS actions inline content up to
+// 150KB; S3 actions point at the stored object instead.
+func inboundFromSESNotification(n *sesNotification, via string) (*InboundEmail, error) {
+	if n.NotificationType != "Received" {
+		log.Printf("Ignoring SES %s notification for %s", n.NotificationType, n.Mail.MessageID)
+		return nil, nil
+	}
+	log.Printf("[%s] Mail = %+v, Action = %s\n", via, n.Mail.MessageID, n.Receipt.Action.Type)
+
+	recipients := n.Receipt.Recipients
+	if len(recipients) == 0 {
+		recipients = n.Mail.Destination
+	}
+	email := &InboundEmail{
+		Source:     via,
+		MessageID:  n.Mail.MessageID,
+		Recipients: recipients,
+		Bucket:     n.Receipt.Action.BucketName,
+		Key:        n.Receipt.Action.ObjectKey,
+	}
+
+	if n.Content != "" {
+		if n.Receipt.Action.Encoding == "BASE64" {
+			raw, err := base64.StdEncoding.DecodeString(n.Content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to base64 decode content of %s: %w", n.Mail.MessageID, err)
+			}
+			email.Raw = raw
+		} else {
+			email.Raw = []byte(n.Content)
+		}
+	} else if email.Key == "" {
+		// Content omitted (too large for SNS) and no S3 action: fall back to the default bucket.
+		email.Key = n.Mail.MessageID
+	}
+	return email, nil
+}
+
+// SimulatedSESEvent builds the SES event a Lambda receipt rule would deliver for msg.
+func SimulatedSESEvent(messageID string, msg *EmailContent) events.SimpleEmailEvent {
+	destination := parseAddressList(msg.To)
+	record := events.SimpleEmailRecord{
+		EventVersion: "1.0",
+		EventSource:  "local:simulate",
+	}
+	record.SES.Mail = events.SimpleEmailMessage{
+		MessageID:   messageID,
+		Source:      strings.Join(parseAddressList(msg.From), ","),
+		Destination: destination,
+		CommonHeaders: events.SimpleEmailCommonHeaders{
+			From:    parseAddressList(msg.From),
+			To:      destination,
+			Subject: msg.Subject,
+		},
+	}
+	record.SES.Receipt.Recipients = destination
+	return events.SimpleEmailEvent{Records: []events.SimpleEmailRecord{record}}
+}
@@ -0,0 +1,217 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func quoteJSON(t *testing.T, s string) string {
+	t.Helper()
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestInboundFromJSON(t *testing.T) {
+	raw := "From: a@example.com\r\nSubject: Hi\r\n\r\nHello"
+	snsActionNotification := `{"notificationType":"Received","mail":{"messageId":"m2","destination":["orders@example.com"]},` +
+		`"receipt":{"recipients":["orders@example.com"],"action":{"type":"SNS","encoding":"BASE64"}},` +
+		`"content":"` + base64.StdEncoding.EncodeToString([]byte(raw)) + `"}`
+	s3ActionNotification := `{"notificationType":"Received","mail":{"messageId":"m3","destination":["to@example.com"]},` +
+		`"receipt":{"recipients":["sales@example.com"],"action":{"type":"S3","bucketName":"mail","objectKey":"inbound/m3"}}}`
+	s3Event := `{"Records":[{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"mail"},"object":{"key":"inbound/a+b%21"}}}]}`
+
+	tests := []struct {
+		name    string
+		payload string
+		want    []*InboundEmail
+		wantErr bool
+	}{
+		{
+			name:    "SES event",
+			payload: `{"Records":[{"eventSource":"aws:ses","eventVersion":"1.0","ses":{"mail":{"messageId":"m1","destination":["to@example.com"]},"receipt":{"recipients":["orders@example.com"]}}}]}`,
+			want:    []*InboundEmail{{Source: "aws:ses", MessageID: "m1", Recipients: []string{"orders@example.com"}, Key: "m1"}},
+		},
+		{
+			name:    "SES event without receipt recipients",
+			payload: `{"Records":[{"eventSource":"aws:ses","ses":{"mail":{"messageId":"m1","destination":["to@example.com"]},"receipt":{}}}]}`,
+			want:    []*InboundEmail{{Source: "aws:ses", MessageID: "m1", Recipients: []string{"to@example.com"}, Key: "m1"}},
+		},
+		{
+			name:    "S3 event with an encoded key",
+			payload: s3Event,
+			want:    []*InboundEmail{{Source: "aws:s3", Bucket: "mail", Key: "inbound/a b!"}},
+		},
+		{
+			name:    "SES notification from an SNS action",
+			payload: snsActionNotification,
+			want:    []*InboundEmail{{Source: "aws:ses", MessageID: "m2", Recipients: []string{"orders@example.com"}, Raw: []byte(raw)}},
+		},
+		{
+			name:    "SES notification with UTF8 content",
+			payload: `{"notificationType":"Received","mail":{"messageId":"m4"},"receipt":{"recipients":["a@example.com"],"action":{"type":"SNS","encoding":"UTF8"}},"content":"Subject: Hi\r\n\r\nHello"}`,
+			want:    []*InboundEmail{{Source: "aws:ses", MessageID: "m4", Recipients: []string{"a@example.com"}, Raw: []byte("Subject: Hi\r\n\r\nHello")}},
+		},
+		{
+			name:    "SES notification from an S3 action",
+			payload: s3ActionNotification,
+			want:    []*InboundEmail{{Source: "aws:ses", MessageID: "m3", Recipients: []string{"sales@example.com"}, Bucket: "mail", Key: "inbound/m3"}},
+		},
+		{
+			name:    "SES notification too large for SNS",
+			payload: `{"notificationType":"Received","mail":{"messageId":"m5"},"receipt":{"recipients":["a@example.com"],"action":{"type":"SNS"}}}`,
+			want:    []*InboundEmail{{Source: "aws:ses", MessageID: "m5", Recipients: []string{"a@example.com"}, Key: "m5"}},
+		},
+		{
+			name:    "SES bounce notification",
+			payload: `{"notificationType":"Bounce","mail":{"messageId":"m6"}}`,
+		},
+		{
+			name:    "SNS event carrying an SES notification",
+			payload: `{"Records":[{"EventSource":"aws:sns","Sns":{"MessageId":"s1","Message":` + quoteJSON(t, s3ActionNotification) + `}}]}`,
+			want:    []*InboundEmail{{Source: "aws:sns/aws:ses", MessageID: "m3", Recipients: []string{"sales@example.com"}, Bucket: "mail", Key: "inbound/m3"}},
+		},
+		{
+			name:    "SNS event carrying an S3 event",
+			payload: `{"Records":[{"EventSource":"aws:sns","Sns":{"MessageId":"s1","Message":` + quoteJSON(t, s3Event) + `}}]}`,
+			want:    []*InboundEmail{{Source: "aws:sns/aws:s3", Bucket: "mail", Key: "inbound/a b!"}},
+		},
+		{
+			name:    "SQS event wrapping an SNS envelope",
+			payload: `{"Records":[{"eventSource":"aws:sqs","messageId":"q1","body":` + quoteJSON(t, `{"Type":"Notification","Message":`+quoteJSON(t, snsActionNotification)+`}`) + `}]}`,
+			want:    []*InboundEmail{{Source: "aws:sqs/aws:sns/aws:ses", MessageID: "m2", Recipients: []string{"orders@example.com"}, Raw: []byte(raw)}},
+		},
+		{
+			name:    "SQS event with raw SNS delivery",
+			payload: `{"Records":[{"eventSource":"aws:sqs","messageId":"q1","body":` + quoteJSON(t, s3ActionNotification) + `}]}`,
+			want:    []*InboundEmail{{Source: "aws:sqs/aws:ses", MessageID: "m3", Recipients: []string{"sales@example.com"}, Bucket: "mail", Key: "inbound/m3"}},
+		},
+		{
+			name:    "SQS event wrapping an S3 event",
+			payload: `{"Records":[{"eventSource":"aws:sqs","messageId":"q1","body":` + quoteJSON(t, s3Event) + `}]}`,
+			want:    []*InboundEmail{{Source: "aws:sqs/aws:s3", Bucket: "mail", Key: "inbound/a b!"}},
+		},
+		{
+			name:    "S3 test event",
+			payload: `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"mail"}`,
+		},
+		{
+			name:    "SNS subscription confirmation",
+			payload: `{"Type":"SubscriptionConfirmation","SubscribeURL":"https://example.com"}`,
+		},
+		{
+			name:    "unsupported event source",
+			payload: `{"Records":[{"eventSource":"aws:dynamodb"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unrecognised payload",
+			payload: `{"hello":"world"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			payload: `{`,
+			wantErr: true,
+		},
+		{
+			name:    "bad base64 content",
+			payload: `{"notificationType":"Received","mail":{"messageId":"m7"},"receipt":{"action":{"type":"SNS","encoding":"BASE64"}},"content":"%%%"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inboundFromJSON([]byte(tt.payload), "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inboundFromJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inboundFromJSON() =")
+				for _, email := range got {
+					t.Errorf("  got  %+v", *email)
+				}
+				for _, email := range tt.want {
+					t.Errorf("  want %+v", *email)
+				}
+			}
+		})
+	}
+}
+
+func TestInboundFromSESLogsNoRecipients(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	event := `{"Records": [{"eventVersion": "1.0", "eventSource": "aws:ses", "ses": {
+		"mail": {"messageId": "m1", "destination": ["jo@example.com"]},
+		"receipt": {"recipients": ["orders@example.com"], "spamVerdict": {"status": "PASS"}, "virusVerdict": {"status": "PASS"},
+			"spfVerdict": {"status": "PASS"}, "dkimVerdict": {"status": "GRAY"}, "dmarcVerdict": {"status": "FAIL"}}
+	}}]}`
+	emails, err := inboundFromJSON([]byte(event), "")
+	if err != nil || len(emails) != 1 || !reflect.DeepEqual(emails[0].Recipients, []string{"orders@example.com"}) {
+		t.Fatalf("inboundFromJSON() = %v, %v", emails, err)
+	}
+	if strings.Contains(logged.String(), "@") {
+		t.Errorf("logged %q, want no addresses", logged.String())
+	}
+	if !strings.Contains(logged.String(), "Mail = m1, Spam = PASS, Virus = PASS, SPF = PASS, DKIM = GRAY, DMARC = FAIL") {
+		t.Errorf("logged %q, want the message ID and verdicts", logged.String())
+	}
+}
+
+func TestIsSQSEvent(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    bool
+	}{
+		{`{"Records":[{"eventSource":"aws:sqs","body":"{}"}]}`, true},
+		{`{"Records":[{"eventSource":"aws:ses"}]}`, false},
+		{`{"Records":[]}`, false},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		if got := IsSQSEvent([]byte(tt.payload)); got != tt.want {
+			t.Errorf("IsSQSEvent(%s) = %v, want %v", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	var got []string
+	pipeline := testPipeline(t, func(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+		got = append(got, messageID+": "+msg.Subject)
+		return &Answer{Text: "ok"}, nil
+	})
+	pipeline.Store = MapStore{"inbound/m1": []byte("Subject: stored\r\n\r\nHi\r\n")}
+
+	s3Event := `{"Records":[{"eventSource":"aws:s3","s3":{"bucket":{"name":"mail"},"object":{"key":"inbound/m1"}}}]}`
+	notification := `{"notificationType":"Received","mail":{"messageId":"m2"},"receipt":{"action":{"type":"SNS","encoding":"UTF8"}},"content":"Subject: inline\r\n\r\nHi"}`
+	for _, payload := range []string{s3Event, notification} {
+		if err := pipeline.HandleEvent(context.Background(), []byte(payload)); err != nil {
+			t.Fatalf("HandleEvent() error = %v", err)
+		}
+	}
+	if want := []string{"inbound/m1: stored", "m2: inline"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+
+	missing := `{"Records":[{"eventSource":"aws:s3","s3":{"bucket":{"name":"mail"},"object":{"key":"inbound/gone"}}}]}`
+	if err := pipeline.HandleEvent(context.Background(), []byte(missing)); err == nil {
+		t.Errorf("HandleEvent() for a missing object succeeded")
+	}
+}
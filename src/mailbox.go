@@ -0,0 +1,295 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MboxFormat selects how From_ lines inside message bodies were quoted when the mbox was written.
+type MboxFormat int
+
+const (
+	MboxRD  MboxFormat = iota // ">From ", ">>From " ... each lose one '>'
+	MboxO                     // only ">From " is unquoted, deeper quoting is left alone
+	MboxCL                    // Content-Length header delimits the body; ">From " is unquoted
+	MboxCL2                   // Content-Length header delimits the body; no quoting at all
+)
+
+var mboxrdQuoted = regexp.MustCompile(`^>+From `)
+
+// ParseMboxFormat maps a flag value such as "mboxrd" onto a MboxFormat.
+func ParseMboxFormat(name string) (MboxFormat, error) {
+	switch strings.ToLower(name) {
+	case "", "mboxrd":
+		return MboxRD, nil
+	case "mboxo":
+		return MboxO, nil
+	case "mboxcl":
+		return MboxCL, nil
+	case "mboxcl2":
+		return MboxCL2, nil
+	}
+	return 0, fmt.Errorf("unknown mbox format %q", name)
+}
+
+// MailboxMessage is one raw message read from a mailbox export.
+type MailboxMessage struct {
+	ID  string // Stable identifier within its source, e.g. "inbox.mbox#3" or a Maildir unique name
+	Raw []byte
+}
+
+// ReadMbox splits an mbox file into messages, calling fn for each one in order.
+// A From_ line only starts a new message at the beginning of the file or after a blank line.
+func ReadMbox(name string, r io.Reader, format MboxFormat, fn func(*MailboxMessage) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	var current *bytes.Buffer
+	inHeaders := false
+	prevBlank := true
+	count := 0
+
+	emit := func() error {
+		if current == nil {
+			return nil
+		}
+		raw := bytes.TrimRight(current.Bytes(), "\r\n")
+		current = nil
+		count++
+		return fn(&MailboxMessage{ID: fmt.Sprintf("%s#%d", name, count), Raw: append(raw, '\n')})
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to read mbox %s: %w", name, err)
+		}
+		trimmed := bytes.TrimRight(line, "\r\n")
+
+		if prevBlank && bytes.HasPrefix(trimmed, []byte("From ")) {
+			if err := emit(); err != nil {
+				return err
+			}
+			current = &bytes.Buffer{}
+			inHeaders = true
+			prevBlank = false
+			continue
+		}
+		if current == nil {
+			// Anything before the first From_ line isn't part of a message.
+			prevBlank = len(trimmed) == 0
+			continue
+		}
+
+		if inHeaders {
+			current.Write(line)
+			if len(trimmed) > 0 {
+				continue
+			}
+			inHeaders = false
+			prevBlank = true
+
+			if format == MboxCL || format == MboxCL2 {
+				if n, ok := mboxContentLength(current.Bytes()); ok {
+					body := make([]byte, n)
+					read, err := io.ReadFull(br, body)
+					body = body[:read]
+					if format == MboxCL {
+						body = unquoteFromLines(body, MboxO)
+					}
+					current.Write(body)
+					if err != nil && err != io.ErrUnexpectedEOF {
+						return fmt.Errorf("failed to read mbox %s body: %w", name, err)
+					}
+					// The body is normally followed by a blank separator line.
+					prevBlank = read == 0 || body[len(body)-1] == '\n'
+				}
+			}
+			continue
+		}
+
+		if format != MboxCL2 {
+			line = unquoteFromLines(line, format)
+		}
+		current.Write(line)
+		prevBlank = len(trimmed) == 0
+	}
+
+	return emit()
+}
+
+// unquoteFromLines strips the From_ quoting the mbox writer added to each line of b.
+func unquoteFromLines(b []byte, format MboxFormat) []byte {
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	for i, line := range lines {
+		switch format {
+		case MboxRD:
+			if mboxrdQuoted.Match(line) {
+				lines[i] = line[1:]
+			}
+		default:
+			if bytes.HasPrefix(line, []byte(">From ")) {
+				lines[i] = line[1:]
+			}
+		}
+	}
+	return bytes.Join(lines, nil)
+}
+
+// mboxContentLength reads the Content-Length header from a block of message headers.
+func mboxContentLength(headers []byte) (int, bool) {
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(headers)))
+	h, err := tp.ReadMIMEHeader()
+	if err != nil && len(h) == 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(h.Get("Content-Length")))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// IsMaildir reports whether dir looks like a Maildir (has cur and new subdirectories).
+func IsMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new"} {
+		info, err := os.Stat(filepath.Join(dir, sub))
+		if err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadMaildir calls fn for every message in a Maildir's new and cur folders, in name order.
+// Message IDs are the Maildir unique names without the ":2,flags" info suffix, so they
+// survive flag changes between runs.
+func ReadMaildir(dir string, fn func(*MailboxMessage) error) error {
+	var names []string
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return fmt.Errorf("failed to read maildir %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			names = append(names, filepath.Join(sub, entry.Name()))
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read maildir message %s: %w", name, err)
+		}
+		unique := filepath.Base(name)
+		if i := strings.Index(unique, ":"); i >= 0 {
+			unique = unique[:i]
+		}
+		if err := fn(&MailboxMessage{ID: dir + "/" + unique, Raw: b}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollectMailSources expands directories into the .eml/.mbox files and Maildirs they contain.
+func CollectMailSources(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .eml, .mbox or Maildir paths given")
+	}
+
+	var sources []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			sources = append(sources, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if IsMaildir(p) {
+					sources = append(sources, p)
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(p)) {
+			case ".eml", ".mbox":
+				sources = append(sources, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// EachLocalMessage calls fn for every message in the given .eml files, mboxes and Maildirs.
+func EachLocalMessage(sources []string, format MboxFormat, fn func(*MailboxMessage) error) error {
+	for _, path := range sources {
+		if IsMaildir(path) {
+			if err := ReadMaildir(path, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isMboxFile(path) {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			err = ReadMbox(path, f, format, fn)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := fn(&MailboxMessage{ID: path, Raw: b}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isMboxFile sniffs for the From_ line every mbox starts with; .eml files start with headers.
+func isMboxFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	prefix := make([]byte, 5)
+	n, _ := io.ReadFull(f, prefix)
+	return string(prefix[:n]) == "From "
+}
@@ -0,0 +1,182 @@
+package inbound
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readMboxString(t *testing.T, mbox string, format MboxFormat) []MailboxMessage {
+	t.Helper()
+	var got []MailboxMessage
+	err := ReadMbox("test.mbox", strings.NewReader(mbox), format, func(m *MailboxMessage) error {
+		got = append(got, *m)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadMbox() error = %v", err)
+	}
+	return got
+}
+
+func TestReadMbox(t *testing.T) {
+	quoted := "From a@example.com Mon Jan  1 00:00:00 2024\n" +
+		"Subject: one\n\n" +
+		"Hi\n>From the team\n>>From the archive\nFrom mid-paragraph stays\n\n" +
+		"From b@example.com Mon Jan  1 00:00:01 2024\n" +
+		"Subject: two\n\nBye\n"
+
+	body1 := "Hi\n\nFrom the team\n>From q\n"
+	body2 := "Bye\n"
+	counted := fmt.Sprintf("From a@example.com Mon Jan  1 00:00:00 2024\nSubject: one\nContent-Length: %d\n\n%s\n", len(body1), body1) +
+		fmt.Sprintf("From b@example.com Mon Jan  1 00:00:01 2024\nSubject: two\nContent-Length: %d\n\n%s", len(body2), body2)
+
+	tests := []struct {
+		name   string
+		mbox   string
+		format MboxFormat
+		want   []string
+	}{
+		{
+			name:   "mboxrd unquotes every level",
+			mbox:   quoted,
+			format: MboxRD,
+			want: []string{
+				"Subject: one\n\nHi\nFrom the team\n>From the archive\nFrom mid-paragraph stays\n",
+				"Subject: two\n\nBye\n",
+			},
+		},
+		{
+			name:   "mboxo unquotes one level only",
+			mbox:   quoted,
+			format: MboxO,
+			want: []string{
+				"Subject: one\n\nHi\nFrom the team\n>>From the archive\nFrom mid-paragraph stays\n",
+				"Subject: two\n\nBye\n",
+			},
+		},
+		{
+			name:   "mboxcl keeps unquoted From_ lines inside Content-Length",
+			mbox:   counted,
+			format: MboxCL,
+			want: []string{
+				fmt.Sprintf("Subject: one\nContent-Length: %d\n\nHi\n\nFrom the team\nFrom q\n", len(body1)),
+				fmt.Sprintf("Subject: two\nContent-Length: %d\n\nBye\n", len(body2)),
+			},
+		},
+		{
+			name:   "mboxcl2 leaves quoting alone",
+			mbox:   counted,
+			format: MboxCL2,
+			want: []string{
+				fmt.Sprintf("Subject: one\nContent-Length: %d\n\nHi\n\nFrom the team\n>From q\n", len(body1)),
+				fmt.Sprintf("Subject: two\nContent-Length: %d\n\nBye\n", len(body2)),
+			},
+		},
+		{
+			name:   "mboxcl without Content-Length splits on From_ lines",
+			mbox:   "From a Mon Jan  1 00:00:00 2024\nSubject: one\n\nHi\n\nFrom b Mon Jan  1 00:00:01 2024\nSubject: two\n\nBye\n",
+			format: MboxCL,
+			want:   []string{"Subject: one\n\nHi\n", "Subject: two\n\nBye\n"},
+		},
+		{
+			name:   "text before the first From_ line is ignored",
+			mbox:   "junk\n\nFrom a Mon Jan  1 00:00:00 2024\nSubject: one\n\nHi\n",
+			format: MboxRD,
+			want:   []string{"Subject: one\n\nHi\n"},
+		},
+		{
+			name:   "CRLF line endings",
+			mbox:   "From a Mon Jan  1 00:00:00 2024\r\nSubject: one\r\n\r\nHi\r\n\r\nFrom b Mon Jan  1 00:00:01 2024\r\nSubject: two\r\n\r\nBye\r\n",
+			format: MboxRD,
+			want:   []string{"Subject: one\r\n\r\nHi\n", "Subject: two\r\n\r\nBye\n"},
+		},
+		{
+			name:   "empty mbox",
+			mbox:   "",
+			format: MboxRD,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readMboxString(t, tt.mbox, tt.format)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ReadMbox() read %d messages, want %d: %q", len(got), len(tt.want), got)
+			}
+			for i, m := range got {
+				if string(m.Raw) != tt.want[i] {
+					t.Errorf("message %d = %q, want %q", i+1, m.Raw, tt.want[i])
+				}
+				if id := fmt.Sprintf("test.mbox#%d", i+1); m.ID != id {
+					t.Errorf("message %d ID = %q, want %q", i+1, m.ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMboxFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    MboxFormat
+		wantErr bool
+	}{
+		{"", MboxRD, false},
+		{"mboxrd", MboxRD, false},
+		{"MBOXO", MboxO, false},
+		{"mboxcl", MboxCL, false},
+		{"mboxcl2", MboxCL2, false},
+		{"maildir", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMboxFormat(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMboxFormat(%q) = %v, %v; want %v, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadMaildir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"cur/1700000000.M1P1.host:2,S": "Subject: seen\n\nOld\n",
+		"new/1700000001.M2P2.host":     "Subject: new\n\nNew\n",
+		"new/.hidden":                  "ignored",
+		"tmp/1700000002.M3P3.host":     "still being delivered",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !IsMaildir(dir) {
+		t.Fatalf("IsMaildir(%s) = false", dir)
+	}
+	if IsMaildir(filepath.Join(dir, "cur")) {
+		t.Errorf("IsMaildir(cur) = true")
+	}
+
+	var got []MailboxMessage
+	if err := ReadMaildir(dir, func(m *MailboxMessage) error {
+		got = append(got, *m)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadMaildir() error = %v", err)
+	}
+	want := []MailboxMessage{
+		{ID: dir + "/1700000000.M1P1.host", Raw: []byte("Subject: seen\n\nOld\n")},
+		{ID: dir + "/1700000001.M2P2.host", Raw: []byte("Subject: new\n\nNew\n")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadMaildir() = %q, want %q", got, want)
+	}
+}
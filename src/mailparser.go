@@ -1,4 +1,4 @@
-package main
+package inbound
 
 import (
 	"bytes"
@@ -14,11 +14,21 @@ import (
 )
 
 type EmailContent struct {
-	PlainText string
-	HTML      string
-	To        string
-	From      string
-	Subject   string
+	PlainText string `json:"plain_text"`
+	HTML      string `json:"html"`
+	To        string `json:"to"`
+	From      string `json:"from"`
+	Subject   string `json:"subject"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file attached to an email, or an inline image.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Data        []byte `json:"-"`
 }
 
 // get RAW shit from an email
@@ -29,6 +39,10 @@ func ParseEmailBody(r io.Reader) (*EmailContent, error) {
 	}
 
 	contentTypeHeader := msg.Header.Get("Content-Type")
+	if contentTypeHeader == "" {
+		// RFC 2045 default, common in older archived mail
+		contentTypeHeader = "text/plain; charset=us-ascii"
+	}
 	mediaType, params, err := mime.ParseMediaType(contentTypeHeader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse Content-Type header: %w", err)
@@ -40,70 +54,8 @@ func ParseEmailBody(r io.Reader) (*EmailContent, error) {
 	emailContent.Subject = msg.Header.Get("Subject")
 
 	if strings.HasPrefix(mediaType, "multipart/") {
-		mr := multipart.NewReader(msg.Body, params["boundary"])
-		for {
-			p, err := mr.NextPart()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return nil, fmt.Errorf("failed to read multipart part: %w", err)
-			}
-
-			partMediaType, partParams, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
-			if err != nil {
-				log.Printf("Warning: Failed to parse part Content-Type: %v", err)
-				continue
-			}
-
-			b, err := io.ReadAll(p)
-			if err != nil {
-				log.Printf("Warning: Failed to read part body: %v", err)
-				continue
-			}
-
-			cte := p.Header.Get("Content-Transfer-Encoding")
-			decodedBytes := b
-			if cte != "" {
-				switch strings.ToLower(cte) {
-				case "base64":
-					decodedBytes, err = io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(b)))
-					if err != nil {
-						log.Printf("Warning: Failed to base64 decode part: %v", err)
-						continue
-					}
-				case "quoted-printable":
-					reader := quotedprintable.NewReader(bytes.NewReader(b))
-					decodedBytes, err = io.ReadAll(reader)
-					if err != nil {
-						return nil, fmt.Errorf("failed to quoted-printable decode: %w", err)
-					}
-				default:
-					log.Printf("Warning: Unhandled Content-Transfer-Encoding: %s", cte)
-				}
-			}
-
-			switch {
-			case strings.HasPrefix(partMediaType, "text/plain"):
-				charset := partParams["charset"]
-				if charset == "" {
-					charset = "utf-8"
-				}
-				emailContent.PlainText = string(decodedBytes)
-
-			case strings.HasPrefix(partMediaType, "text/html"):
-				charset := partParams["charset"]
-				if charset == "" {
-					charset = "utf-8"
-				}
-				emailContent.HTML = string(decodedBytes)
-
-			case strings.HasPrefix(partMediaType, "application/"):
-				log.Printf("Found attachment: %s, Filename: %s", partMediaType, p.FileName())
-
-			default:
-				log.Printf("Ignoring unsupported part type: %s, Filename: %s", partMediaType, p.FileName())
-			}
+		if err := parseMultipart(msg.Body, params["boundary"], emailContent); err != nil {
+			return nil, err
 		}
 	} else {
 		b, err := io.ReadAll(msg.Body)
@@ -143,3 +95,93 @@ func ParseEmailBody(r io.Reader) (*EmailContent, error) {
 
 	return emailContent, nil
 }
+
+// parseMultipart reads the parts of a multipart body into emailContent, descending into nested
+// multiparts such as the multipart/alternative inside a multipart/mixed message with attachments.
+func parseMultipart(r io.Reader, boundary string, emailContent *EmailContent) error {
+	mr := multipart.NewReader(r, boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read multipart part: %w", err)
+		}
+
+		partMediaType, partParams, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if err != nil {
+			log.Printf("Warning: Failed to parse part Content-Type: %v", err)
+			continue
+		}
+
+		if strings.HasPrefix(partMediaType, "multipart/") {
+			if err := parseMultipart(p, partParams["boundary"], emailContent); err != nil {
+				return err
+			}
+			continue
+		}
+
+		b, err := io.ReadAll(p)
+		if err != nil {
+			log.Printf("Warning: Failed to read part body: %v", err)
+			continue
+		}
+
+		cte := p.Header.Get("Content-Transfer-Encoding")
+		decodedBytes := b
+		if cte != "" {
+			switch strings.ToLower(cte) {
+			case "base64":
+				decodedBytes, err = io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(b)))
+				if err != nil {
+					log.Printf("Warning: Failed to base64 decode part: %v", err)
+					continue
+				}
+			case "quoted-printable":
+				reader := quotedprintable.NewReader(bytes.NewReader(b))
+				decodedBytes, err = io.ReadAll(reader)
+				if err != nil {
+					return fmt.Errorf("failed to quoted-printable decode: %w", err)
+				}
+			case "7bit", "8bit", "binary":
+			default:
+				log.Printf("Warning: Unhandled Content-Transfer-Encoding: %s", cte)
+			}
+		}
+
+		disposition, _, _ := mime.ParseMediaType(p.Header.Get("Content-Disposition"))
+		switch {
+		case disposition == "attachment" || p.FileName() != "":
+			emailContent.addAttachment(p.FileName(), partMediaType, decodedBytes)
+
+		case strings.HasPrefix(partMediaType, "text/plain") && emailContent.PlainText == "":
+			emailContent.PlainText = string(decodedBytes)
+
+		case strings.HasPrefix(partMediaType, "text/html") && emailContent.HTML == "":
+			emailContent.HTML = string(decodedBytes)
+
+		case strings.HasPrefix(partMediaType, "application/"), strings.HasPrefix(partMediaType, "image/"):
+			emailContent.addAttachment("", partMediaType, decodedBytes)
+
+		default:
+			log.Printf("Ignoring unsupported part type: %s, Filename: %s", partMediaType, p.FileName())
+		}
+	}
+}
+
+func (e *EmailContent) addAttachment(filename, contentType string, data []byte) {
+	if filename == "" {
+		filename = fmt.Sprintf("attachment-%d", len(e.Attachments)+1)
+		if extensions, _ := mime.ExtensionsByType(contentType); len(extensions) > 0 {
+			filename += extensions[0]
+		}
+	}
+	log.Printf("Found attachment: %s, Filename: %s", contentType, filename)
+	e.Attachments = append(e.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        len(data),
+		Data:        data,
+	})
+}
@@ -0,0 +1,70 @@
+package inbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// Metric is one value for emitMetrics.
+type Metric struct {
+	Name  string
+	Value float64
+	Unit  string // A CloudWatch unit such as "Count" or "None"
+}
+
+// emitMetrics writes metrics in CloudWatch embedded metric format to stdout, which Lambda's log
+// capture turns into CloudWatch metrics under METRICS_NAMESPACE (default "InboundEmail").
+// Outside Lambda it does nothing unless METRICS_NAMESPACE is set.
+func emitMetrics(dimensions map[string]string, metrics ...Metric) {
+	namespace := os.Getenv("METRICS_NAMESPACE")
+	if namespace == "" {
+		if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") == "" {
+			return
+		}
+		namespace = "InboundEmail"
+	}
+
+	dimensionNames := make([]string, 0, len(dimensions))
+	document := map[string]interface{}{}
+	for name, value := range dimensions {
+		dimensionNames = append(dimensionNames, name)
+		document[name] = value
+	}
+	sort.Strings(dimensionNames)
+
+	definitions := make([]map[string]string, 0, len(metrics))
+	for _, metric := range metrics {
+		definitions = append(definitions, map[string]string{"Name": metric.Name, "Unit": metric.Unit})
+		document[metric.Name] = metric.Value
+	}
+
+	document["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  namespace,
+			"Dimensions": [][]string{dimensionNames},
+			"Metrics":    definitions,
+		}},
+	}
+
+	b, err := json.Marshal(document)
+	if err != nil {
+		log.Printf("Failed to marshal metrics: %v\n", err)
+		return
+	}
+	fmt.Println(string(b))
+}
+
+// usageMetrics describes usage and its cost as metrics.
+func usageMetrics(usage ModelUsage, cost float64) []Metric {
+	total := usage.Total()
+	return []Metric{
+		{Name: "PromptTokens", Value: float64(total.PromptTokens), Unit: "Count"},
+		{Name: "CompletionTokens", Value: float64(total.CompletionTokens), Unit: "Count"},
+		{Name: "CostUSD", Value: cost, Unit: "None"},
+	}
+}
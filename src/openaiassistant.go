@@ -1,11 +1,10 @@
-package main
+package inbound
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"os"
 	"time"
@@ -16,15 +15,28 @@ const (
 	OpenAIBetaHeader string = "assistants=v2"
 	SilenceErrors    int    = 1 << 0 // Suppress internal error logging
 	RecallThreadID   int    = 1 << 1 // Attempt to recall an existing thread ID
+	PollRuns         int    = 1 << 2 // Poll for replies instead of streaming runs
 )
 
 type Assistant struct {
-	silenceErrors bool
-	runID         string
-	openAIKey     string
-	assistantID   string
-	threadID      string
-	httpClient    *http.Client
+	openAIClient
+	runID          string
+	assistantID    string
+	instructions   string
+	threadID       string
+	pollOptions    PollOptions
+	pollRuns       bool
+	tools          map[string]*registeredTool
+	storedTools    []Tool // The remote assistant's own tools, once runs need to replace them
+	responseFormat *ResponseFormat
+	lastReply      *Reply
+	usage          ModelUsage
+
+	// Files from AttachFiles
+	uploadedFiles      []string
+	pendingImages      []ImageFile
+	pendingAttachments []MessageAttachment
+	attachmentTools    []string
 }
 
 type OpenAIErrorResponse struct {
@@ -44,12 +56,27 @@ type CreateThreadResponse struct {
 }
 
 type AddMessagePayload struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role        string              `json:"role"`
+	Content     interface{}         `json:"content"` // A string, or []MessageContentPart with images
+	Attachments []MessageAttachment `json:"attachments,omitempty"`
+	Metadata    map[string]string   `json:"metadata,omitempty"`
 }
 
 type RunThreadPayload struct {
-	AssistantID string `json:"assistant_id"`
+	AssistantID            string              `json:"assistant_id"`
+	Model                  string              `json:"model,omitempty"`
+	Instructions           string              `json:"instructions,omitempty"`
+	AdditionalInstructions string              `json:"additional_instructions,omitempty"`
+	Tools                  []Tool              `json:"tools,omitempty"`
+	ToolChoice             interface{}         `json:"tool_choice,omitempty"`
+	ResponseFormat         *ResponseFormat     `json:"response_format,omitempty"`
+	Temperature            *float64            `json:"temperature,omitempty"`
+	TopP                   *float64            `json:"top_p,omitempty"`
+	MaxPromptTokens        int                 `json:"max_prompt_tokens,omitempty"`
+	MaxCompletionTokens    int                 `json:"max_completion_tokens,omitempty"`
+	TruncationStrategy     *TruncationStrategy `json:"truncation_strategy,omitempty"`
+	Metadata               map[string]string   `json:"metadata,omitempty"`
+	Stream                 bool                `json:"stream,omitempty"`
 }
 
 type RunThreadResponse struct {
@@ -63,13 +90,18 @@ type RunThreadResponse struct {
 }
 
 type PollRunResponse struct {
-	ID          string                 `json:"id"`
-	Object      string                 `json:"object"`
-	CreatedAt   int64                  `json:"created_at"`
-	AssistantID string                 `json:"assistant_id"`
-	ThreadID    string                 `json:"thread_id"`
-	Status      string                 `json:"status"`
-	Metadata    map[string]interface{} `json:"metadata"`
+	ID                string                 `json:"id"`
+	Object            string                 `json:"object"`
+	CreatedAt         int64                  `json:"created_at"`
+	AssistantID       string                 `json:"assistant_id"`
+	ThreadID          string                 `json:"thread_id"`
+	Status            string                 `json:"status"`
+	LastError         *RunLastError          `json:"last_error"`
+	IncompleteDetails *RunIncompleteDetails  `json:"incomplete_details"`
+	RequiredAction    *RequiredAction        `json:"required_action"`
+	Model             string                 `json:"model"`
+	Usage             *Usage                 `json:"usage"` // Set once the run has stopped
+	Metadata          map[string]interface{} `json:"metadata"`
 }
 
 type ListMessagesResponse struct {
@@ -81,34 +113,50 @@ type ListMessagesResponse struct {
 }
 
 type Message struct {
-	ID        string                 `json:"id"`
-	Object    string                 `json:"object"`
-	CreatedAt int64                  `json:"created_at"`
-	ThreadID  string                 `json:"thread_id"`
-	Role      string                 `json:"role"`
-	Content   []Content              `json:"content"`
-	Metadata  map[string]interface{} `json:"metadata"`
+	ID          string                 `json:"id"`
+	Object      string                 `json:"object"`
+	CreatedAt   int64                  `json:"created_at"`
+	ThreadID    string                 `json:"thread_id"`
+	Role        string                 `json:"role"`
+	AssistantID string                 `json:"assistant_id"`
+	RunID       string                 `json:"run_id"`
+	Content     []Content              `json:"content"`
+	Metadata    map[string]interface{} `json:"metadata"`
 }
 
 type Content struct {
-	Type string `json:"type"`
-	Text Text   `json:"text"`
+	Type      string     `json:"type"` // "text" or "image_file"
+	Text      Text       `json:"text"`
+	ImageFile *ImageFile `json:"image_file,omitempty"`
 }
 
 type Text struct {
-	Value       string        `json:"value"`
-	Annotations []interface{} `json:"annotations"`
+	Value       string       `json:"value"`
+	Annotations []Annotation `json:"annotations"`
 }
 
 // NewAssistant creates a new Assistant instance.
 // If empty, a new thread will be initialized.
-func NewAssistant(openAIKey, assistantID string, configOptions int, initialThreadID string) (*Assistant, error) {
+func NewAssistant(openAIKey, assistantID string, configOptions int, initialThreadID string, options ...AssistantOption) (*Assistant, error) {
+	return NewAssistantContext(context.Background(), openAIKey, assistantID, configOptions, initialThreadID, options...)
+}
+
+// newAssistant builds an Assistant with defaults and options applied, without creating a thread.
+func newAssistant(openAIKey, assistantID string, configOptions int, options []AssistantOption) *Assistant {
 	a := &Assistant{
-		silenceErrors: (configOptions & SilenceErrors) != 0,
-		openAIKey:     openAIKey,
-		assistantID:   assistantID,
-		httpClient:    &http.Client{Timeout: 30 * time.Second},
-	}
+		openAIClient: newOpenAIClient("Assistant", openAIKey, options),
+		assistantID:  assistantID,
+		pollOptions:  DefaultPollOptions,
+	}
+	a.silenceErrors = (configOptions & SilenceErrors) != 0
+	a.pollRuns = (configOptions & PollRuns) != 0
+	a.beta = OpenAIBetaHeader
+	return a
+}
+
+// NewAssistantContext is NewAssistant with a context bounding the thread creation request.
+func NewAssistantContext(ctx context.Context, openAIKey, assistantID string, configOptions int, initialThreadID string, options ...AssistantOption) (*Assistant, error) {
+	a := newAssistant(openAIKey, assistantID, configOptions, options)
 
 	// If RecallThreadID is set and an initialThreadID is provided, use it.
 	if (configOptions&RecallThreadID != 0) && initialThreadID != "" {
@@ -117,7 +165,7 @@ func NewAssistant(openAIKey, assistantID string, configOptions int, initialThrea
 	}
 
 	// Otherwise, initialize a new thread.
-	if err := a.initialiseThread(); err != nil {
+	if err := a.initialiseThread(ctx); err != nil {
 		return nil, fmt.Errorf("failed to initialize thread: %w", err)
 	}
 
@@ -141,298 +189,313 @@ func GetOpenAICredential() (string, error) {
 }
 
 func (a *Assistant) ResetThread() error {
-	return a.initialiseThread()
+	return a.ResetThreadContext(context.Background())
+}
+
+func (a *Assistant) ResetThreadContext(ctx context.Context) error {
+	return a.initialiseThread(ctx)
 }
 
 func (a *Assistant) SetAssistantID(assistantID string) {
 	a.assistantID = assistantID
+	a.storedTools = nil
 }
 
-// initialiseThread creates a new thread with the OpenAI API and sets the Assistant's threadID.
-func (a *Assistant) initialiseThread() error {
-	url := fmt.Sprintf("%s/v1/threads", BaseURI)
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		a.logError(fmt.Sprintf("Failed to create request for thread initialization: %v", err))
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+a.openAIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("OpenAI-Beta", OpenAIBetaHeader)
-
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
-		a.logError(fmt.Sprintf("Error sending request to initialize thread: %v", err))
-		return fmt.Errorf("error sending request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		a.logError(fmt.Sprintf("Failed to read response body for thread initialization: %v", err))
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		var apiErr OpenAIErrorResponse
-		if err := json.Unmarshal(bodyBytes, &apiErr); err != nil {
-			a.logError(fmt.Sprintf("Non-OK status %d, but failed to unmarshal error response for thread init: %s", resp.StatusCode, string(bodyBytes)))
-			return fmt.Errorf("thread initialization failed with status %d: %s", resp.StatusCode, string(bodyBytes))
-		}
-		a.logError(fmt.Sprintf("Thread initialization failed with status %d, error: %s", resp.StatusCode, apiErr.Error.Message))
-		return fmt.Errorf("thread could not be initialised: %s", apiErr.Error.Message)
-	}
+// SetPollOptions changes how long AddMessageToThread waits for a run and how often it checks.
+func (a *Assistant) SetPollOptions(options PollOptions) {
+	a.pollOptions = options
+}
 
-	var threadResp CreateThreadResponse
-	if err := json.Unmarshal(bodyBytes, &threadResp); err != nil {
-		a.logError(fmt.Sprintf("Failed to unmarshal thread initialization response: %v, body: %s", err, string(bodyBytes)))
-		return fmt.Errorf("failed to unmarshal thread response: %w", err)
-	}
+// SetInstructions overrides the assistant's stored instructions for subsequent runs.
+// An empty string reverts to the assistant's own instructions.
+func (a *Assistant) SetInstructions(instructions string) {
+	a.instructions = instructions
+}
 
-	a.threadID = threadResp.ID
-	return nil
+// initialiseThread creates a new thread with the OpenAI API and sets the Assistant's threadID.
+func (a *Assistant) initialiseThread(ctx context.Context) error {
+	_, err := a.CreateThread(ctx, nil, nil)
+	return err
 }
 
 // AddMessageToThread adds a message to the current thread, runs the thread, and polls for a response.
 // It returns the assistant's reply or an error if any step fails.
-func (a *Assistant) AddMessageToThread(prompt string) (string, error) {
-	if a.threadID == "" {
-		return "", fmt.Errorf("thread not initialized. Call NewAssistant or ResetThread first")
-	}
-
-	payload := AddMessagePayload{
-		Role:    "user",
-		Content: prompt,
-	}
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		a.logError(fmt.Sprintf("Failed to marshal message payload: %v", err))
-		return "", fmt.Errorf("failed to marshal message payload: %w", err)
-	}
-
-	url := fmt.Sprintf("%s/v1/threads/%s/messages", BaseURI, a.threadID)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		a.logError(fmt.Sprintf("Failed to create request for adding message: %v", err))
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+a.openAIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("OpenAI-Beta", OpenAIBetaHeader)
+func (a *Assistant) AddMessageToThread(prompt string, options ...RunOption) (string, error) {
+	return a.AddMessageToThreadContext(context.Background(), prompt, options...)
+}
 
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
-		a.logError(fmt.Sprintf("Error sending request to add message to thread: %v", err))
-		return "", fmt.Errorf("error sending request: %w", err)
-	}
-	defer resp.Body.Close()
+// AddMessageToThreadContext is AddMessageToThread bounded by ctx. If ctx ends while the
+// assistant is still working, the run is cancelled on OpenAI's side too.
+func (a *Assistant) AddMessageToThreadContext(ctx context.Context, prompt string, options ...RunOption) (string, error) {
+	return a.AddMessageToThreadStream(ctx, prompt, nil, options...)
+}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		a.logError(fmt.Sprintf("Failed to read response body for adding message: %v", err))
-		return "", fmt.Errorf("failed to read response body: %w", err)
+// AddMessageToThreadStream is AddMessageToThreadContext with each event of a streamed run passed
+// to onEvent as it arrives. onEvent may be nil. Runs are streamed unless the Assistant was made
+// with PollRuns; if streaming isn't available, or the stream breaks, the run is polled instead
+// and onEvent sees no further events.
+func (a *Assistant) AddMessageToThreadStream(ctx context.Context, prompt string, onEvent StreamHandler, options ...RunOption) (string, error) {
+	if err := a.addMessage(ctx, prompt); err != nil {
+		return "", err
 	}
+	return a.runForReply(ctx, a.endpoint("/threads/%s/runs", a.threadID), nil, onEvent, options)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		var apiErr OpenAIErrorResponse
-		if err := json.Unmarshal(bodyBytes, &apiErr); err != nil {
-			a.logError(fmt.Sprintf("Non-OK status %d, but failed to unmarshal error response for add message: %s", resp.StatusCode, string(bodyBytes)))
-			return "", fmt.Errorf("add message failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+// runForReply starts a run by POSTing to url and waits for its reply, creating thread along with
+// the run if it is set.
+func (a *Assistant) runForReply(ctx context.Context, url string, thread *CreateThreadPayload, onEvent StreamHandler, options []RunOption) (string, error) {
+	a.runID = ""
+	if err := a.loadStoredTools(ctx); err != nil {
+		return "", err
+	}
+	if !a.pollRuns {
+		reply, err := a.streamThreadForReply(ctx, url, a.runBody(thread, true, options), onEvent)
+		if err == nil {
+			return reply, nil
 		}
-		a.logError(fmt.Sprintf("Error when attempting to publish message to OpenAI thread, error: %s", apiErr.Error.Message))
-		return "", fmt.Errorf("failed to add message: %s", apiErr.Error.Message)
+		if !errors.Is(err, errStreamUnavailable) {
+			return "", fmt.Errorf("failed to get reply from thread: %w", err)
+		}
+		a.logError(fmt.Sprintf("Falling back to polling: %v", err))
 	}
 
-	// Run the thread after adding the message
-	threadRunning := a.runThread()
-	if !threadRunning {
-		return "", fmt.Errorf("failed to run thread after adding message")
+	// Run the thread after adding the message, unless streaming already started it
+	if a.runID == "" {
+		if err := a.runThread(ctx, url, a.runBody(thread, false, options)); err != nil {
+			return "", fmt.Errorf("failed to run thread after adding message: %w", err)
+		}
 	}
 
 	// Poll for the assistant's reply
-	response := a.pollThreadForReply(3, 4) // Default retries and wait time
-	if response == "" {
-		return "", fmt.Errorf("failed to get reply from thread after polling")
+	response, err := a.pollThreadForReply(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get reply from thread: %w", err)
 	}
 	return response, nil
 }
 
-// runThread initiates a run on the current OpenAI thread and sets the Assistant's runID.
-// It returns true on success, false on failure.
-func (a *Assistant) runThread() bool {
-	payload := RunThreadPayload{
-		AssistantID: a.assistantID,
-	}
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		a.logError(fmt.Sprintf("Failed to marshal run thread payload: %v", err))
-		return false
+// addMessage adds a user message to the current thread.
+func (a *Assistant) addMessage(ctx context.Context, prompt string) error {
+	if a.threadID == "" {
+		return fmt.Errorf("thread not initialized. Call NewAssistant or ResetThread first")
 	}
 
-	url := fmt.Sprintf("%s/v1/threads/%s/runs", BaseURI, a.threadID)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		a.logError(fmt.Sprintf("Failed to create request for running thread: %v", err))
-		return false
+	if _, err := a.CreateMessage(ctx, a.messagePayload(prompt)); err != nil {
+		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+a.openAIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("OpenAI-Beta", OpenAIBetaHeader)
+	a.pendingImages, a.pendingAttachments = nil, nil
+	return nil
+}
 
-	resp, err := a.httpClient.Do(req)
+// runThread initiates a run by POSTing payload to url and sets the Assistant's runID, and its
+// threadID in case the run created the thread.
+func (a *Assistant) runThread(ctx context.Context, url string, payload interface{}) error {
+	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		a.logError(fmt.Sprintf("Error sending request to run thread: %v", err))
-		return false
+		a.logError(fmt.Sprintf("Failed to marshal run thread payload: %v", err))
+		return fmt.Errorf("failed to marshal run thread payload: %w", err)
 	}
-	defer resp.Body.Close()
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	resp, err := a.send(ctx, "POST", url, jsonPayload, false)
 	if err != nil {
-		a.logError(fmt.Sprintf("Failed to read response body for running thread: %v", err))
-		return false
+		a.logError(fmt.Sprintf("Error sending request to run thread: %v", err))
+		return fmt.Errorf("error sending request: %w", err)
 	}
+	bodyBytes := resp.Body
 
 	if resp.StatusCode != http.StatusOK {
-		var apiErr OpenAIErrorResponse
-		if err := json.Unmarshal(bodyBytes, &apiErr); err != nil {
-			a.logError(fmt.Sprintf("Non-OK status %d, but failed to unmarshal error response for run thread: %s", resp.StatusCode, string(bodyBytes)))
-			return false
-		}
-		a.logError(fmt.Sprintf("Error when attempting to run OpenAI assistant on thread, error: %s", apiErr.Error.Message))
-		return false
+		apiErr := newAPIError(resp)
+		a.logError(fmt.Sprintf("Error when attempting to run OpenAI assistant on thread, error: %v", apiErr))
+		return fmt.Errorf("failed to run thread: %w", apiErr)
 	}
 
 	var runResp RunThreadResponse
 	if err := json.Unmarshal(bodyBytes, &runResp); err != nil {
 		a.logError(fmt.Sprintf("Failed to unmarshal run thread response: %v, body: %s", err, string(bodyBytes)))
-		return false
+		return fmt.Errorf("failed to unmarshal run thread response: %w", err)
 	}
 
-	a.runID = runResp.ID
-	return true
+	a.setRun(runResp.ID, runResp.ThreadID)
+	return nil
 }
 
-// pollThreadForReply checks the run status periodically until it's completed or failed.
-// It returns the assistant's last message on success, or an empty string on failure/timeout.
-func (a *Assistant) pollThreadForReply(retries int, retryWait int) string {
-	for i := 0; i <= retries; i++ {
-		url := fmt.Sprintf("%s/v1/threads/%s/runs/%s", BaseURI, a.threadID, a.runID)
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			a.logError(fmt.Sprintf("Failed to create request for polling run status: %v", err))
-			return ""
-		}
+// Usage returns the tokens used by every run this Assistant has followed to the end.
+func (a *Assistant) Usage() ModelUsage {
+	usage := ModelUsage{}
+	usage.Merge(a.usage)
+	return usage
+}
 
-		req.Header.Set("Authorization", "Bearer "+a.openAIKey)
-		req.Header.Set("OpenAI-Beta", OpenAIBetaHeader)
+// recordUsage adds a stopped run's usage to the Assistant's total.
+func (a *Assistant) recordUsage(run *PollRunResponse) {
+	if run.Usage == nil || !runTerminal(run.Status) {
+		return
+	}
+	if a.usage == nil {
+		a.usage = ModelUsage{}
+	}
+	a.usage.Add(run.Model, *run.Usage)
+}
 
-		resp, err := a.httpClient.Do(req)
-		if err != nil {
-			if i == retries { // Log error only on the last retry
-				a.logError(fmt.Sprintf("Error sending request to poll run status on last retry: %v", err))
-				return ""
-			}
-			time.Sleep(time.Duration(retryWait) * time.Second)
-			continue
-		}
-		defer resp.Body.Close()
+// setRun records the run being followed and the thread it is on.
+func (a *Assistant) setRun(runID, threadID string) {
+	a.runID = runID
+	if threadID != "" {
+		a.threadID = threadID
+	}
+}
 
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			a.logError(fmt.Sprintf("Failed to read response body for polling run status: %v", err))
-			time.Sleep(time.Duration(retryWait) * time.Second)
-			continue
-		}
+// runPayload describes a run of the current assistant with the Assistant's overrides.
+func (a *Assistant) runPayload() RunThreadPayload {
+	return RunThreadPayload{
+		AssistantID:    a.assistantID,
+		Instructions:   a.instructions,
+		Tools:          a.runTools(),
+		ResponseFormat: a.responseFormat,
+	}
+}
 
-		if resp.StatusCode != http.StatusOK {
-			var apiErr OpenAIErrorResponse
-			if err := json.Unmarshal(bodyBytes, &apiErr); err != nil {
-				a.logError(fmt.Sprintf("Non-OK status %d, but failed to unmarshal error response for poll run: %s", resp.StatusCode, string(bodyBytes)))
-			} else {
-				a.logError(fmt.Sprintf("Poll thread failed with status %d, error: %s", resp.StatusCode, apiErr.Error.Message))
-			}
-			time.Sleep(time.Duration(retryWait) * time.Second)
-			continue
-		}
+// runBody is the request body for a run, with the thread to create if thread is set.
+func (a *Assistant) runBody(thread *CreateThreadPayload, stream bool, options []RunOption) interface{} {
+	payload := a.runPayload()
+	for _, option := range options {
+		option(&payload)
+	}
+	payload.Stream = stream
+	if thread == nil {
+		return payload
+	}
+	return CreateThreadAndRunPayload{RunThreadPayload: payload, Thread: *thread}
+}
 
-		var pollResp PollRunResponse
-		if err := json.Unmarshal(bodyBytes, &pollResp); err != nil {
-			a.logError(fmt.Sprintf("Failed to unmarshal poll run response: %v, body: %s", err, string(bodyBytes)))
-			time.Sleep(time.Duration(retryWait) * time.Second)
-			continue
+// pollThreadForReply waits for the current run to reach a terminal status, backing off between
+// checks per the poll options. It returns the assistant's reply once the run completes, or a
+// *RunError for runs that failed, were cancelled, expired or ended incomplete. Tool calls for
+// registered tools are answered as they come up; a run needing any other action is cancelled.
+// If ctx ends or the poll timeout passes first, the run is cancelled.
+func (a *Assistant) pollThreadForReply(ctx context.Context) (string, error) {
+	options := a.pollOptions
+	pollCtx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	interval := options.InitialInterval
+	for {
+		run, err := a.getRun(pollCtx)
+		if err == nil {
+			a.recordUsage(run)
+			switch {
+			case run.Status == RunStatusCompleted:
+				return a.GetLastMessageContext(ctx)
+			case runTerminal(run.Status):
+				a.logError(fmt.Sprintf("OpenAI run ended with status: %s", run.Status))
+				return "", runOutcome(run)
+			case run.Status == RunStatusRequiresAction && a.canHandle(run.RequiredAction):
+				outputs := a.callTools(pollCtx, run.RequiredAction.SubmitToolOutputs.ToolCalls)
+				if err := a.submitToolOutputs(pollCtx, outputs); err != nil && pollCtx.Err() == nil {
+					a.stopRun()
+					return "", err
+				}
+				interval = options.InitialInterval
+				continue
+			case run.Status == RunStatusRequiresAction:
+				// Nothing here can satisfy the action, so waiting would only run out the clock.
+				a.stopRun()
+				return "", runOutcome(run)
+			}
+		} else if !retryablePollError(err) && pollCtx.Err() == nil {
+			a.stopRun()
+			return "", err
 		}
 
-		switch pollResp.Status {
-		case "failed":
-			a.logError(fmt.Sprintf("OpenAI run failed with status: %s, details: %s", pollResp.Status, string(bodyBytes)))
-			return ""
-		case "completed":
-			return a.GetLastMessage()
-		default:
-			time.Sleep(time.Duration(retryWait) * time.Second)
+		select {
+		case <-pollCtx.Done():
+			a.stopRun()
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", fmt.Errorf("%w %s after %s", ErrRunTimeout, a.runID, options.Timeout)
+		case <-time.After(interval):
+			interval = options.next(interval)
 		}
 	}
-	a.logError("Polling for thread reply timed out after maximum retries.")
-	return ""
 }
 
-// GetLastMessage retrieves the most recent message in the current thread.
-// It returns the text content of the message or an empty string on failure.
-func (a *Assistant) GetLastMessage() string {
-	url := fmt.Sprintf("%s/v1/threads/%s/messages", BaseURI, a.threadID)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		a.logError(fmt.Sprintf("Failed to create request for getting last message: %v", err))
-		return ""
-	}
-
-	req.Header.Set("Authorization", "Bearer "+a.openAIKey)
-	req.Header.Set("OpenAI-Beta", OpenAIBetaHeader)
+// errRetryablePoll marks network failures while polling, which are worth trying again.
+var errRetryablePoll = errors.New("retryable poll error")
 
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
-		a.logError(fmt.Sprintf("Error sending request to get last message: %v", err))
-		return ""
+// retryablePollError reports whether polling should carry on after err.
+func retryablePollError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable
 	}
-	defer resp.Body.Close()
+	return errors.Is(err, errRetryablePoll)
+}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+// getRun fetches the current run's status.
+func (a *Assistant) getRun(ctx context.Context) (*PollRunResponse, error) {
+	url := a.endpoint("/threads/%s/runs/%s", a.threadID, a.runID)
+	resp, err := a.send(ctx, "GET", url, nil, true)
 	if err != nil {
-		a.logError(fmt.Sprintf("Failed to read response body for getting last message: %v", err))
-		return ""
+		a.logError(fmt.Sprintf("Error sending request to poll run status: %v", err))
+		return nil, fmt.Errorf("%w: error sending request: %v", errRetryablePoll, err)
 	}
+	bodyBytes := resp.Body
 
 	if resp.StatusCode != http.StatusOK {
-		var apiErr OpenAIErrorResponse
-		if err := json.Unmarshal(bodyBytes, &apiErr); err != nil {
-			a.logError(fmt.Sprintf("Non-OK status %d, but failed to unmarshal error response for get last message: %s", resp.StatusCode, string(bodyBytes)))
-		} else {
-			a.logError(fmt.Sprintf("Get last message failed with status %d, error: %s", resp.StatusCode, apiErr.Error.Message))
-		}
-		return ""
+		apiErr := newAPIError(resp)
+		a.logError(fmt.Sprintf("Poll thread failed: %v", apiErr))
+		return nil, fmt.Errorf("poll run failed: %w", apiErr)
 	}
 
-	var messagesResp ListMessagesResponse
-	if err := json.Unmarshal(bodyBytes, &messagesResp); err != nil {
-		a.logError(fmt.Sprintf("Failed to unmarshal messages response: %v, body: %s", err, string(bodyBytes)))
-		return ""
+	var pollResp PollRunResponse
+	if err := json.Unmarshal(bodyBytes, &pollResp); err != nil {
+		a.logError(fmt.Sprintf("Failed to unmarshal poll run response: %v, body: %s", err, string(bodyBytes)))
+		return nil, fmt.Errorf("failed to unmarshal poll run response: %w", err)
 	}
+	return &pollResp, nil
+}
 
-	// Check if there are messages and if the first message has text content
-	if len(messagesResp.Data) > 0 && len(messagesResp.Data[0].Content) > 0 && messagesResp.Data[0].Content[0].Type == "text" {
-		return messagesResp.Data[0].Content[0].Text.Value
+// stopRun cancels the current run, logging rather than returning any failure to do so.
+func (a *Assistant) stopRun() {
+	if err := a.cancelRun(); err != nil {
+		a.logError(fmt.Sprintf("Failed to cancel run %s: %v", a.runID, err))
 	}
+}
+
+// GetLastMessage retrieves the assistant's reply to the current run (see GetLastReplyContext).
+// It returns the text content of the reply.
+func (a *Assistant) GetLastMessage() (string, error) {
+	return a.GetLastMessageContext(context.Background())
+}
 
-	a.logError("No text content found in the last message or message structure is unexpected.")
-	return ""
+func (a *Assistant) GetLastMessageContext(ctx context.Context) (string, error) {
+	reply, err := a.GetLastReplyContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return replyText(reply)
 }
 
-// logError is a wrapper function for logging errors, respecting the silenceErrors flag.
-func (a *Assistant) logError(message string) {
-	if !a.silenceErrors {
-		log.Printf("Assistant Error: %s", message)
+// cancelRun asks OpenAI to stop the current run. It gets its own short deadline because it is
+// usually called after the caller's context has already expired.
+func (a *Assistant) cancelRun() error {
+	if a.runID == "" {
+		return nil
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	url := a.endpoint("/threads/%s/runs/%s/cancel", a.threadID, a.runID)
+	resp, err := a.send(ctx, "POST", url, nil, true)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to cancel run: %w", newAPIError(resp))
+	}
+	return nil
 }
@@ -0,0 +1,200 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOpenAI stands in for the OpenAI API. Handlers are keyed by method and path, e.g.
+// "GET /v1/threads/thread_1/runs/run_1"; anything else gets a 404.
+type fakeOpenAI struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc
+	requests []fakeRequest
+}
+
+type fakeRequest struct {
+	Route  string
+	Query  url.Values
+	Header http.Header
+	Body   string
+}
+
+func newFakeOpenAI(t *testing.T) *fakeOpenAI {
+	f := &fakeOpenAI{handlers: map[string]http.HandlerFunc{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOpenAI) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body)) // Left for the handler to read too
+	route := r.Method + " " + r.URL.Path
+
+	f.mu.Lock()
+	f.requests = append(f.requests, fakeRequest{Route: route, Query: r.URL.Query(), Header: r.Header.Clone(), Body: string(body)})
+	handler := f.handlers[route]
+	f.mu.Unlock()
+
+	if handler == nil {
+		http.Error(w, `{"error": {"message": "no such route `+route+`", "type": "invalid_request_error"}}`, http.StatusNotFound)
+		return
+	}
+	handler(w, r)
+}
+
+func (f *fakeOpenAI) handle(route string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[route] = handler
+}
+
+// reply answers route with each body in turn, repeating the last one.
+func (f *fakeOpenAI) reply(route string, status int, bodies ...string) {
+	var mu sync.Mutex
+	n := 0
+	f.handle(route, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body := bodies[min(n, len(bodies)-1)]
+		n++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	})
+}
+
+// received returns the requests made to route, in order.
+func (f *fakeOpenAI) received(route string) []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var requests []fakeRequest
+	for _, r := range f.requests {
+		if r.Route == route {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// testRetryPolicy and testPollOptions keep tests from waiting on real backoffs.
+var (
+	testRetryPolicy = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	testPollOptions = PollOptions{Timeout: 2 * time.Second, InitialInterval: time.Millisecond, MaxInterval: 5 * time.Millisecond, Multiplier: 2}
+)
+
+// assistant returns an Assistant for asst_1 on thread_1 that talks to the fake.
+func (f *fakeOpenAI) assistant(configOptions int, options ...AssistantOption) *Assistant {
+	options = append([]AssistantOption{WithBaseURL(f.URL + "/v1")}, options...)
+	a := newAssistant("sk-test", "asst_1", configOptions|SilenceErrors, options)
+	a.SetRetryPolicy(testRetryPolicy)
+	a.SetPollOptions(testPollOptions)
+	a.threadID = "thread_1"
+	return a
+}
+
+const (
+	testRunRoute    = "GET /v1/threads/thread_1/runs/run_1"
+	testCancelRoute = "POST /v1/threads/thread_1/runs/run_1/cancel"
+)
+
+// fakeRun answers message, run and reply requests for a run on thread_1 that goes through
+// statuses when polled.
+func (f *fakeOpenAI) fakeRun(statuses ...string) {
+	f.reply("POST /v1/threads/thread_1/messages", http.StatusOK, `{"id": "msg_user", "role": "user"}`)
+	f.reply("POST /v1/threads/thread_1/runs", http.StatusOK, `{"id": "run_1", "thread_id": "thread_1", "status": "queued"}`)
+	runs := make([]string, len(statuses))
+	for i, status := range statuses {
+		runs[i] = `{"id": "run_1", "thread_id": "thread_1", "status": "` + status + `", "model": "gpt-4o",
+			"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}}`
+	}
+	f.reply(testRunRoute, http.StatusOK, runs...)
+	f.reply(testCancelRoute, http.StatusOK, `{"id": "run_1", "status": "cancelling"}`)
+	f.reply("GET /v1/threads/thread_1/messages", http.StatusOK, `{"data": [
+		{"id": "msg_1", "role": "assistant", "run_id": "run_1", "content": [{"type": "text", "text": {"value": "Blue Widget x5"}}]}
+	]}`)
+}
+
+func TestAddMessageToThreadContext(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.fakeRun("queued", "in_progress", "completed")
+	a := f.assistant(PollRuns)
+
+	reply, err := a.AddMessageToThreadContext(context.Background(), "5 blue widgets please")
+	if err != nil {
+		t.Fatalf("AddMessageToThreadContext() error = %v", err)
+	}
+	if reply != "Blue Widget x5" {
+		t.Errorf("reply = %q", reply)
+	}
+	if n := len(f.received(testRunRoute)); n != 3 {
+		t.Errorf("polled %d times, want 3", n)
+	}
+	messages := f.received("GET /v1/threads/thread_1/messages")
+	if len(messages) != 1 || messages[0].Query.Get("run_id") != "run_1" {
+		t.Errorf("messages requested as %+v, want the run's only", messages)
+	}
+	if usage := a.Usage()["gpt-4o"]; usage.TotalTokens != 15 {
+		t.Errorf("usage = %+v, want the completed run's", a.Usage())
+	}
+	if header := messages[0].Header; header.Get("Authorization") != "Bearer sk-test" || header.Get("OpenAI-Beta") != OpenAIBetaHeader {
+		t.Errorf("request headers = %v", header)
+	}
+}
+
+func TestAddMessageToThreadContextCancelled(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.fakeRun("in_progress")
+
+	t.Run("before the message is sent", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := f.assistant(PollRuns).AddMessageToThreadContext(ctx, "hello")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want %v", err, context.Canceled)
+		}
+		if n := len(f.received("POST /v1/threads/thread_1/runs")); n != 0 {
+			t.Errorf("started %d runs with a cancelled context", n)
+		}
+	})
+
+	t.Run("while the run is going", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := f.assistant(PollRuns).AddMessageToThreadContext(ctx, "hello")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if n := len(f.received(testCancelRoute)); n != 1 {
+			t.Errorf("cancelled the run %d times, want once", n)
+		}
+	})
+}
+
+func TestNewAssistantContext(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.reply("POST /v1/threads", http.StatusOK, `{"id": "thread_new"}`)
+
+	a, err := NewAssistantContext(context.Background(), "sk-test", "asst_1", SilenceErrors, "", WithBaseURL(f.URL+"/v1"))
+	if err != nil || a.GetThreadID() != "thread_new" {
+		t.Fatalf("NewAssistantContext() = %v, %v; want thread_new", a, err)
+	}
+	a, err = NewAssistantContext(context.Background(), "sk-test", "asst_1", SilenceErrors|RecallThreadID, "thread_old", WithBaseURL(f.URL+"/v1"))
+	if err != nil || a.GetThreadID() != "thread_old" {
+		t.Fatalf("NewAssistantContext() with RecallThreadID = %v, %v; want thread_old", a, err)
+	}
+	if n := len(f.received("POST /v1/threads")); n != 1 {
+		t.Errorf("created %d threads, want 1", n)
+	}
+}
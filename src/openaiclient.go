@@ -0,0 +1,189 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// openAIClient holds what every OpenAI API client shares: the key, where requests go and how
+// they are sent. Assistant, ChatClient and ResponsesClient embed it.
+type openAIClient struct {
+	name          string // Prefix for logged errors
+	silenceErrors bool
+	openAIKey     string
+	baseURL       string
+	apiVersion    string // Azure only
+	azure         bool
+	organization  string
+	project       string
+	beta          string // OpenAI-Beta header, if the API needs one
+	executor      *requestExecutor
+}
+
+func newOpenAIClient(name, openAIKey string, options []AssistantOption) openAIClient {
+	c := openAIClient{
+		name:      name,
+		openAIKey: openAIKey,
+		baseURL:   BaseURI + "/v1",
+		executor: &requestExecutor{
+			client: &http.Client{Timeout: 30 * time.Second},
+			policy: DefaultRetryPolicy,
+		},
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	c.executor.breaker, c.executor.limits = sharedLimits(c.baseURL)
+	return c
+}
+
+// SetRetryPolicy changes how failed OpenAI requests are retried.
+func (c *openAIClient) SetRetryPolicy(policy RetryPolicy) {
+	c.executor.policy = policy
+}
+
+// send builds an OpenAI request with the usual headers and runs it through the executor.
+func (c *openAIClient) send(ctx context.Context, method, url string, payload []byte, idempotent bool) (*apiResponse, error) {
+	return c.executor.do(ctx, c.newRequest(method, url, payload, "application/json", false), idempotent, false)
+}
+
+// sendForm POSTs a multipart/form-data body, such as a file upload.
+func (c *openAIClient) sendForm(ctx context.Context, url string, payload []byte, contentType string) (*apiResponse, error) {
+	return c.executor.do(ctx, c.newRequest("POST", url, payload, contentType, false), false, false)
+}
+
+// stream POSTs a request asking for server-sent events. On a 200 response the caller must close
+// resp.Stream; servers that ignore the request for a stream answer with ordinary JSON in it.
+func (c *openAIClient) stream(ctx context.Context, url string, payload []byte) (*apiResponse, error) {
+	return c.executor.do(ctx, c.newRequest("POST", url, payload, "application/json", true), false, true)
+}
+
+func (c *openAIClient) newRequest(method, url string, payload []byte, contentType string, stream bool) func(ctx context.Context) (*http.Request, error) {
+	return func(ctx context.Context) (*http.Request, error) {
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		if err != nil {
+			return nil, err
+		}
+
+		c.setAuthHeaders(req)
+		if payload != nil || method == "POST" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if c.beta != "" {
+			req.Header.Set("OpenAI-Beta", c.beta)
+		}
+		if stream {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		return req, nil
+	}
+}
+
+// callJSON sends payload, if any, as JSON and decodes a 200 response into out, if given.
+// action describes the request in logs and errors, e.g. "get thread".
+func (c *openAIClient) callJSON(ctx context.Context, method, url string, payload, out interface{}, idempotent bool, action string) error {
+	var jsonPayload []byte
+	if payload != nil {
+		var err error
+		jsonPayload, err = json.Marshal(payload)
+		if err != nil {
+			c.logError(fmt.Sprintf("Failed to marshal %s payload: %v", action, err))
+			return fmt.Errorf("failed to marshal %s payload: %w", action, err)
+		}
+	}
+
+	resp, err := c.send(ctx, method, url, jsonPayload, idempotent)
+	if err != nil {
+		c.logError(fmt.Sprintf("Error sending request to %s: %v", action, err))
+		return fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(resp)
+		c.logError(fmt.Sprintf("Failed to %s: %v", action, apiErr))
+		return fmt.Errorf("failed to %s: %w", action, apiErr)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Body, out); err != nil {
+		c.logError(fmt.Sprintf("Failed to unmarshal %s response: %v, body: %s", action, err, string(resp.Body)))
+		return fmt.Errorf("failed to unmarshal %s response: %w", action, err)
+	}
+	return nil
+}
+
+// endpoint builds the full URL for an API path such as "/threads/%s/runs".
+func (c *openAIClient) endpoint(format string, args ...interface{}) string {
+	path := format
+	if len(args) > 0 {
+		escaped := make([]interface{}, len(args))
+		for i, arg := range args {
+			if s, ok := arg.(string); ok {
+				arg = url.PathEscape(s)
+			}
+			escaped[i] = arg
+		}
+		path = fmt.Sprintf(format, escaped...)
+	}
+
+	full := c.baseURL + path
+	if c.apiVersion != "" {
+		separator := "?"
+		if strings.Contains(full, "?") {
+			separator = "&"
+		}
+		full += separator + "api-version=" + url.QueryEscape(c.apiVersion)
+	}
+	return full
+}
+
+// withQuery appends query parameters to a URL built by endpoint, which may already have some.
+func withQuery(requestURL string, query url.Values) string {
+	encoded := query.Encode()
+	if encoded == "" {
+		return requestURL
+	}
+	if strings.Contains(requestURL, "?") {
+		return requestURL + "&" + encoded
+	}
+	return requestURL + "?" + encoded
+}
+
+// setAuthHeaders adds the key and any organisation or project headers to req.
+// Local servers are often run without a key, in which case none is sent.
+func (c *openAIClient) setAuthHeaders(req *http.Request) {
+	switch {
+	case c.openAIKey == "":
+	case c.azure:
+		req.Header.Set("api-key", c.openAIKey)
+	default:
+		req.Header.Set("Authorization", "Bearer "+c.openAIKey)
+	}
+	if c.organization != "" {
+		req.Header.Set("OpenAI-Organization", c.organization)
+	}
+	if c.project != "" {
+		req.Header.Set("OpenAI-Project", c.project)
+	}
+}
+
+// logError is a wrapper function for logging errors, respecting the silenceErrors flag.
+func (c *openAIClient) logError(message string) {
+	if !c.silenceErrors {
+		log.Printf("%s Error: %s", c.name, message)
+	}
+}
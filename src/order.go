@@ -0,0 +1,131 @@
+package inbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Order is every line item an email asks for. Dates are YYYY-MM-DD; empty strings stand in for
+// "not given", since strict schemas require every field.
+type Order struct {
+	Items           []LineItem `json:"items"`
+	RequestedDate   string     `json:"requested_date"`   // For the whole order, unless an item says otherwise
+	DeliveryAddress string     `json:"delivery_address"` // For the whole order, unless an item says otherwise
+}
+
+type LineItem struct {
+	Product         string  `json:"product"` // As the customer described it
+	SKU             string  `json:"sku"`
+	Quantity        float64 `json:"quantity"`
+	Unit            string  `json:"unit"` // e.g. "boxes" or "kg", empty for single items
+	RequestedDate   string  `json:"requested_date"`
+	DeliveryAddress string  `json:"delivery_address"`
+	Source          string  `json:"source,omitempty"` // Where the item was found: "table", "line", "attachment:<name>" or empty for the LLM
+}
+
+// OrderFormat constrains a run's reply to an Order.
+var OrderFormat = &ResponseFormat{
+	Type: "json_schema",
+	JSONSchema: &JSONSchemaFormat{
+		Name:        "order",
+		Description: "Every product the customer orders, with quantities, dates and delivery address.",
+		Strict:      true,
+		Schema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"items": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"product": {"type": "string", "description": "The product as the customer described it"},
+							"sku": {"type": "string", "description": "SKU if known, otherwise empty"},
+							"quantity": {"type": "number", "description": "How many, 1 if not stated"},
+							"unit": {"type": "string", "description": "Unit of the quantity such as boxes or kg, empty for single items"},
+							"requested_date": {"type": "string", "description": "Date wanted for this item as YYYY-MM-DD, empty if not stated"},
+							"delivery_address": {"type": "string", "description": "Delivery address for this item if different from the order's, otherwise empty"}
+						},
+						"required": ["product", "sku", "quantity", "unit", "requested_date", "delivery_address"],
+						"additionalProperties": false
+					}
+				},
+				"requested_date": {"type": "string", "description": "Date the order is wanted as YYYY-MM-DD, empty if not stated"},
+				"delivery_address": {"type": "string", "description": "Where to deliver the order, empty if not stated"}
+			},
+			"required": ["items", "requested_date", "delivery_address"],
+			"additionalProperties": false
+		}`),
+	},
+}
+
+// orderInstructions are added to a route's instructions when it extracts orders.
+const orderInstructions = "List every product the customer orders as a separate line item, with its quantity and unit. " +
+	"Give dates as YYYY-MM-DD. Leave out anything the customer only mentions without ordering."
+
+// Validate checks the order makes sense beyond what the schema can express.
+func (o *Order) Validate() error {
+	if err := validDate(o.RequestedDate); err != nil {
+		return err
+	}
+	for i, item := range o.Items {
+		if item.Product == "" && item.SKU == "" {
+			return fmt.Errorf("item %d has neither a product nor a sku", i+1)
+		}
+		if item.Quantity <= 0 {
+			return fmt.Errorf("item %d quantity %v must be more than 0", i+1, item.Quantity)
+		}
+		if err := validDate(item.RequestedDate); err != nil {
+			return fmt.Errorf("item %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validDate(date string) error {
+	if date == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return fmt.Errorf("date %q is not YYYY-MM-DD", date)
+	}
+	return nil
+}
+
+// fillDefaults gives items without their own date or address the order's.
+func (o *Order) fillDefaults() {
+	for i := range o.Items {
+		if o.Items[i].RequestedDate == "" {
+			o.Items[i].RequestedDate = o.RequestedDate
+		}
+		if o.Items[i].DeliveryAddress == "" {
+			o.Items[i].DeliveryAddress = o.DeliveryAddress
+		}
+	}
+}
+
+// Summary describes the order in a line per item.
+func (o *Order) Summary() string {
+	lines := make([]string, 0, len(o.Items))
+	for _, item := range o.Items {
+		line := strconv.FormatFloat(item.Quantity, 'f', -1, 64)
+		if item.Unit != "" {
+			line += " " + item.Unit
+		}
+		switch {
+		case item.Product == "":
+			line += " x " + item.SKU
+		case item.SKU == "":
+			line += " x " + item.Product
+		default:
+			line += " x " + item.Product + " (" + item.SKU + ")"
+		}
+		if item.RequestedDate != "" {
+			line += " by " + item.RequestedDate
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
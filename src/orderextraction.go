@@ -0,0 +1,398 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// pickOrder answers a route with extract_order set. Line items found in order tables, CSV
+// attachments or "5 x Widget" lines are kept as they are. Unless the whole order came from tables
+// with nothing else said, the picker is also asked to read the email, and any items it finds that
+// weren't already found are added. Dates and addresses found in the email fill in any the picker
+// leaves out. If the picker answers without an order, such as with a single pick, the items found
+// in the email are the order.
+func pickOrder(ctx context.Context, picker ProductPicker, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+	order, leftover := extractOrder(msg)
+	if len(order.Items) > 0 && len(leftover) == 0 && fromTables(order.Items) {
+		order.fillDefaults()
+		return &Answer{Text: order.Summary(), Order: order}, nil
+	}
+
+	answer, err := picker.Pick(ctx, route, messageID, msg)
+	if err != nil {
+		return answer, err
+	}
+	if answer.Order == nil {
+		if len(order.Items) > 0 {
+			order.fillDefaults()
+			answer.Order = order
+		}
+		return answer, nil
+	}
+	if len(order.Items) > 0 {
+		answer.Order.Items = mergeItems(order.Items, answer.Order.Items)
+		answer.Text = answer.Order.Summary()
+	}
+	if answer.Order.RequestedDate == "" {
+		answer.Order.RequestedDate = order.RequestedDate
+	}
+	if answer.Order.DeliveryAddress == "" {
+		answer.Order.DeliveryAddress = order.DeliveryAddress
+	}
+	answer.Order.fillDefaults()
+	return answer, nil
+}
+
+// fromTables reports whether every item came from a table in the body or a CSV attachment.
+func fromTables(items []LineItem) bool {
+	for _, item := range items {
+		if item.Source != "table" && !strings.HasPrefix(item.Source, "attachment:") {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeItems adds the LLM's items to those found in the email, leaving out any it found too.
+func mergeItems(found, llm []LineItem) []LineItem {
+	merged := append([]LineItem(nil), found...)
+	for _, item := range llm {
+		duplicate := false
+		for _, f := range found {
+			if sameItem(f, item) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+func sameItem(a, b LineItem) bool {
+	if a.SKU != "" && skuKey(a.SKU) == skuKey(b.SKU) {
+		return true
+	}
+	pa, pb := normaliseText(a.Product), normaliseText(b.Product)
+	return pa != "" && pb != "" && diceCoefficient(pa, pb) >= 0.8
+}
+
+// ExtractOrder finds what it can of an order without an LLM: line items from tables in the body
+// or CSV attachments, or failing those from lines such as "5 x Blue Widget", plus the requested
+// date and delivery address if they are labelled.
+func ExtractOrder(msg *EmailContent) *Order {
+	order, _ := extractOrder(msg)
+	return order
+}
+
+// extractOrder is ExtractOrder, also returning the lines of the body that neither it nor the
+// usual greetings, labels and sign-offs account for, which may order more in free text.
+func extractOrder(msg *EmailContent) (*Order, []string) {
+	lines := strings.Split(msg.PlainText, "\n")
+	accounted := make([]bool, len(lines))
+
+	order := &Order{RequestedDate: findRequestedDate(msg.PlainText)}
+	if start, end, parts := addressBlock(lines, 0, addressLabel); start >= 0 {
+		order.DeliveryAddress = strings.Join(parts, ", ")
+		for i := start; i < end; i++ {
+			accounted[i] = true
+		}
+	}
+
+	order.Items = tableItems(splitTableRows(msg.PlainText), "table")
+	if len(order.Items) > 0 {
+		for i, line := range lines {
+			line = strings.Trim(strings.TrimSpace(line), "|")
+			if tableRuleCells.MatchString(line) || len(tableSeparator.Split(strings.TrimSpace(line), -1)) >= 2 {
+				accounted[i] = true
+			}
+		}
+	}
+	for _, attachment := range msg.Attachments {
+		if strings.EqualFold(attachment.ContentType, "text/csv") || strings.EqualFold(filepath.Ext(attachment.Filename), ".csv") {
+			reader := csv.NewReader(bytes.NewReader(attachment.Data))
+			reader.FieldsPerRecord = -1
+			if rows, err := reader.ReadAll(); err == nil {
+				order.Items = append(order.Items, tableItems(rows, "attachment:"+attachment.Filename)...)
+			}
+		}
+	}
+	if len(order.Items) == 0 {
+		var used []int
+		order.Items, used = lineItems(lines)
+		for _, i := range used {
+			accounted[i] = true
+		}
+	}
+
+	var leftover []string
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if quotedReply.MatchString(line) || (signOff.MatchString(line) && len(line) <= 30) {
+			break // Everything below is the signature or an earlier email
+		}
+		if accounted[i] || line == "" || strings.HasPrefix(line, ">") || strings.IndexFunc(line, unicode.IsLetter) < 0 ||
+			greeting.MatchString(line) || labelled.MatchString(line) || strings.HasSuffix(line, ":") ||
+			(dateLabel.MatchString(line) && datePatterns.MatchString(line) && len(strings.Fields(line)) <= 8) {
+			continue
+		}
+		leftover = append(leftover, line)
+	}
+	return order, leftover
+}
+
+var (
+	greeting    = regexp.MustCompile(`(?i)^(?:hi|hello|hey|dear|good (?:morning|afternoon|evening))\b.{0,30}$`)
+	signOff     = regexp.MustCompile(`(?i)^(?:thanks|thank you|many thanks|regards|kind regards|best|cheers)\b`)
+	quotedReply = regexp.MustCompile(`(?i)^(?:on .* wrote:|-+ ?original message ?-+|from: .+)$`)
+	labelled    = regexp.MustCompile(`^[\w .#/-]{1,30}:\s*\S`) // e.g. "Order no: 1234" or "PO: 55"
+)
+
+// Column headings of order tables, by the LineItem field they fill.
+var orderColumns = map[string][]string{
+	"product":  {"product", "item", "description", "article", "name", "product name"},
+	"sku":      {"sku", "code", "product code", "item code", "part", "part number", "part no", "ref", "reference"},
+	"quantity": {"qty", "quantity", "amount", "count", "no", "number"},
+	"unit":     {"unit", "units", "uom"},
+	"date":     {"date", "delivery date", "required", "required by", "needed by", "due"},
+}
+
+// tableItems reads line items from rows whose first order-like row is a header with a product
+// or SKU column and a quantity column. Rows after a break in the table are ignored.
+func tableItems(rows [][]string, source string) []LineItem {
+	for start, header := range rows {
+		columns := map[string]int{}
+		for i, cell := range header {
+			heading := normaliseText(cell)
+			for field, names := range orderColumns {
+				if _, seen := columns[field]; seen {
+					continue
+				}
+				for _, name := range names {
+					if heading == name {
+						columns[field] = i
+					}
+				}
+			}
+		}
+		_, hasProduct := columns["product"]
+		_, hasSKU := columns["sku"]
+		if _, hasQuantity := columns["quantity"]; !hasQuantity || !(hasProduct || hasSKU) {
+			continue
+		}
+
+		var items []LineItem
+		for _, row := range rows[start+1:] {
+			if row == nil {
+				break
+			}
+			cell := func(field string) string {
+				if i, ok := columns[field]; ok && i < len(row) {
+					return strings.TrimSpace(row[i])
+				}
+				return ""
+			}
+			quantity, unit := parseQuantity(cell("quantity"))
+			item := LineItem{
+				Product:       cell("product"),
+				SKU:           cell("sku"),
+				Quantity:      quantity,
+				Unit:          unit,
+				RequestedDate: parseOrderDate(cell("date")),
+				Source:        source,
+			}
+			if u := cell("unit"); u != "" {
+				item.Unit = u
+			}
+			if (item.Product == "" && item.SKU == "") || item.Quantity <= 0 || (item.SKU == "" && notProducts.MatchString(item.Product)) {
+				continue // Totals, notes or blank rows
+			}
+			items = append(items, item)
+		}
+		return items
+	}
+	return nil
+}
+
+var (
+	tableSeparator  = regexp.MustCompile(`\t|\s*\|\s*|\s*;\s*|\s{2,}`)
+	tableRuleCells  = regexp.MustCompile(`^[\s|:+\-=]*$`)
+	quantityAndUnit = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)\s*([A-Za-z]*)\.?$`)
+)
+
+// splitTableRows splits each line of text into cells on tabs, pipes, semicolons or runs of
+// spaces. Lines with fewer than two cells, and the rule lines of markdown tables, become nil
+// rows, which end a table.
+func splitTableRows(text string) [][]string {
+	var rows [][]string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Trim(strings.TrimSpace(line), "|")
+		if tableRuleCells.MatchString(line) && line != "" {
+			continue
+		}
+		cells := tableSeparator.Split(strings.TrimSpace(line), -1)
+		if len(cells) < 2 {
+			rows = append(rows, nil)
+			continue
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+// parseQuantity reads quantities such as "5", "2.5" or "10kg", with a decimal comma allowed.
+func parseQuantity(s string) (float64, string) {
+	m := quantityAndUnit.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, ""
+	}
+	n, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+	if err != nil {
+		return 0, ""
+	}
+	return n, strings.ToLower(m[2])
+}
+
+const orderUnits = `pcs|pc|pieces|piece|units|unit|boxes|box|packs|pack|cases|case|pallets|pallet|cartons|carton|rolls|roll|bags|bag|sets|set|dozen|kg|litres|liters|metres|meters`
+
+var itemLinePatterns = []*regexp.Regexp{
+	// 5 x Blue Widget, 5 boxes of Blue Widget, - 3 pcs Blue Widget
+	regexp.MustCompile(`(?i)^(?:[-*•]|\d+[.)])?\s*(?P<qty>\d{1,4}(?:[.,]\d+)?)\s*(?:(?P<unit>` + orderUnits + `)\.?\s+(?:of\s+|x\s+)?|[x×]\s*)(?P<product>\S.*?)\s*$`),
+	// Blue Widget x 5, Blue Widget: 5 boxes, Blue Widget - 10 pcs. Only trusted in a list, as
+	// ordinary sentences end the same way.
+	regexp.MustCompile(`(?i)^(?P<bullet>[-*•]|\d+[.)])?\s*(?P<product>[^\d\s][^\d]*?)(?:\s[x×]|:|\s-)\s*(?P<qty>\d{1,4}(?:[.,]\d+)?)\s*(?P<unit>` + orderUnits + `)?\.?\s*$`),
+}
+
+// notProducts are words in labels that look like "Product: 5" but aren't, such as "Order no: 1234".
+var notProducts = regexp.MustCompile(`(?i)\b(?:order|invoice|number|no|ref|reference|tel|phone|mobile|fax|date|account|po|vat|postcode|zip|page|total|subtotal|price)\b`)
+
+// lineItems reads one item from each line that states a quantity next to a product, returning
+// the indexes of the lines it used. "Product x 5" lines only count when bulleted or next to another
+// item line.
+func lineItems(lines []string) ([]LineItem, []int) {
+	items := make([]LineItem, len(lines))
+	found := make([]bool, len(lines))
+	listed := make([]bool, len(lines))
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || len(line) > 120 || timeOfDay.MatchString(line) {
+			continue
+		}
+		for n, pattern := range itemLinePatterns {
+			m := pattern.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			item := LineItem{Source: "line"}
+			for j, name := range pattern.SubexpNames() {
+				switch name {
+				case "qty":
+					item.Quantity, _ = strconv.ParseFloat(strings.Replace(m[j], ",", ".", 1), 64)
+				case "unit":
+					item.Unit = strings.ToLower(m[j])
+				case "product":
+					item.Product = strings.TrimRight(m[j], " .,;:-")
+				case "bullet":
+					listed[i] = m[j] != ""
+				}
+			}
+			if item.Quantity > 0 && strings.IndexFunc(item.Product, unicode.IsLetter) >= 0 && !notProducts.MatchString(item.Product) {
+				items[i], found[i] = item, true
+				listed[i] = listed[i] || n == 0
+			}
+			break
+		}
+	}
+
+	var kept []LineItem
+	var used []int
+	for i := range lines {
+		if found[i] && (listed[i] || (i > 0 && found[i-1]) || (i+1 < len(lines) && found[i+1])) {
+			kept = append(kept, items[i])
+			used = append(used, i)
+		}
+	}
+	return kept, used
+}
+
+// timeOfDay matches times such as 3:30, which would otherwise read as "Product: 30".
+var timeOfDay = regexp.MustCompile(`\b\d{1,2}:\d{2}\b`)
+
+var (
+	dateLabel    = regexp.MustCompile(`(?i)\b(?:deliver(?:y|ed)?|required|needed|wanted|due|by|before|no later than)\b`)
+	datePatterns = regexp.MustCompile(`(?i)\b(\d{4}-\d{2}-\d{2}|\d{1,2}[./-]\d{1,2}[./-]\d{2,4}|\d{1,2}(?:st|nd|rd|th)?\s+(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?,?\s+\d{4})\b`)
+	dateOrdinal  = regexp.MustCompile(`(?i)^(\d{1,2})(?:st|nd|rd|th)`)
+)
+
+// findRequestedDate returns the first date on a line that talks about delivery or deadlines.
+func findRequestedDate(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if !dateLabel.MatchString(line) {
+			continue
+		}
+		for _, match := range datePatterns.FindAllString(line, -1) {
+			if date := parseOrderDate(match); date != "" {
+				return date
+			}
+		}
+	}
+	return ""
+}
+
+// parseOrderDate reads a date as YYYY-MM-DD. Numeric dates are taken as day first, as our
+// customers write them.
+func parseOrderDate(s string) string {
+	s = strings.TrimSpace(dateOrdinal.ReplaceAllString(strings.TrimSpace(s), "$1"))
+	s = strings.NewReplacer(",", "", ".", "/", "-", "/", "sept ", "sep ").Replace(strings.ToLower(s))
+	if len(s) == 10 && s[4] == '/' {
+		s = s[8:] + "/" + s[5:7] + "/" + s[:4] // Was YYYY-MM-DD
+	}
+	for _, layout := range []string{"2/1/2006", "2/1/06", "2 January 2006", "2 Jan 2006", "2 Jan/ 2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.DateOnly)
+		}
+	}
+	return ""
+}
+
+var (
+	addressLabel = regexp.MustCompile(`(?i)^\s*(?:delivery address|deliver to|delivery to|ship to|shipping address|send to)\s*:\s*(.*)$`)
+	addressEnd   = regexp.MustCompile(`(?i):|^(?:thanks|thank you|many thanks|regards|kind regards|best|cheers)\b`)
+)
+
+// addressBlock finds the first label at or after lines[from], such as addressLabel's "Delivery
+// address:", and the address after it, including the lines below up to a blank line, another
+// label, a date or a sign-off. It returns the label's line, the line after the address and the
+// address's parts, or a start of -1 if there is none.
+func addressBlock(lines []string, from int, label *regexp.Regexp) (start, end int, parts []string) {
+	for i := from; i < len(lines); i++ {
+		m := label.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		if first := strings.TrimSpace(m[1]); first != "" {
+			parts = append(parts, strings.TrimRight(first, ","))
+		}
+		end = i + 1
+		for ; end < len(lines); end++ {
+			next := strings.TrimSpace(lines[end])
+			if next == "" || len(parts) == 6 || addressEnd.MatchString(next) || dateLabel.MatchString(next) {
+				break
+			}
+			parts = append(parts, strings.TrimRight(next, ","))
+		}
+		if len(parts) > 0 {
+			return i, end, parts
+		}
+	}
+	return -1, -1, nil
+}
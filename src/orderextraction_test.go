@@ -0,0 +1,241 @@
+package inbound
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestExtractOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      EmailContent
+		want     []LineItem
+		date     string
+		address  string
+		leftover []string
+	}{
+		{
+			name: "markdown table with address and date",
+			msg: EmailContent{PlainText: "Hi there,\nPlease send the following:\n\n" +
+				"| Product | SKU | Qty |\n|---|---|---|\n| Blue Widget | WID-100 | 5 |\n| Red Gloves | GLV-2 | 2 boxes |\n| Total | | 7 |\n\n" +
+				"Delivery address: Unit 4, Mill Lane\nLeeds LS1 2AB\nNeeded by 12/03/2026\n\nKind regards,\nJo"},
+			want: []LineItem{
+				{Product: "Blue Widget", SKU: "WID-100", Quantity: 5, Source: "table"},
+				{Product: "Red Gloves", SKU: "GLV-2", Quantity: 2, Unit: "boxes", Source: "table"},
+			},
+			date:    "2026-03-12",
+			address: "Unit 4, Mill Lane, Leeds LS1 2AB",
+		},
+		{
+			name: "tab separated table",
+			msg:  EmailContent{PlainText: "Item\tQuantity\tRequired by\nBlue Widget\t10kg\t1st March 2026\n"},
+			want: []LineItem{{Product: "Blue Widget", Quantity: 10, Unit: "kg", RequestedDate: "2026-03-01", Source: "table"}},
+		},
+		{
+			name: "CSV attachment",
+			msg: EmailContent{
+				PlainText:   "Order attached.",
+				Attachments: []Attachment{{Filename: "order.csv", ContentType: "application/octet-stream", Data: []byte("sku,qty\nWID-100,3\nGLV-2,1\n")}},
+			},
+			want: []LineItem{
+				{SKU: "WID-100", Quantity: 3, Source: "attachment:order.csv"},
+				{SKU: "GLV-2", Quantity: 1, Source: "attachment:order.csv"},
+			},
+			leftover: []string{"Order attached."},
+		},
+		{
+			name: "item lines",
+			msg:  EmailContent{PlainText: "Hi,\n5 x Blue Widget\n3 boxes of Red Gloves\n- Hi-vis Vest: 2\nThanks\nJo"},
+			want: []LineItem{
+				{Product: "Blue Widget", Quantity: 5, Source: "line"},
+				{Product: "Red Gloves", Quantity: 3, Unit: "boxes", Source: "line"},
+				{Product: "Hi-vis Vest", Quantity: 2, Source: "line"},
+			},
+		},
+		{
+			name: "product first lines next to each other",
+			msg:  EmailContent{PlainText: "Blue Widget x 5\nRed Gloves - 2 pcs"},
+			want: []LineItem{
+				{Product: "Blue Widget", Quantity: 5, Source: "line"},
+				{Product: "Red Gloves", Quantity: 2, Unit: "pcs", Source: "line"},
+			},
+		},
+		{
+			name:     "lone product first line is not trusted",
+			msg:      EmailContent{PlainText: "Blue Widget x 5\n\nthanks"},
+			leftover: []string{"Blue Widget x 5"},
+		},
+		{
+			name: "free text beside an item line is left over",
+			msg:  EmailContent{PlainText: "5 x Blue Widget\nAlso we need a couple of the red gloves and some hi-vis vests"},
+			want: []LineItem{{Product: "Blue Widget", Quantity: 5, Source: "line"}},
+			leftover: []string{
+				"Also we need a couple of the red gloves and some hi-vis vests",
+			},
+		},
+		{
+			name: "a time is not a quantity",
+			msg:  EmailContent{PlainText: "Can we meet tomorrow at 3:30"},
+		},
+		{
+			name:     "a sentence ending in a number is not an item",
+			msg:      EmailContent{PlainText: "We had 2 deliveries last week - 3"},
+			leftover: []string{"We had 2 deliveries last week - 3"},
+		},
+		{
+			name:     "labels are not items",
+			msg:      EmailContent{PlainText: "Order no: 1234\nPO: 55\nPlease call about the invoice"},
+			leftover: []string{"Please call about the invoice"},
+		},
+		{
+			name: "signature and quoted reply are not left over",
+			msg:  EmailContent{PlainText: "5 x Blue Widget\nCheers\nJo Bloggs\nAcme Ltd\n\nOn Mon, Jo wrote:\n> something else"},
+			want: []LineItem{{Product: "Blue Widget", Quantity: 5, Source: "line"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, leftover := extractOrder(&tt.msg)
+			if !reflect.DeepEqual(order.Items, tt.want) {
+				t.Errorf("items = %+v, want %+v", order.Items, tt.want)
+			}
+			if order.RequestedDate != tt.date {
+				t.Errorf("requested date = %q, want %q", order.RequestedDate, tt.date)
+			}
+			if order.DeliveryAddress != tt.address {
+				t.Errorf("delivery address = %q, want %q", order.DeliveryAddress, tt.address)
+			}
+			if !reflect.DeepEqual(leftover, tt.leftover) {
+				t.Errorf("leftover = %q, want %q", leftover, tt.leftover)
+			}
+		})
+	}
+}
+
+// orderPicker answers with a fixed order and counts how often it was asked.
+type orderPicker struct {
+	order *Order
+	calls int
+}
+
+func (p *orderPicker) Pick(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+	p.calls++
+	order := *p.order
+	order.Items = append([]LineItem(nil), p.order.Items...)
+	return &Answer{Order: &order}, nil
+}
+
+func TestPickOrder(t *testing.T) {
+	llmOrder := &Order{
+		Items: []LineItem{
+			{Product: "Blue Widgets", Quantity: 5},
+			{Product: "red gloves", Quantity: 2},
+			{Product: "hi-vis vests", Quantity: 1},
+		},
+		DeliveryAddress: "1 High St, York",
+	}
+	tests := []struct {
+		name    string
+		body    string
+		calls   int
+		summary string
+	}{
+		{
+			name:    "table only skips the LLM",
+			body:    "| Product | Qty |\n|---|---|\n| Blue Widget | 5 |\n\nThanks",
+			calls:   0,
+			summary: "5 x Blue Widget",
+		},
+		{
+			name:    "free text beside item lines is merged",
+			body:    "5 x Blue Widget\nAlso we need a couple of the red gloves and some hi-vis vests",
+			calls:   1,
+			summary: "5 x Blue Widget\n2 x red gloves\n1 x hi-vis vests",
+		},
+		{
+			name:    "no items asks the LLM",
+			body:    "Can we meet tomorrow at 3:30",
+			calls:   1,
+			summary: "5 x Blue Widgets\n2 x red gloves\n1 x hi-vis vests",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picker := &orderPicker{order: llmOrder}
+			answer, err := pickOrder(context.Background(), picker, &Route{ExtractOrder: true}, "m1", &EmailContent{PlainText: tt.body})
+			if err != nil {
+				t.Fatalf("pickOrder() error = %v", err)
+			}
+			if picker.calls != tt.calls {
+				t.Errorf("LLM asked %d times, want %d", picker.calls, tt.calls)
+			}
+			if got := answer.Order.Summary(); got != tt.summary {
+				t.Errorf("order = %q, want %q", got, tt.summary)
+			}
+		})
+	}
+}
+
+func TestPickOrderWithoutLLMOrder(t *testing.T) {
+	picker := pickerFunc(func(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+		return &Answer{Text: "BW-100 x5", Pick: &ProductPick{SKU: "BW-100", Quantity: 5}}, nil
+	})
+	body := "5 x Blue Widget\nDelivery address: 1 High St, York\n\nDo you stock gloves too?"
+
+	answer, err := pickOrder(context.Background(), picker, &Route{ExtractOrder: true}, "m1", &EmailContent{PlainText: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Order == nil || answer.Order.Summary() != "5 x Blue Widget" || answer.Pick == nil {
+		t.Fatalf("pickOrder() = %+v, want the pick kept and the email's items as the order", answer)
+	}
+	if item := answer.Order.Items[0]; item.DeliveryAddress == "" || item.DeliveryAddress != answer.Order.DeliveryAddress {
+		t.Errorf("item delivery address = %q, want the order's %q", item.DeliveryAddress, answer.Order.DeliveryAddress)
+	}
+
+	answer, err = pickOrder(context.Background(), picker, &Route{ExtractOrder: true}, "m1", &EmailContent{PlainText: "Can we meet tomorrow?"})
+	if err != nil || answer.Order != nil {
+		t.Errorf("pickOrder() with nothing found = %+v, %v; want no order", answer, err)
+	}
+}
+
+func TestParseOrderDate(t *testing.T) {
+	tests := map[string]string{
+		"2026-03-12":     "2026-03-12",
+		"12/03/2026":     "2026-03-12",
+		"12.03.26":       "2026-03-12",
+		"1st March 2026": "2026-03-01",
+		"3 Sept 2026":    "2026-09-03",
+		"12 Mar, 2026":   "2026-03-12",
+		"31/02/2026":     "",
+		"next Tuesday":   "",
+		"":               "",
+	}
+	for in, want := range tests {
+		if got := parseOrderDate(in); got != want {
+			t.Errorf("parseOrderDate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    float64
+		unit string
+	}{
+		{"5", 5, ""},
+		{"2,5", 2.5, ""},
+		{"10kg", 10, "kg"},
+		{"3 Boxes", 3, "boxes"},
+		{"lots", 0, ""},
+	}
+	for _, tt := range tests {
+		if n, unit := parseQuantity(tt.in); n != tt.n || unit != tt.unit {
+			t.Errorf("parseQuantity(%q) = %v, %q; want %v, %q", tt.in, n, unit, tt.n, tt.unit)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package inbound
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// LLM backends a ProductPicker can use, chosen with LLM_BACKEND or a route's backend.
+const (
+	BackendAssistants string = "assistants" // Assistants v2 threads and runs (default)
+	BackendChat       string = "chat"       // Stateless Chat Completions
+	BackendResponses  string = "responses"  // Responses API
+	BackendLocal      string = "local"      // OpenAI-compatible local server, e.g. Ollama or llama.cpp
+)
+
+const defaultPickerInstructions = "You work out which product a customer needs from the email they sent us. " +
+	"Reply with the product and quantity required, or a question to ask the customer if it is unclear."
+
+// ProductPicker works out what an email is asking for. On an error, the Answer may still be
+// returned, holding only the usage incurred, so that failed emails are costed too.
+type ProductPicker interface {
+	Pick(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error)
+}
+
+// Answer is what a picker made of an email.
+type Answer struct {
+	Text  string       // The reply as given
+	Pick  *ProductPick // Decoded reply, for routes with structured_output
+	Order *Order       // Decoded reply, for routes with extract_order
+	Usage ModelUsage   // Tokens used getting the reply
+
+	// Fallback marks a guess made without the LLM, which is worth asking again later.
+	Fallback bool
+}
+
+func knownBackend(backend string) bool {
+	switch backend {
+	case BackendAssistants, BackendChat, BackendResponses, BackendLocal:
+		return true
+	}
+	return false
+}
+
+// ProductPickerFromEnv builds a picker for LLM_BACKEND (default "assistants") that also serves
+// routes naming a different backend. With a catalogue, assistants can look products up mid-run.
+func ProductPickerFromEnv(catalogue *Catalogue) (ProductPicker, error) {
+	backend := os.Getenv("LLM_BACKEND")
+	if backend == "" {
+		backend = BackendAssistants
+	}
+	if !knownBackend(backend) {
+		return nil, fmt.Errorf("unknown LLM_BACKEND %q", backend)
+	}
+	return &backendPicker{defaultBackend: backend, catalogue: catalogue, pickers: map[string]ProductPicker{}}, nil
+}
+
+// backendPicker hands each email to the picker for its route's backend, creating pickers lazily
+// so that unused backends need no configuration.
+type backendPicker struct {
+	defaultBackend string
+	catalogue      *Catalogue
+
+	mu      sync.Mutex
+	pickers map[string]ProductPicker
+}
+
+func (b *backendPicker) Pick(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+	backend := route.Backend
+	if backend == "" {
+		backend = b.defaultBackend
+	}
+
+	b.mu.Lock()
+	picker, ok := b.pickers[backend]
+	if !ok {
+		var err error
+		picker, err = newBackendPicker(backend, b.catalogue)
+		if err != nil {
+			b.mu.Unlock()
+			return nil, err
+		}
+		b.pickers[backend] = picker
+	}
+	b.mu.Unlock()
+
+	return picker.Pick(ctx, route, messageID, msg)
+}
+
+func newBackendPicker(backend string, catalogue *Catalogue) (ProductPicker, error) {
+	if backend == BackendLocal {
+		baseURL := os.Getenv("LOCAL_LLM_BASE_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:11434/v1"
+		}
+		return &chatPicker{
+			client: NewChatClient(os.Getenv("LOCAL_LLM_API_KEY"), WithBaseURL(baseURL)),
+			model:  envOr("LOCAL_LLM_MODEL", "llama3.1"),
+		}, nil
+	}
+
+	openAIKey, err := GetOpenAICredential()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OPEN_AI_CREDENTIAL: %w", err)
+	}
+	options := AssistantOptionsFromEnv()
+	model := envOr("OPENAI_MODEL", "gpt-4o-mini")
+
+	switch backend {
+	case BackendAssistants:
+		return &assistantsPicker{openAIKey: openAIKey, options: options, attachments: AttachmentOptionsFromEnv(), catalogue: catalogue}, nil
+	case BackendChat:
+		return &chatPicker{client: NewChatClient(openAIKey, options...), model: model}, nil
+	case BackendResponses:
+		return &responsesPicker{client: NewResponsesClient(openAIKey, options...), model: model}, nil
+	}
+	return nil, fmt.Errorf("unknown backend %q", backend)
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// routeInstructions is the system prompt for stateless backends, which have no stored assistant.
+func routeInstructions(route *Route) string {
+	instructions := route.Instructions
+	if instructions == "" {
+		instructions = envOr("PICKER_INSTRUCTIONS", defaultPickerInstructions)
+	}
+	if additional := additionalInstructions(route); additional != "" {
+		instructions += "\n\n" + additional
+	}
+	return instructions
+}
+
+// additionalInstructions is what a route adds to the instructions, including how to list orders.
+func additionalInstructions(route *Route) string {
+	if !route.ExtractOrder {
+		return route.AdditionalInstructions
+	}
+	if route.AdditionalInstructions == "" {
+		return orderInstructions
+	}
+	return route.AdditionalInstructions + "\n\n" + orderInstructions
+}
+
+// structuredReply gives the format a route's replies must follow and a constructor for what they
+// decode into, or nil for free text.
+func structuredReply(route *Route) (*ResponseFormat, func() Validator) {
+	switch {
+	case route.ExtractOrder:
+		return OrderFormat, func() Validator { return &Order{} }
+	case route.StructuredOutput:
+		return ProductPickFormat, func() Validator { return &ProductPick{} }
+	}
+	return nil, nil
+}
+
+// structuredAnswer puts a decoded reply in the Answer field for its type.
+func structuredAnswer(reply string, decoded Validator, usage ModelUsage) *Answer {
+	answer := &Answer{Text: reply, Usage: usage}
+	switch v := decoded.(type) {
+	case *ProductPick:
+		answer.Pick = v
+	case *Order:
+		answer.Order = v
+	}
+	return answer
+}
+
+// runOptions carries a route's overrides to an assistants run and tags the run with the email.
+func runOptions(route *Route, messageID string) []RunOption {
+	options := []RunOption{WithRunMetadata(map[string]string{"ses_message_id": messageID, "route": route.Name})}
+	if route.Model != "" {
+		options = append(options, WithModel(route.Model))
+	}
+	if additional := additionalInstructions(route); additional != "" {
+		options = append(options, WithAdditionalInstructions(additional))
+	}
+	if route.Temperature != nil {
+		options = append(options, WithTemperature(*route.Temperature))
+	}
+	return options
+}
+
+// assistantsPicker asks the route's OpenAI assistant on a fresh thread.
+type assistantsPicker struct {
+	openAIKey   string
+	options     []AssistantOption
+	attachments AttachmentOptions
+	catalogue   *Catalogue // Answers the assistant's lookup_product calls; nil leaves them unanswered
+}
+
+func (p *assistantsPicker) Pick(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+	if route.AssistantID == "" {
+		return nil, fmt.Errorf("route %s has no assistant_id and ASSISTANT_PRODUCT_PICKER is unset", route.Name)
+	}
+
+	// Tag the thread so it can be traced back to the email
+	assistant := newAssistant(p.openAIKey, route.AssistantID, 0, p.options)
+	metadata := map[string]string{"ses_message_id": messageID, "route": route.Name}
+	if _, err := assistant.CreateThread(ctx, nil, metadata); err != nil {
+		return nil, fmt.Errorf("failed to initialize OpenAI Assistant: %w", err)
+	}
+	assistant.SetInstructions(route.Instructions)
+	if p.catalogue != nil {
+		if err := assistant.RegisterDeclaredTool(catalogueToolName, catalogueToolDescription, catalogueToolParameters, p.catalogue.Lookup); err != nil {
+			return nil, fmt.Errorf("failed to register %s: %w", catalogueToolName, err)
+		}
+	}
+
+	if len(msg.Attachments) > 0 {
+		defer assistant.DeleteUploadedFiles()
+		if err := assistant.AttachFiles(ctx, msg.Attachments, p.attachments); err != nil {
+			return nil, fmt.Errorf("failed to attach files: %w", err)
+		}
+	}
+
+	log.Printf("Assistant initialized. Using Thread ID: %s for message %s\n", assistant.GetThreadID(), messageID)
+	log.Printf("\nUser: %s\n", msg.PlainText)
+
+	if format, decoded := structuredReply(route); format != nil {
+		out := decoded()
+		reply, err := assistant.AddMessageToThreadJSONContext(ctx, msg.PlainText, format, out, 2, runOptions(route, messageID)...)
+		if err != nil {
+			return &Answer{Usage: assistant.Usage()}, fmt.Errorf("failed to get %s from assistant: %w", format.JSONSchema.Name, err)
+		}
+		return structuredAnswer(reply, out, assistant.Usage()), nil
+	}
+
+	reply, err := assistant.AddMessageToThreadContext(ctx, msg.PlainText, runOptions(route, messageID)...)
+	if err != nil {
+		return &Answer{Usage: assistant.Usage()}, fmt.Errorf("failed to get reply from assistant: %w", err)
+	}
+
+	return &Answer{Text: reply, Usage: assistant.Usage()}, nil
+}
+
+// chatPicker asks a Chat Completions model, including local OpenAI-compatible servers.
+type chatPicker struct {
+	client *ChatClient
+	model  string
+}
+
+func (p *chatPicker) Pick(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+	request := &ChatCompletionRequest{
+		Model: p.model,
+		Messages: []ChatMessage{
+			{Role: "system", Content: routeInstructions(route)},
+			{Role: "user", Content: msg.PlainText},
+		},
+		Temperature: route.Temperature,
+	}
+	if route.Model != "" {
+		request.Model = route.Model
+	}
+	request.ResponseFormat, _ = structuredReply(route)
+
+	return pickStateless(route, func(feedback []ChatMessage, usage ModelUsage) (string, error) {
+		request.Messages = append(request.Messages, feedback...)
+		completion, err := p.client.CreateChatCompletion(ctx, request)
+		if err != nil {
+			return "", err
+		}
+		if completion.Usage != nil {
+			usage.Add(completion.Model, *completion.Usage)
+		}
+		return completion.Choices[0].Message.Content, nil
+	})
+}
+
+// responsesPicker asks a model through the Responses API, without storing the conversation.
+type responsesPicker struct {
+	client *ResponsesClient
+	model  string
+}
+
+func (p *responsesPicker) Pick(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+	store := false
+	request := &ResponseRequest{
+		Model:        p.model,
+		Instructions: routeInstructions(route),
+		Input:        []ChatMessage{{Role: "user", Content: msg.PlainText}},
+		Temperature:  route.Temperature,
+		Store:        &store,
+	}
+	if route.Model != "" {
+		request.Model = route.Model
+	}
+	format, _ := structuredReply(route)
+	request.Text = textFormatFor(format)
+
+	return pickStateless(route, func(feedback []ChatMessage, usage ModelUsage) (string, error) {
+		request.Input = append(request.Input, feedback...)
+		response, err := p.client.CreateResponse(ctx, request)
+		if response != nil && response.Usage != nil {
+			usage.Add(response.Model, Usage{
+				PromptTokens:     response.Usage.InputTokens,
+				CompletionTokens: response.Usage.OutputTokens,
+				TotalTokens:      response.Usage.TotalTokens,
+			})
+		}
+		if err != nil {
+			return "", err
+		}
+		return response.OutputText(), nil
+	})
+}
+
+// pickStateless runs complete once, or for structured routes until the reply decodes into a valid
+// ProductPick or Order (two attempts), passing the previous reply and the problem back as feedback.
+func pickStateless(route *Route, complete func(feedback []ChatMessage, usage ModelUsage) (string, error)) (*Answer, error) {
+	usage := ModelUsage{}
+	reply, err := complete(nil, usage)
+	if err != nil {
+		return &Answer{Usage: usage}, fmt.Errorf("failed to get reply: %w", err)
+	}
+	format, decoded := structuredReply(route)
+	if format == nil {
+		return &Answer{Text: reply, Usage: usage}, nil
+	}
+
+	const maxAttempts = 2
+	for attempt := 1; ; attempt++ {
+		out := decoded()
+		err := decodeStructuredReply(reply, out)
+		if err == nil {
+			return structuredAnswer(reply, out, usage), nil
+		}
+		if attempt == maxAttempts {
+			return &Answer{Usage: usage}, fmt.Errorf("no valid structured reply after %d attempts: %w", maxAttempts, err)
+		}
+
+		reply, err = complete([]ChatMessage{
+			{Role: "assistant", Content: reply},
+			{Role: "user", Content: fmt.Sprintf("Your previous reply was invalid: %v. Reply again with only a JSON object matching the required schema.", err)},
+		}, usage)
+		if err != nil {
+			return &Answer{Usage: usage}, fmt.Errorf("failed to get reply: %w", err)
+		}
+	}
+}
+
+// FakePicker answers without calling any LLM, for local runs.
+type FakePicker struct {
+	Reply string
+}
+
+func (p *FakePicker) Pick(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+	return &Answer{Text: p.Reply}, nil
+}
@@ -0,0 +1,204 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const validPick = `{"sku": "BW-100", "quantity": 5, "confidence": 0.9, "rationale": "", "clarifying_question": ""}`
+
+func chatCompletion(content string) string {
+	b, _ := json.Marshal(content)
+	return `{"id": "chatcmpl_1", "model": "gpt-4o-mini", "choices": [{"index": 0, "message": {"role": "assistant", "content": ` + string(b) + `}}],
+		"usage": {"prompt_tokens": 20, "completion_tokens": 10, "total_tokens": 30}}`
+}
+
+func TestChatPicker(t *testing.T) {
+	const route = "POST /v1/chat/completions"
+	temperature := 0.2
+	tests := []struct {
+		name     string
+		route    Route
+		replies  []string
+		wantText string
+		wantSKU  string
+		wantErr  bool
+		requests int
+	}{
+		{name: "free text", route: Route{Name: "default"}, replies: []string{chatCompletion("Blue Widget x5")}, wantText: "Blue Widget x5", requests: 1},
+		{
+			name:     "structured, valid first time",
+			route:    Route{Name: "picks", StructuredOutput: true, Model: "gpt-4o", Temperature: &temperature},
+			replies:  []string{chatCompletion(validPick)},
+			wantSKU:  "BW-100",
+			requests: 1,
+		},
+		{
+			name:     "structured, corrected on the second attempt",
+			route:    Route{Name: "picks", StructuredOutput: true},
+			replies:  []string{chatCompletion("Blue Widget x5"), chatCompletion(validPick)},
+			wantSKU:  "BW-100",
+			requests: 2,
+		},
+		{
+			name:     "structured, never valid",
+			route:    Route{Name: "picks", StructuredOutput: true},
+			replies:  []string{chatCompletion("Blue Widget x5")},
+			wantErr:  true,
+			requests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOpenAI(t)
+			f.reply(route, http.StatusOK, tt.replies...)
+			p := &chatPicker{client: NewChatClient("sk-test", WithBaseURL(f.URL+"/v1")), model: "gpt-4o-mini"}
+
+			answer, err := p.Pick(context.Background(), &tt.route, "msg-1", &EmailContent{PlainText: "5 blue widgets please"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Pick() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if answer == nil {
+				t.Fatal("Pick() returned no answer")
+			}
+			if got := answer.Usage["gpt-4o-mini"].TotalTokens; got != 30*tt.requests {
+				t.Errorf("usage = %+v, want %d tokens", answer.Usage, 30*tt.requests)
+			}
+			if err != nil {
+				return
+			}
+			if answer.Text != tt.wantText && tt.wantText != "" {
+				t.Errorf("Text = %q, want %q", answer.Text, tt.wantText)
+			}
+			if tt.wantSKU != "" && (answer.Pick == nil || answer.Pick.SKU != tt.wantSKU) {
+				t.Errorf("Pick = %+v, want %s", answer.Pick, tt.wantSKU)
+			}
+
+			requests := f.received(route)
+			if len(requests) != tt.requests {
+				t.Fatalf("sent %d requests, want %d", len(requests), tt.requests)
+			}
+			var first, last ChatCompletionRequest
+			json.Unmarshal([]byte(requests[0].Body), &first)
+			json.Unmarshal([]byte(requests[len(requests)-1].Body), &last)
+			if len(first.Messages) != 2 || first.Messages[0].Role != "system" || first.Messages[1].Content != "5 blue widgets please" {
+				t.Errorf("messages = %+v, want the instructions and the email", first.Messages)
+			}
+			if tt.route.Model != "" && first.Model != tt.route.Model || tt.route.Model == "" && first.Model != "gpt-4o-mini" {
+				t.Errorf("model = %q", first.Model)
+			}
+			if tt.route.Temperature != nil && (first.Temperature == nil || *first.Temperature != temperature) {
+				t.Errorf("temperature = %v, want the route's", first.Temperature)
+			}
+			if tt.route.StructuredOutput != (first.ResponseFormat != nil) {
+				t.Errorf("response_format = %+v", first.ResponseFormat)
+			}
+			if tt.requests > 1 && (len(last.Messages) != 4 || last.Messages[2].Role != "assistant" || !strings.Contains(last.Messages[3].Content, "previous reply was invalid")) {
+				t.Errorf("retry messages = %+v, want the invalid reply and the problem", last.Messages)
+			}
+		})
+	}
+}
+
+func TestResponsesPicker(t *testing.T) {
+	const route = "POST /v1/responses"
+	response := func(status, text string) string {
+		b, _ := json.Marshal(text)
+		return `{"id": "resp_1", "model": "gpt-4o-mini", "status": "` + status + `", "incomplete_details": {"reason": "max_output_tokens"},
+			"output": [{"type": "reasoning"}, {"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": ` + string(b) + `}]}],
+			"usage": {"input_tokens": 20, "output_tokens": 10, "total_tokens": 30}}`
+	}
+
+	t.Run("structured", func(t *testing.T) {
+		f := newFakeOpenAI(t)
+		f.reply(route, http.StatusOK, response("completed", validPick))
+		p := &responsesPicker{client: NewResponsesClient("sk-test", WithBaseURL(f.URL+"/v1")), model: "gpt-4o-mini"}
+
+		answer, err := p.Pick(context.Background(), &Route{Name: "picks", StructuredOutput: true, Instructions: "Pick widgets."}, "msg-1", &EmailContent{PlainText: "5 blue widgets"})
+		if err != nil || answer.Pick == nil || answer.Pick.SKU != "BW-100" {
+			t.Fatalf("Pick() = %+v, %v", answer, err)
+		}
+		var request ResponseRequest
+		json.Unmarshal([]byte(f.received(route)[0].Body), &request)
+		if request.Store == nil || *request.Store || request.Instructions != "Pick widgets." {
+			t.Errorf("request = %+v, want store false and the route's instructions", request)
+		}
+		if request.Text == nil || request.Text.Format.Type != "json_schema" || request.Text.Format.Name != "product_pick" || !request.Text.Format.Strict {
+			t.Errorf("text format = %+v, want the product_pick schema", request.Text)
+		}
+	})
+
+	t.Run("incomplete responses still count their usage", func(t *testing.T) {
+		f := newFakeOpenAI(t)
+		f.reply(route, http.StatusOK, response("incomplete", "Blue"))
+		p := &responsesPicker{client: NewResponsesClient("sk-test", WithBaseURL(f.URL+"/v1")), model: "gpt-4o-mini"}
+
+		answer, err := p.Pick(context.Background(), &Route{Name: "default"}, "msg-1", &EmailContent{PlainText: "5 blue widgets"})
+		var runErr *RunError
+		if !errors.As(err, &runErr) || runErr.Status != RunStatusIncomplete {
+			t.Fatalf("Pick() error = %v, want an incomplete *RunError", err)
+		}
+		if answer == nil || answer.Usage["gpt-4o-mini"].TotalTokens != 30 {
+			t.Errorf("answer = %+v, want the usage counted", answer)
+		}
+	})
+}
+
+func TestBackendPicker(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.reply("POST /v1/chat/completions", http.StatusOK, chatCompletion("Blue Widget x5"))
+	t.Setenv("LOCAL_LLM_BASE_URL", f.URL+"/v1")
+	t.Setenv("LOCAL_LLM_MODEL", "llama3.1:8b")
+	t.Setenv("OPEN_AI_CREDENTIAL", "")
+
+	t.Setenv("LLM_BACKEND", "carrier-pigeon")
+	if _, err := ProductPickerFromEnv(nil); err == nil {
+		t.Error("ProductPickerFromEnv() accepted an unknown backend")
+	}
+
+	t.Setenv("LLM_BACKEND", BackendLocal)
+	picker, err := ProductPickerFromEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		answer, err := picker.Pick(context.Background(), &Route{Name: "default"}, "msg-1", &EmailContent{PlainText: "5 blue widgets"})
+		if err != nil || answer.Text != "Blue Widget x5" {
+			t.Fatalf("Pick() = %+v, %v", answer, err)
+		}
+	}
+	requests := f.received("POST /v1/chat/completions")
+	var request ChatCompletionRequest
+	json.Unmarshal([]byte(requests[0].Body), &request)
+	if request.Model != "llama3.1:8b" || requests[0].Header.Get("Authorization") != "" {
+		t.Errorf("local request = model %q, headers %v; want LOCAL_LLM_MODEL and no key", request.Model, requests[0].Header)
+	}
+	if n := len(picker.(*backendPicker).pickers); n != 1 {
+		t.Errorf("created %d pickers for two emails, want 1", n)
+	}
+
+	// Routes can pick another backend, which then needs its own configuration.
+	_, err = picker.Pick(context.Background(), &Route{Name: "orders", Backend: BackendChat}, "msg-2", &EmailContent{PlainText: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "OPEN_AI_CREDENTIAL") {
+		t.Errorf("Pick() for the chat backend without a key = %v, want OPEN_AI_CREDENTIAL missing", err)
+	}
+}
+
+func TestRouteInstructions(t *testing.T) {
+	t.Setenv("PICKER_INSTRUCTIONS", "")
+	if got := routeInstructions(&Route{}); got != defaultPickerInstructions {
+		t.Errorf("routeInstructions() = %q, want the default", got)
+	}
+	t.Setenv("PICKER_INSTRUCTIONS", "Pick widgets.")
+	if got := routeInstructions(&Route{AdditionalInstructions: "Trade accounts only."}); got != "Pick widgets.\n\nTrade accounts only." {
+		t.Errorf("routeInstructions() = %q", got)
+	}
+	got := routeInstructions(&Route{Instructions: "Pick spades.", ExtractOrder: true})
+	if !strings.HasPrefix(got, "Pick spades.\n\n") || !strings.HasSuffix(got, orderInstructions) {
+		t.Errorf("routeInstructions() for orders = %q, want the order instructions added", got)
+	}
+}
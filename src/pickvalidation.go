@@ -0,0 +1,147 @@
+package inbound
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Outcomes of checking an answer against the catalogue.
+const (
+	PickAccepted    string = "accepted"
+	PickNeedsReview string = "needs_review" // A person should check the pick before it is acted on
+	PickRejected    string = "rejected"     // The pick names no product in the catalogue
+)
+
+// PickValidation is the verdict on an answer, for sinks to act on.
+type PickValidation struct {
+	Status      string
+	Product     *Product // The catalogue product the answer resolved to, if any
+	MatchScore  float64  // How closely the answer matched Product, from 0 to 1
+	OriginalSKU string   // What the assistant said, when it was normalised to Product's SKU
+	Reasons     []string // Why the pick was normalised, held for review or rejected
+}
+
+func (v *PickValidation) flag(status, reason string, args ...interface{}) {
+	if status == PickRejected || v.Status == PickAccepted {
+		v.Status = status
+	}
+	v.Reasons = append(v.Reasons, fmt.Sprintf(reason, args...))
+}
+
+// PickValidator checks answers against the catalogue before they are handed on.
+type PickValidator struct {
+	Catalogue     *Catalogue
+	MinConfidence float64 // Picks less confident than this need review
+	MinMatchScore float64 // SKUs matching no product this well are rejected
+}
+
+// DefaultPickValidator holds the thresholds PickValidatorFromEnv starts from.
+var DefaultPickValidator = PickValidator{
+	MinConfidence: 0.7,
+	MinMatchScore: 0.8,
+}
+
+// PickValidatorFromEnv checks picks against catalogue, with thresholds from PICK_MIN_CONFIDENCE
+// and PICK_MIN_MATCH_SCORE. It returns nil if there is no catalogue.
+func PickValidatorFromEnv(catalogue *Catalogue) *PickValidator {
+	if catalogue == nil {
+		return nil
+	}
+
+	validator := DefaultPickValidator
+	validator.Catalogue = catalogue
+	if v, err := strconv.ParseFloat(os.Getenv("PICK_MIN_CONFIDENCE"), 64); err == nil {
+		validator.MinConfidence = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("PICK_MIN_MATCH_SCORE"), 64); err == nil {
+		validator.MinMatchScore = v
+	}
+	return &validator
+}
+
+// Validate resolves the answer to a catalogue product. A structured pick whose SKU matches a
+// product's SKU, or is close enough to its name or alias, is rewritten to use that product's SKU
+// and its confidence scaled by how close the match was. Only exact matches are accepted without
+// review. Free-text answers are searched for products.
+func (v *PickValidator) Validate(answer *Answer) *PickValidation {
+	result := &PickValidation{Status: PickAccepted}
+	if answer.Order != nil {
+		v.validateOrder(answer.Order, result)
+		return result
+	}
+	pick := answer.Pick
+	if pick == nil {
+		mentions := v.Catalogue.Mentions(answer.Text)
+		switch len(mentions) {
+		case 0:
+			result.flag(PickNeedsReview, "reply mentions no catalogue product")
+		case 1:
+			result.Product, result.MatchScore = mentions[0], 1
+		default:
+			result.flag(PickNeedsReview, "reply mentions %d catalogue products", len(mentions))
+		}
+		return result
+	}
+
+	if pick.SKU == "" {
+		result.flag(PickNeedsReview, "assistant asked a clarifying question: %s", pick.ClarifyingQuestion)
+		return result
+	}
+
+	product, score := v.Catalogue.Match(pick.SKU)
+	if product == nil || score < v.MinMatchScore {
+		result.flag(PickRejected, "sku %q is not in the catalogue", pick.SKU)
+		return result
+	}
+	result.Product, result.MatchScore = product, score
+	if pick.SKU != product.SKU {
+		result.OriginalSKU = pick.SKU
+		result.Reasons = append(result.Reasons, fmt.Sprintf("normalised %q to sku %s (match %.2f)", pick.SKU, product.SKU, score))
+		pick.SKU = product.SKU
+		pick.Confidence *= score
+	}
+	if score < 1 {
+		result.flag(PickNeedsReview, "sku %q only resembles %s", result.OriginalSKU, product.SKU)
+	}
+
+	if pick.Confidence < v.MinConfidence {
+		result.flag(PickNeedsReview, "confidence %.2f is below %.2f", pick.Confidence, v.MinConfidence)
+	}
+	return result
+}
+
+// validateOrder resolves each line item to a product by its SKU, or failing that its description,
+// filling in the SKU. An order with some unknown items, or a SKU that only resembles a product,
+// needs review; one with none known is rejected.
+func (v *PickValidator) validateOrder(order *Order, result *PickValidation) {
+	if len(order.Items) == 0 {
+		result.flag(PickNeedsReview, "no line items found")
+		return
+	}
+
+	known := 0
+	for i := range order.Items {
+		item := &order.Items[i]
+		query := item.SKU
+		if query == "" {
+			query = item.Product
+		}
+		product, score := v.Catalogue.Match(query)
+		if product == nil || score < v.MinMatchScore {
+			result.flag(PickNeedsReview, "item %d %q is not in the catalogue", i+1, query)
+			continue
+		}
+		known++
+		if item.SKU != "" && score < 1 {
+			result.flag(PickNeedsReview, "item %d: sku %q only resembles %s", i+1, item.SKU, product.SKU)
+		}
+		if item.SKU != product.SKU {
+			result.Reasons = append(result.Reasons, fmt.Sprintf("item %d: normalised %q to sku %s (match %.2f)", i+1, query, product.SKU, score))
+			item.SKU = product.SKU
+		}
+	}
+	if known == 0 {
+		result.flag(PickRejected, "no line item is in the catalogue")
+	}
+}
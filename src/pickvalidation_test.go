@@ -0,0 +1,201 @@
+package inbound
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPickValidatorValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		answer         Answer
+		wantStatus     string
+		wantSKU        string  // The pick's SKU afterwards, and the product it resolved to
+		wantConfidence float64 // The pick's confidence afterwards
+		wantOriginal   string
+		wantReason     string
+	}{
+		{
+			name:           "exact sku",
+			answer:         Answer{Pick: &ProductPick{SKU: "BW-100", Confidence: 0.9}},
+			wantStatus:     PickAccepted,
+			wantSKU:        "BW-100",
+			wantConfidence: 0.9,
+		},
+		{
+			name:           "sku with other case and separators",
+			answer:         Answer{Pick: &ProductPick{SKU: "bw100", Confidence: 0.9}},
+			wantStatus:     PickAccepted,
+			wantSKU:        "BW-100",
+			wantConfidence: 0.9,
+			wantOriginal:   "bw100",
+			wantReason:     `normalised "bw100" to sku BW-100`,
+		},
+		{
+			name:       "near-miss sku",
+			answer:     Answer{Pick: &ProductPick{SKU: "BW-101", Confidence: 0.9}},
+			wantStatus: PickRejected,
+			wantReason: `sku "BW-101" is not in the catalogue`,
+		},
+		{
+			name:       "sku of another product one character off",
+			answer:     Answer{Pick: &ProductPick{SKU: "GW-100", Confidence: 0.9}},
+			wantStatus: PickRejected,
+		},
+		{
+			name:           "alias",
+			answer:         Answer{Pick: &ProductPick{SKU: "Azure Widget", Confidence: 0.9}},
+			wantStatus:     PickAccepted,
+			wantSKU:        "BW-100",
+			wantConfidence: 0.9,
+			wantOriginal:   "Azure Widget",
+		},
+		{
+			name:           "name close enough",
+			answer:         Answer{Pick: &ProductPick{SKU: "blue widgets", Confidence: 0.9}},
+			wantStatus:     PickNeedsReview,
+			wantSKU:        "BW-100",
+			wantConfidence: 0.9 * 20 / 21,
+			wantOriginal:   "blue widgets",
+			wantReason:     `sku "blue widgets" only resembles BW-100`,
+		},
+		{
+			name:       "below the match threshold",
+			answer:     Answer{Pick: &ProductPick{SKU: "Purple Gizmo", Confidence: 0.9}},
+			wantStatus: PickRejected,
+		},
+		{
+			name:           "low confidence",
+			answer:         Answer{Pick: &ProductPick{SKU: "GS-200", Confidence: 0.5}},
+			wantStatus:     PickNeedsReview,
+			wantSKU:        "GS-200",
+			wantConfidence: 0.5,
+			wantReason:     "confidence 0.50 is below 0.70",
+		},
+		{
+			name:       "clarifying question",
+			answer:     Answer{Pick: &ProductPick{ClarifyingQuestion: "Which colour?"}},
+			wantStatus: PickNeedsReview,
+			wantReason: "clarifying question: Which colour?",
+		},
+		{
+			name:       "reply mentioning one product",
+			answer:     Answer{Text: "They want the Green Sprocket."},
+			wantStatus: PickAccepted,
+			wantSKU:    "GS-200",
+		},
+		{
+			name:       "reply mentioning two products",
+			answer:     Answer{Text: "Either the Red Widget or RW-100's blue sibling, BW-100."},
+			wantStatus: PickNeedsReview,
+			wantReason: "mentions 2 catalogue products",
+		},
+		{
+			name:       "reply mentioning none",
+			answer:     Answer{Text: "Sorry, no idea."},
+			wantStatus: PickNeedsReview,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := DefaultPickValidator
+			validator.Catalogue = testCatalogue(t)
+			result := validator.Validate(&tt.answer)
+
+			if result.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s (%q)", result.Status, tt.wantStatus, result.Reasons)
+			}
+			sku := ""
+			if result.Product != nil {
+				sku = result.Product.SKU
+			}
+			if sku != tt.wantSKU {
+				t.Errorf("product = %s, want %s", sku, tt.wantSKU)
+			}
+			if pick := tt.answer.Pick; pick != nil && tt.wantSKU != "" {
+				if pick.SKU != tt.wantSKU || math.Abs(pick.Confidence-tt.wantConfidence) > 1e-9 {
+					t.Errorf("pick = %s at %.3f, want %s at %.3f", pick.SKU, pick.Confidence, tt.wantSKU, tt.wantConfidence)
+				}
+			}
+			if result.OriginalSKU != tt.wantOriginal {
+				t.Errorf("original sku = %q, want %q", result.OriginalSKU, tt.wantOriginal)
+			}
+			if reasons := strings.Join(result.Reasons, "; "); !strings.Contains(reasons, tt.wantReason) {
+				t.Errorf("reasons = %q, want %q", reasons, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestPickValidatorValidateOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		items      []LineItem
+		wantStatus string
+		wantSKUs   string // Comma separated, after validation
+		wantReason string
+	}{
+		{
+			name:       "exact skus",
+			items:      []LineItem{{SKU: "BW-100", Quantity: 5}, {SKU: "gs200", Quantity: 1}},
+			wantStatus: PickAccepted,
+			wantSKUs:   "BW-100,GS-200",
+		},
+		{
+			name:       "products by description",
+			items:      []LineItem{{Product: "azure widget"}, {Product: "green sprockets"}},
+			wantStatus: PickAccepted,
+			wantSKUs:   "BW-100,GS-200",
+			wantReason: `item 2: normalised "green sprockets" to sku GS-200`,
+		},
+		{
+			name:       "near-miss sku",
+			items:      []LineItem{{SKU: "BW-100"}, {SKU: "RW-101", Product: "Red Widget"}},
+			wantStatus: PickNeedsReview,
+			wantSKUs:   "BW-100,RW-101",
+			wantReason: `item 2 "RW-101" is not in the catalogue`,
+		},
+		{
+			name:       "sku resembling a name",
+			items:      []LineItem{{SKU: "red widgets"}},
+			wantStatus: PickNeedsReview,
+			wantSKUs:   "RW-100",
+			wantReason: `item 1: sku "red widgets" only resembles RW-100`,
+		},
+		{
+			name:       "nothing known",
+			items:      []LineItem{{SKU: "BW-101"}, {Product: "purple gizmo"}},
+			wantStatus: PickRejected,
+			wantSKUs:   "BW-101,",
+			wantReason: "no line item is in the catalogue",
+		},
+		{
+			name:       "no items",
+			wantStatus: PickNeedsReview,
+			wantReason: "no line items found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := DefaultPickValidator
+			validator.Catalogue = testCatalogue(t)
+			order := &Order{Items: tt.items}
+			result := validator.Validate(&Answer{Order: order})
+
+			if result.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s (%q)", result.Status, tt.wantStatus, result.Reasons)
+			}
+			var skus []string
+			for _, item := range order.Items {
+				skus = append(skus, item.SKU)
+			}
+			if got := strings.Join(skus, ","); got != tt.wantSKUs {
+				t.Errorf("skus = %s, want %s", got, tt.wantSKUs)
+			}
+			if reasons := strings.Join(result.Reasons, "; "); !strings.Contains(reasons, tt.wantReason) {
+				t.Errorf("reasons = %q, want %q", reasons, tt.wantReason)
+			}
+		})
+	}
+}
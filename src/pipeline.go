@@ -0,0 +1,251 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// EmailStore fetches the raw MIME content of a received email.
+// An empty bucket means the store's own default location.
+type EmailStore interface {
+	Fetch(ctx context.Context, bucket, key string) ([]byte, error)
+}
+
+// PermanentError marks a failure that retrying the same email cannot fix.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Pipeline ties together where emails come from, how they are routed and who answers them.
+type Pipeline struct {
+	Routes *RoutingTable
+	Store  EmailStore
+	Picker ProductPicker
+	Prices PriceTable // Prices token usage; nil leaves every model unpriced
+
+	// Validator checks answers against the catalogue; nil hands them on unchecked.
+	Validator *PickValidator
+
+	// Fallback answers when Picker can't reach the LLM or a run fails, so the email still gets a
+	// reply; nil fails the email. Configuration errors fail the email either way.
+	Fallback ProductPicker
+
+	// Redactor masks personal details before the email is logged or sent to the LLM; nil sends
+	// it as it is.
+	Redactor *Redactor
+
+	usage usageTally
+}
+
+// S3Store reads emails that an SES receipt rule saved to S3, from Bucket unless the event names one.
+type S3Store struct {
+	Client *s3.S3
+	Bucket string
+}
+
+func (s *S3Store) Fetch(ctx context.Context, bucket, key string) ([]byte, error) {
+	if bucket == "" {
+		bucket = s.Bucket
+	}
+	getObjectInput := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	result, err := s.Client.GetObjectWithContext(ctx, getObjectInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s::%s. Error: %w", bucket, key, err)
+	}
+	defer result.Body.Close()
+
+	rawEmailBytes, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raw email from S3: %w", err)
+	}
+	return rawEmailBytes, nil
+}
+
+// DirStore reads emails from a local directory, using the key as the file name.
+type DirStore struct {
+	Dir string
+}
+
+func (s *DirStore) Fetch(ctx context.Context, bucket, key string) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Join(s.Dir, filepath.Base(key)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email %s from %s: %w", key, s.Dir, err)
+	}
+	return b, nil
+}
+
+// MapStore serves emails already held in memory, keyed by message ID.
+type MapStore map[string][]byte
+
+func (s MapStore) Fetch(ctx context.Context, bucket, key string) ([]byte, error) {
+	b, ok := s[key]
+	if !ok {
+		return nil, fmt.Errorf("no email stored under key %s", key)
+	}
+	return b, nil
+}
+
+// HandleSES processes every email in an SES receipt rule Lambda event.
+func (p *Pipeline) HandleSES(ctx context.Context, sesEvent events.SimpleEmailEvent) error {
+	return p.handleInbound(ctx, inboundFromSES(sesEvent))
+}
+
+// handleInbound fetches, parses and processes emails normalised from any trigger.
+func (p *Pipeline) handleInbound(ctx context.Context, emails []*InboundEmail) error {
+	for _, email := range emails {
+		if err := p.processInbound(ctx, email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) processInbound(ctx context.Context, email *InboundEmail) error {
+	rawEmailBytes := email.Raw
+	if rawEmailBytes == nil {
+		if email.Key == "" {
+			log.Printf("email key empty for S3 action. MessageId: %s", email.MessageID)
+			return nil
+		}
+
+		var err error
+		rawEmailBytes, err = p.Store.Fetch(ctx, email.Bucket, email.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	msg, err := ParseEmailBody(bytes.NewReader(rawEmailBytes))
+
+	if err != nil {
+		// Retrying won't make a malformed email parse.
+		return &PermanentError{Err: fmt.Errorf("parse email error: %w", err)}
+	}
+
+	recipients := email.Recipients
+	if len(recipients) == 0 {
+		recipients = parseAddressList(msg.To)
+	}
+
+	messageID := email.MessageID
+	if messageID == "" {
+		messageID = email.Key
+	}
+
+	return p.Process(ctx, messageID, msg, recipients)
+}
+
+// Process routes a parsed email to its assistant and hands the reply to the route's sinks.
+// Routing sees the email as it came; the picker and the logs see it redacted, and redacted
+// values are put back into the reply before it reaches the sinks.
+func (p *Pipeline) Process(ctx context.Context, messageID string, msg *EmailContent, recipients []string) error {
+	sent, redaction := msg, (*Redaction)(nil)
+	if p.Redactor != nil {
+		sent, redaction = p.Redactor.RedactEmail(msg)
+		log.Printf("Redacted %d personal details from email %s\n", redaction.Len(), messageID)
+	}
+	log.Printf("Subject: %v\n", sent.Subject)
+	log.Printf("From: %v\n", sent.From)
+	log.Printf("To: %v\n", sent.To)
+	log.Printf("Message: %v\n", sent.PlainText)
+
+	route := p.Routes.Resolve(msg, recipients)
+	if route.Action == RouteActionDrop {
+		log.Printf("Dropping email %s per route %s\n", messageID, route.Name)
+		return nil
+	}
+	log.Printf("Email %s matched route %s, assistant %s\n", messageID, route.Name, route.AssistantID)
+
+	var answer *Answer
+	var err error
+	if route.ExtractOrder {
+		answer, err = pickOrder(ctx, p.Picker, route, messageID, sent)
+	} else {
+		answer, err = p.Picker.Pick(ctx, route, messageID, sent)
+	}
+	if answer != nil && len(answer.Usage) > 0 {
+		p.usage.add(answer.Usage)
+		cost := logUsage(fmt.Sprintf("Email %s", messageID), answer.Usage, p.Prices)
+		emitMetrics(map[string]string{"Route": route.Name}, usageMetrics(answer.Usage, cost)...)
+	}
+	if err != nil && p.Fallback != nil && transientLLMError(err) {
+		log.Printf("Picker failed for email %s, using the fallback: %v\n", messageID, err)
+		answer, err = p.Fallback.Pick(ctx, route, messageID, sent)
+		if err == nil {
+			emitMetrics(map[string]string{"Route": route.Name}, Metric{Name: "FallbackPicks", Value: 1, Unit: "Count"})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get reply for email %s: %w", messageID, err)
+	}
+	redaction.RestoreAnswer(answer)
+
+	routed := &RoutedReply{
+		Route:     route.Name,
+		MessageID: messageID,
+		Email:     msg,
+		Reply:     answer.Text,
+		Pick:      answer.Pick,
+		Order:     answer.Order,
+		Fallback:  answer.Fallback,
+		Redaction: redaction,
+	}
+	if p.Validator != nil {
+		routed.Validated = p.Validator.Validate(answer)
+		log.Printf("Email %s pick %s\n", messageID, routed.Validated.Status)
+	}
+	for _, name := range route.Sinks {
+		if err := sinks[name].Deliver(ctx, routed); err != nil {
+			return fmt.Errorf("sink %s failed for email %s: %w", name, messageID, err)
+		}
+	}
+
+	return nil
+}
+
+// LogUsage reports the token usage and cost of every email processed so far.
+func (p *Pipeline) LogUsage() {
+	emails, usage := p.usage.snapshot()
+	if emails == 0 {
+		return
+	}
+	cost := logUsage(fmt.Sprintf("Invocation (%d emails)", emails), usage, p.Prices)
+	emitMetrics(map[string]string{}, append(usageMetrics(usage, cost), Metric{Name: "EmailsCosted", Value: float64(emails), Unit: "Count"})...)
+}
+
+// transientLLMError reports whether err is the LLM being unreachable, overloaded or failing a
+// run, which the fallback can cover for. Anything else, such as a missing assistant ID or a
+// rejected API key, is a misconfiguration that should fail loudly rather than be papered over.
+func transientLLMError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable
+	}
+	var runErr *RunError
+	var netErr net.Error
+	return errors.As(err, &runErr) || errors.As(err, &netErr) ||
+		errors.Is(err, ErrRunTimeout) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, errRetryablePoll)
+}
@@ -0,0 +1,35 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestTransientLLMError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "rate limited", err: fmt.Errorf("failed to create run: %w", &APIError{StatusCode: 429, Retryable: true}), want: true},
+		{name: "server error", err: &APIError{StatusCode: 503, Retryable: true}, want: true},
+		{name: "bad API key", err: fmt.Errorf("failed to create run: %w", &APIError{StatusCode: 401}), want: false},
+		{name: "missing assistant", err: &APIError{StatusCode: 404}, want: false},
+		{name: "failed run", err: fmt.Errorf("run failed: %w", &RunError{RunID: "run_1", Status: "failed"}), want: true},
+		{name: "network", err: fmt.Errorf("error sending request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), want: true},
+		{name: "DNS", err: &net.DNSError{Name: "api.openai.com", IsTimeout: true}, want: true},
+		{name: "run timeout", err: fmt.Errorf("run_1: %w", ErrRunTimeout), want: true},
+		{name: "circuit open", err: ErrCircuitOpen, want: true},
+		{name: "poll error", err: fmt.Errorf("get run: %w", errRetryablePoll), want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "no assistant ID", err: errors.New("route orders has no assistant_id"), want: false},
+	}
+	for _, tt := range tests {
+		if got := transientLLMError(tt.err); got != tt.want {
+			t.Errorf("transientLLMError(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
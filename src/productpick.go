@@ -0,0 +1,126 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProductPick is the structured answer the product picker assistant is asked for.
+// Empty strings stand in for "none", since strict schemas require every field.
+type ProductPick struct {
+	SKU                string  `json:"sku"`
+	Quantity           int     `json:"quantity"`
+	Confidence         float64 `json:"confidence"` // 0 to 1
+	Rationale          string  `json:"rationale"`
+	ClarifyingQuestion string  `json:"clarifying_question"` // Set when the email doesn't say enough to pick
+}
+
+// ProductPickFormat constrains a run's reply to a ProductPick.
+var ProductPickFormat = &ResponseFormat{
+	Type: "json_schema",
+	JSONSchema: &JSONSchemaFormat{
+		Name:        "product_pick",
+		Description: "The product the customer needs, or a question to ask them if it is unclear.",
+		Strict:      true,
+		Schema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"sku": {"type": "string", "description": "SKU of the product required, empty if unknown"},
+				"quantity": {"type": "integer", "description": "How many the customer wants, 1 if not stated"},
+				"confidence": {"type": "number", "description": "Confidence in the pick from 0 to 1"},
+				"rationale": {"type": "string", "description": "Short reason for the pick"},
+				"clarifying_question": {"type": "string", "description": "Question for the customer if the product is unclear, otherwise empty"}
+			},
+			"required": ["sku", "quantity", "confidence", "rationale", "clarifying_question"],
+			"additionalProperties": false
+		}`),
+	},
+}
+
+// Validate checks the pick makes sense beyond what the schema can express.
+func (p *ProductPick) Validate() error {
+	if p.Confidence < 0 || p.Confidence > 1 {
+		return fmt.Errorf("confidence %v is outside 0 to 1", p.Confidence)
+	}
+	if p.SKU == "" && p.ClarifyingQuestion == "" {
+		return fmt.Errorf("neither a sku nor a clarifying_question was given")
+	}
+	if p.SKU != "" && p.Quantity < 1 {
+		return fmt.Errorf("quantity %d must be at least 1", p.Quantity)
+	}
+	return nil
+}
+
+// ResponseFormat is a run's response_format.
+type ResponseFormat struct {
+	Type       string            `json:"type"` // "text", "json_object" or "json_schema"
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+type JSONSchemaFormat struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema"`
+	Strict      bool            `json:"strict"`
+}
+
+// Validator is implemented by structured replies that can check their own contents.
+type Validator interface {
+	Validate() error
+}
+
+// AddMessageToThreadJSONContext sends prompt with the reply constrained to format and decodes it
+// into out. A reply that doesn't decode or validate is sent back to the assistant with the problem,
+// up to maxAttempts tries in total. It returns the raw reply text of the last attempt.
+func (a *Assistant) AddMessageToThreadJSONContext(ctx context.Context, prompt string, format *ResponseFormat, out Validator, maxAttempts int, options ...RunOption) (string, error) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	previous := a.responseFormat
+	a.responseFormat = format
+	defer func() { a.responseFormat = previous }()
+
+	var reply string
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		reply, err = a.AddMessageToThreadContext(ctx, prompt, options...)
+		if err != nil {
+			return "", err
+		}
+
+		err = decodeStructuredReply(reply, out)
+		if err != nil && a.lastReply != nil && len(a.lastReply.Messages) > 1 {
+			// The model may have said something before calling a tool; the answer comes last.
+			last := a.lastReply.Messages[len(a.lastReply.Messages)-1]
+			if decodeStructuredReply(last, out) == nil {
+				return last, nil
+			}
+		}
+		if err == nil {
+			return reply, nil
+		}
+		a.logError(fmt.Sprintf("Attempt %d of %d returned an invalid structured reply: %v", attempt, maxAttempts, err))
+		prompt = fmt.Sprintf("Your previous reply was invalid: %v. Reply again with only a JSON object matching the required schema.", err)
+	}
+	return reply, fmt.Errorf("no valid structured reply after %d attempts: %w", maxAttempts, err)
+}
+
+// decodeStructuredReply unmarshals a JSON reply, tolerating a markdown code fence around it.
+func decodeStructuredReply(reply string, out Validator) error {
+	text := strings.TrimSpace(reply)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("reply is not valid JSON for the schema: %w", err)
+	}
+	return out.Validate()
+}
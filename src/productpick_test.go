@@ -0,0 +1,120 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProductPickValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		pick    ProductPick
+		wantErr string
+	}{
+		{name: "a pick", pick: ProductPick{SKU: "BW-100", Quantity: 5, Confidence: 0.9}},
+		{name: "a question", pick: ProductPick{ClarifyingQuestion: "Which colour?", Confidence: 0.2}},
+		{name: "confidence over 1", pick: ProductPick{SKU: "BW-100", Quantity: 1, Confidence: 1.5}, wantErr: "outside 0 to 1"},
+		{name: "negative confidence", pick: ProductPick{SKU: "BW-100", Quantity: 1, Confidence: -0.1}, wantErr: "outside 0 to 1"},
+		{name: "neither", pick: ProductPick{Confidence: 0.5}, wantErr: "neither a sku nor a clarifying_question"},
+		{name: "no quantity", pick: ProductPick{SKU: "BW-100", Confidence: 0.9}, wantErr: "must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.pick.Validate()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeStructuredReply(t *testing.T) {
+	const pick = `{"sku": "BW-100", "quantity": 5, "confidence": 0.9, "rationale": "asked for blue widgets", "clarifying_question": ""}`
+	tests := []struct {
+		name    string
+		reply   string
+		wantErr bool
+	}{
+		{name: "plain JSON", reply: pick},
+		{name: "in a json fence", reply: "```json\n" + pick + "\n```"},
+		{name: "in a bare fence", reply: "  ```\n" + pick + "\n```  "},
+		{name: "prose", reply: "Blue Widget x5", wantErr: true},
+		{name: "unknown field", reply: `{"sku": "BW-100", "quantity": 5, "confidence": 0.9, "colour": "blue"}`, wantErr: true},
+		{name: "decodes but is invalid", reply: `{"sku": "", "quantity": 0, "confidence": 0.9, "rationale": "", "clarifying_question": ""}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ProductPick
+			err := decodeStructuredReply(tt.reply, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeStructuredReply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.SKU != "BW-100" || got.Quantity != 5 || got.Confidence != 0.9) {
+				t.Errorf("decodeStructuredReply() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestAddMessageToThreadJSONContext(t *testing.T) {
+	reply := func(text string) string {
+		b, _ := json.Marshal(text)
+		return `{"data": [{"id": "msg_1", "role": "assistant", "run_id": "run_1", "content": [{"type": "text", "text": {"value": ` + string(b) + `}}]}]}`
+	}
+	const pick = `{"sku": "BW-100", "quantity": 5, "confidence": 0.9, "rationale": "", "clarifying_question": ""}`
+
+	tests := []struct {
+		name        string
+		replies     []string
+		maxAttempts int
+		wantErr     bool
+		prompts     int // Messages sent to the thread
+	}{
+		{name: "valid first time", replies: []string{pick}, maxAttempts: 2, prompts: 1},
+		{name: "invalid then valid", replies: []string{"Blue Widget x5", pick}, maxAttempts: 2, prompts: 2},
+		{name: "never valid", replies: []string{"Blue Widget x5"}, maxAttempts: 2, wantErr: true, prompts: 2},
+		{name: "at least one attempt", replies: []string{"Blue Widget x5"}, wantErr: true, prompts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOpenAI(t)
+			f.fakeRun("completed")
+			bodies := make([]string, len(tt.replies))
+			for i, text := range tt.replies {
+				bodies[i] = reply(text)
+			}
+			f.reply("GET /v1/threads/thread_1/messages", http.StatusOK, bodies...)
+			a := f.assistant(PollRuns)
+
+			var got ProductPick
+			_, err := a.AddMessageToThreadJSONContext(context.Background(), "5 blue widgets", ProductPickFormat, &got, tt.maxAttempts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddMessageToThreadJSONContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.SKU != "BW-100" {
+				t.Errorf("pick = %+v", got)
+			}
+
+			prompts := f.received("POST /v1/threads/thread_1/messages")
+			if len(prompts) != tt.prompts {
+				t.Fatalf("sent %d messages, want %d", len(prompts), tt.prompts)
+			}
+			if len(prompts) > 1 && !strings.Contains(prompts[1].Body, "previous reply was invalid") {
+				t.Errorf("retry prompt = %s, want the problem explained", prompts[1].Body)
+			}
+			var run RunThreadPayload
+			if err := json.Unmarshal([]byte(f.received("POST /v1/threads/thread_1/runs")[0].Body), &run); err != nil {
+				t.Fatal(err)
+			}
+			if run.ResponseFormat == nil || run.ResponseFormat.JSONSchema == nil || run.ResponseFormat.JSONSchema.Name != "product_pick" {
+				t.Errorf("run response_format = %+v, want product_pick", run.ResponseFormat)
+			}
+			if a.responseFormat != nil {
+				t.Errorf("response format left as %+v after the call", a.responseFormat)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package inbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Redactor masks personal details in email content before it is sent to the LLM or logged,
+// swapping each value for a token such as [EMAIL_1] that a Redaction can swap back.
+type Redactor struct {
+	Catalogue *Catalogue // SKUs and names in the catalogue are never masked; may be nil
+	patterns  []redactionPattern
+}
+
+// redactionPattern finds one kind of personal detail: the whole match, or its "value" group if it
+// has one. valid, if set, weeds out look-alikes such as digit runs that fail a checksum.
+type redactionPattern struct {
+	kind  string
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+// Built-in patterns, most specific first so a card number isn't taken for a phone number. Phone
+// numbers need a +, a leading 0 or a label, as bare digit runs are as likely to be EANs or part
+// numbers. Addresses are only masked where labelled; see redactAddresses.
+var piiPatterns = []redactionPattern{
+	{kind: "EMAIL", re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	{kind: "IBAN", re: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), valid: validIBAN},
+	{kind: "CARD", re: regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`), valid: validLuhn},
+	{kind: "PHONE", re: regexp.MustCompile(`(?i)\b(?:tel|telephone|phone|mobile|mob|cell|fax)\b\.?(?: ?(?:no|number)\.?)?:?\s*(?P<value>\+?\(?\d[\d ().\-]{7,}\d)`), valid: phoneDigits},
+	{kind: "PHONE", re: regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?(?:\(0?\d{1,5}\)[ .\-]?)?\d|\(0\d{1,5}\)[ .\-]?\d|\b0\d)\d*(?:[ .\-]?\d+){0,5}\b`), valid: phoneDigits},
+}
+
+// piiAddressLabel starts a labelled address of any kind, not only the delivery addresses that
+// addressLabel finds for orders.
+var piiAddressLabel = regexp.MustCompile(`(?i)^\s*(?:(?:(?:delivery|postal|billing|invoice|shipping|home|office|registered|our|my)\s+)?address|deliver to|delivery to|ship to|send to)\s*:\s*(.*)$`)
+
+// redactionToken matches the tokens a Redactor writes, so later patterns leave them alone.
+var redactionToken = regexp.MustCompile(`\[[A-Z][A-Z0-9_]*_\d+\]`)
+
+// RedactorFromEnv builds a Redactor with the built-in patterns plus any from REDACT_PATTERNS
+// (inline JSON) or REDACT_PATTERNS_FILE, e.g. {"ACCOUNT": "ACC-\\d{6}"} mapping a token name to
+// a regular expression. Nothing in catalogue is masked. It returns nil if REDACT_PII is false,
+// which sends emails as they are.
+func RedactorFromEnv(catalogue *Catalogue) (*Redactor, error) {
+	if enabled, err := strconv.ParseBool(os.Getenv("REDACT_PII")); err == nil && !enabled {
+		return nil, nil
+	}
+
+	raw := []byte(os.Getenv("REDACT_PATTERNS"))
+	if len(raw) == 0 {
+		if path := os.Getenv("REDACT_PATTERNS_FILE"); path != "" {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read redaction patterns file %s: %w", path, err)
+			}
+			raw = b
+		}
+	}
+	var custom map[string]string
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &custom); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal redaction patterns: %w", err)
+		}
+	}
+	r, err := NewRedactor(custom)
+	if err != nil {
+		return nil, err
+	}
+	r.Catalogue = catalogue
+	return r, nil
+}
+
+var redactionKind = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// NewRedactor builds a Redactor with the built-in patterns, followed by custom ones keyed by the
+// name their tokens are given.
+func NewRedactor(custom map[string]string) (*Redactor, error) {
+	r := &Redactor{patterns: append([]redactionPattern(nil), piiPatterns...)}
+	kinds := make([]string, 0, len(custom))
+	for kind := range custom {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		if !redactionKind.MatchString(kind) {
+			return nil, fmt.Errorf("redaction pattern name %q must be upper case letters, digits and underscores", kind)
+		}
+		re, err := regexp.Compile(custom[kind])
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile redaction pattern %s: %w", kind, err)
+		}
+		r.patterns = append(r.patterns, redactionPattern{kind: kind, re: re})
+	}
+	return r, nil
+}
+
+// Redaction maps the tokens written into one email back to the values they replaced.
+type Redaction struct {
+	values map[string]string // Token to value
+	tokens map[string]string // Value to token, so a value repeated in the email gets one token
+	counts map[string]int    // Tokens given out so far by kind
+}
+
+func newRedaction() *Redaction {
+	return &Redaction{values: map[string]string{}, tokens: map[string]string{}, counts: map[string]int{}}
+}
+
+func (m *Redaction) token(kind, value string) string {
+	if token, ok := m.tokens[value]; ok {
+		return token
+	}
+	m.counts[kind]++
+	token := fmt.Sprintf("[%s_%d]", kind, m.counts[kind])
+	m.values[token], m.tokens[value] = value, token
+	return token
+}
+
+// Len is how many values were redacted.
+func (m *Redaction) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.values)
+}
+
+// Restore puts the redacted values back in place of their tokens, e.g. in the LLM's reply.
+func (m *Redaction) Restore(text string) string {
+	if m.Len() == 0 {
+		return text
+	}
+	return redactionToken.ReplaceAllStringFunc(text, func(token string) string {
+		if value, ok := m.values[token]; ok {
+			return value
+		}
+		return token
+	})
+}
+
+// Mask swaps values that were redacted for their tokens again, for logging restored text.
+func (m *Redaction) Mask(text string) string {
+	if m.Len() == 0 {
+		return text
+	}
+	values := make([]string, 0, len(m.tokens))
+	for value := range m.tokens {
+		values = append(values, value)
+	}
+	// Longest first, so a value isn't left half masked by one it contains.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, value := range values {
+		text = strings.ReplaceAll(text, value, m.tokens[value])
+	}
+	return text
+}
+
+// RestoreAnswer puts the redacted values back into everything the answer says.
+func (m *Redaction) RestoreAnswer(answer *Answer) {
+	if m.Len() == 0 || answer == nil {
+		return
+	}
+	answer.Text = m.Restore(answer.Text)
+	if pick := answer.Pick; pick != nil {
+		pick.SKU = m.Restore(pick.SKU)
+		pick.Rationale = m.Restore(pick.Rationale)
+		pick.ClarifyingQuestion = m.Restore(pick.ClarifyingQuestion)
+	}
+	if order := answer.Order; order != nil {
+		order.DeliveryAddress = m.Restore(order.DeliveryAddress)
+		for i := range order.Items {
+			order.Items[i].Product = m.Restore(order.Items[i].Product)
+			order.Items[i].SKU = m.Restore(order.Items[i].SKU)
+			order.Items[i].DeliveryAddress = m.Restore(order.Items[i].DeliveryAddress)
+		}
+	}
+}
+
+// RedactEmail returns a copy of msg with personal details masked in the headers, the body and
+// any text or CSV attachments, and the Redaction that undoes it. Other attachments are sent as
+// they are.
+func (r *Redactor) RedactEmail(msg *EmailContent) (*EmailContent, *Redaction) {
+	m := newRedaction()
+	redacted := *msg
+	redacted.PlainText = r.redact(msg.PlainText, m)
+	redacted.HTML = r.redact(msg.HTML, m)
+	redacted.To = r.redact(msg.To, m)
+	redacted.From = r.redact(msg.From, m)
+	redacted.Subject = r.redact(msg.Subject, m)
+	redacted.Attachments = make([]Attachment, len(msg.Attachments))
+	for i, attachment := range msg.Attachments {
+		contentType := strings.ToLower(attachment.ContentType)
+		if strings.HasPrefix(contentType, "text/plain") || strings.HasPrefix(contentType, "text/csv") || strings.EqualFold(filepath.Ext(attachment.Filename), ".csv") {
+			attachment.Data = []byte(r.redact(string(attachment.Data), m))
+			attachment.Size = len(attachment.Data)
+		}
+		redacted.Attachments[i] = attachment
+	}
+	return &redacted, m
+}
+
+// redact masks personal details in text, recording the tokens in m.
+func (r *Redactor) redact(text string, m *Redaction) string {
+	if text == "" {
+		return text
+	}
+	text = redactAddresses(text, m)
+	for _, pattern := range r.patterns {
+		text = outsideTokens(text, func(segment string) string {
+			return r.replace(segment, pattern, m)
+		})
+	}
+	return text
+}
+
+// replace masks what pattern finds in text, except where it overlaps a catalogue SKU or name.
+func (r *Redactor) replace(text string, pattern redactionPattern, m *Redaction) string {
+	protected := catalogueSpans(r.Catalogue, text)
+	group := pattern.re.SubexpIndex("value")
+	var b strings.Builder
+	last := 0
+	for _, loc := range pattern.re.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if group > 0 && loc[2*group] >= 0 {
+			start, end = loc[2*group], loc[2*group+1]
+		}
+		value := text[start:end]
+		if strings.TrimSpace(value) == "" || (pattern.valid != nil && !pattern.valid(value)) || overlaps(protected, start, end) {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(m.token(pattern.kind, value))
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// catalogueSpans finds where the SKUs, names and aliases of catalogue products appear in text.
+func catalogueSpans(catalogue *Catalogue, text string) [][]int {
+	if catalogue == nil {
+		return nil
+	}
+	// Offsets in the lowered text must hold for text, so if lowering changes its length only
+	// ASCII is lowered.
+	lower := strings.ToLower
+	if len(lower(text)) != len(text) {
+		lower = lowerASCII
+	}
+	lowered := lower(text)
+
+	var spans [][]int
+	for _, p := range catalogue.Mentions(text) {
+		for _, term := range append([]string{p.SKU, p.Name}, p.Aliases...) {
+			term = lower(term)
+			if term == "" {
+				continue
+			}
+			for from := 0; ; {
+				i := strings.Index(lowered[from:], term)
+				if i < 0 {
+					break
+				}
+				spans = append(spans, []int{from + i, from + i + len(term)})
+				from += i + len(term)
+			}
+		}
+	}
+	return spans
+}
+
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+func overlaps(spans [][]int, start, end int) bool {
+	for _, span := range spans {
+		if start < span[1] && span[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// outsideTokens applies replace to the parts of text between tokens already written.
+func outsideTokens(text string, replace func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range redactionToken.FindAllStringIndex(text, -1) {
+		b.WriteString(replace(text[last:loc[0]]))
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(replace(text[last:]))
+	return b.String()
+}
+
+// redactAddresses masks each line of every labelled address, as addressBlock reads them, since
+// free-form addresses have no pattern of their own.
+func redactAddresses(text string, m *Redaction) string {
+	lines := strings.Split(text, "\n")
+	for from := 0; ; {
+		start, end, _ := addressBlock(lines, from, piiAddressLabel)
+		if start < 0 {
+			break
+		}
+		for i := start; i < end; i++ {
+			value := lines[i]
+			if i == start {
+				value = piiAddressLabel.FindStringSubmatch(lines[i])[1]
+			}
+			if value = strings.TrimRight(strings.TrimSpace(value), ","); value != "" {
+				lines[i] = strings.Replace(lines[i], value, m.token("ADDRESS", value), 1)
+			}
+		}
+		from = end
+	}
+	return strings.Join(lines, "\n")
+}
+
+// phoneDigits accepts numbers with enough digits to be a phone number, which leaves dates,
+// quantities and order numbers alone.
+func phoneDigits(s string) bool {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n >= 9 && n <= 15
+}
+
+// validLuhn accepts card numbers whose check digit is right.
+func validLuhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// validIBAN accepts IBANs whose check digits are right under ISO 13616's mod 97 rule.
+func validIBAN(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	var digits strings.Builder
+	for _, r := range s[4:] + s[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			digits.WriteString(strconv.Itoa(int(r-'A') + 10))
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
@@ -0,0 +1,207 @@
+package inbound
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidLuhn(t *testing.T) {
+	tests := map[string]bool{
+		"4111 1111 1111 1111": true,
+		"4111-1111-1111-1111": true,
+		"5500000000000004":    true,
+		"378282246310005":     true, // 15 digit Amex
+		"4111 1111 1111 1112": false,
+		"1234 5678 9012 3456": false,
+		"0000 0000 0000":      false, // Passes the checksum but is too short for a card
+		"":                    false,
+	}
+	for in, want := range tests {
+		if got := validLuhn(in); got != want {
+			t.Errorf("validLuhn(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestValidIBAN(t *testing.T) {
+	tests := map[string]bool{
+		"GB82 WEST 1234 5698 7654 32": true,
+		"GB82WEST12345698765432":      true,
+		"DE89370400440532013000":      true,
+		"FR1420041010050500013M02606": true,
+		"GB82 WEST 1234 5698 7654 33": false,
+		"GB00 WEST 1234 5698 7654 32": false,
+		"GB82":                        false,
+		"gb82west12345698765432":      false,
+	}
+	for in, want := range tests {
+		if got := validIBAN(in); got != want {
+			t.Errorf("validIBAN(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	catalogue, err := NewCatalogue([]Product{
+		{SKU: "AB12 3CD", Name: "Tennis Court Net"},
+		{SKU: "0123456789012", Name: "Cone"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCatalogue, err := NewRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCatalogue.Catalogue = catalogue
+	custom, err := NewRedactor(map[string]string{"ACCOUNT": `ACC-\d{6}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		redactor *Redactor
+		in       string
+		want     string
+	}{
+		{"email", custom, "Reply to jo.bloggs+orders@example.co.uk please", "Reply to [EMAIL_1] please"},
+		{"repeated value gets one token", custom, "jo@example.com, again jo@example.com", "[EMAIL_1], again [EMAIL_1]"},
+		{"international phone", custom, "Call me on +44 7700 900123 today", "Call me on [PHONE_1] today"},
+		{"national phone", custom, "or 07700 900123, office (0113) 496 0000", "or [PHONE_1], office [PHONE_2]"},
+		{"labelled phone", custom, "Tel: 555 123 4567. Mobile no. 555-987-6543", "Tel: [PHONE_1]. Mobile no. [PHONE_2]"},
+		{"card passing Luhn", custom, "Card 4111 1111 1111 1111 thanks", "Card [CARD_1] thanks"},
+		{"card failing Luhn", custom, "Ref 4111 1111 1111 1112", "Ref 4111 1111 1111 1112"},
+		{"IBAN", custom, "IBAN GB82 WEST 1234 5698 7654 32.", "IBAN [IBAN_1]."},
+		{"custom pattern", custom, "Account ACC-123456", "Account [ACCOUNT_1]"},
+		{
+			"labelled addresses",
+			custom,
+			"Address: 221B Baker Street\nLondon NW1 6XE\n\nBilling address: 1 High St, York",
+			"Address: [ADDRESS_1]\n[ADDRESS_2]\n\nBilling address: [ADDRESS_3]",
+		},
+		{"unlabelled address is left", custom, "We're at 221B Baker Street, London NW1 6XE", "We're at 221B Baker Street, London NW1 6XE"},
+
+		// Product data that looks like personal details must reach the picker intact.
+		{"bare digit run", custom, "SKU 400638133393 x 10", "SKU 400638133393 x 10"},
+		{"postcode-like SKU", custom, "Need 12 of item AB12 3CD", "Need 12 of item AB12 3CD"},
+		{"street-like product", custom, "2 Car Park Signs and 4 Tennis Court Nets", "2 Car Park Signs and 4 Tennis Court Nets"},
+		{"dates and order numbers", custom, "Order 12345 on 2026-03-12, 01-03-2026, 12/03/2026", "Order 12345 on 2026-03-12, 01-03-2026, 12/03/2026"},
+		{"phone-like code", custom, "EAN 0123456789012 please", "EAN [PHONE_1] please"},
+		{"phone-like catalogue SKU", withCatalogue, "EAN 0123456789012 please", "EAN 0123456789012 please"},
+		{"catalogue SKU beside a phone", withCatalogue, "10 x 0123456789012, call 07700 900123", "10 x 0123456789012, call [PHONE_1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newRedaction()
+			got := tt.redactor.redact(tt.in, m)
+			if got != tt.want {
+				t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if restored := m.Restore(got); restored != tt.in {
+				t.Errorf("Restore(%q) = %q, want %q", got, restored, tt.in)
+			}
+		})
+	}
+}
+
+func TestCatalogueSpans(t *testing.T) {
+	catalogue, err := NewCatalogue([]Product{
+		{SKU: "TN-1", Name: "Tennis Court Net", Aliases: []string{"court net"}},
+		{SKU: "CN-2", Name: "Cone"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		text string
+		want [][]int
+	}{
+		{name: "none", text: "Hello there"},
+		{name: "any case, every time", text: "tn-1 and TENNIS COURT NET, tennis court net", want: [][]int{
+			{0, 4}, {9, 25}, {27, 43}, {16, 25}, {34, 43},
+		}},
+		{name: "text whose lower case is longer", text: "İzmir: 2 x Tennis Court Net", want: [][]int{{12, 28}, {19, 28}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := catalogueSpans(catalogue, tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("catalogueSpans(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+	if spans := catalogueSpans(nil, "Tennis Court Net"); spans != nil {
+		t.Errorf("catalogueSpans() without a catalogue = %v", spans)
+	}
+}
+
+func TestNewRedactorErrors(t *testing.T) {
+	for _, custom := range []map[string]string{
+		{"account": `\d+`},
+		{"ACCOUNT": `(`},
+	} {
+		if _, err := NewRedactor(custom); err == nil {
+			t.Errorf("NewRedactor(%v) succeeded, want an error", custom)
+		}
+	}
+}
+
+func TestRedactEmail(t *testing.T) {
+	r, err := NewRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &EmailContent{
+		From:      "Jo Bloggs <jo@example.com>",
+		Subject:   "Order",
+		PlainText: "5 x Blue Widget\nDelivery address: 1 High St\nYork\n\nCall 07700 900123",
+		Attachments: []Attachment{
+			{Filename: "order.csv", ContentType: "text/csv", Data: []byte("sku,qty,contact\nWID-100,5,jo@example.com\n")},
+			{Filename: "photo.png", ContentType: "image/png", Data: []byte("jo@example.com")},
+		},
+	}
+	sent, m := r.RedactEmail(msg)
+
+	if sent.From != "Jo Bloggs <[EMAIL_1]>" {
+		t.Errorf("From = %q", sent.From)
+	}
+	if want := "5 x Blue Widget\nDelivery address: [ADDRESS_1]\n[ADDRESS_2]\n\nCall [PHONE_1]"; sent.PlainText != want {
+		t.Errorf("PlainText = %q, want %q", sent.PlainText, want)
+	}
+	if got := string(sent.Attachments[0].Data); got != "sku,qty,contact\nWID-100,5,[EMAIL_1]\n" {
+		t.Errorf("CSV attachment = %q", got)
+	}
+	if got := string(sent.Attachments[1].Data); got != "jo@example.com" {
+		t.Errorf("image attachment = %q, want it untouched", got)
+	}
+	if msg.From != "Jo Bloggs <jo@example.com>" || string(msg.Attachments[0].Data) != "sku,qty,contact\nWID-100,5,jo@example.com\n" {
+		t.Errorf("RedactEmail changed the original email")
+	}
+
+	answer := &Answer{
+		Text: "Deliver to [ADDRESS_1], [ADDRESS_2]",
+		Pick: &ProductPick{SKU: "[PHONE_1]", Rationale: "asked by [EMAIL_1]"},
+		Order: &Order{
+			DeliveryAddress: "[ADDRESS_1]",
+			Items:           []LineItem{{Product: "Widget for [EMAIL_1]", SKU: "[PHONE_1]", DeliveryAddress: "[ADDRESS_2]"}},
+		},
+	}
+	m.RestoreAnswer(answer)
+	if answer.Text != "Deliver to 1 High St, York" || answer.Pick.SKU != "07700 900123" || answer.Pick.Rationale != "asked by jo@example.com" {
+		t.Errorf("restored answer = %q, pick %+v", answer.Text, *answer.Pick)
+	}
+	if item := answer.Order.Items[0]; answer.Order.DeliveryAddress != "1 High St" || item.SKU != "07700 900123" ||
+		item.Product != "Widget for jo@example.com" || item.DeliveryAddress != "York" {
+		t.Errorf("restored order = %+v", *answer.Order)
+	}
+
+	if got := m.Mask(answer.Text); got != "Deliver to [ADDRESS_1], [ADDRESS_2]" {
+		t.Errorf("Mask() = %q", got)
+	}
+	var none *Redaction
+	if got := none.Mask("jo@example.com"); got != "jo@example.com" {
+		t.Errorf("nil Mask() = %q", got)
+	}
+}
@@ -0,0 +1,136 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ResponsesClient calls the Responses API.
+type ResponsesClient struct {
+	openAIClient
+}
+
+type ResponseRequest struct {
+	Model        string              `json:"model"`
+	Instructions string              `json:"instructions,omitempty"`
+	Input        []ChatMessage       `json:"input"`
+	Text         *ResponseTextConfig `json:"text,omitempty"`
+	Temperature  *float64            `json:"temperature,omitempty"`
+	Store        *bool               `json:"store,omitempty"`
+}
+
+type ResponseTextConfig struct {
+	Format *ResponseTextFormat `json:"format"`
+}
+
+// ResponseTextFormat is the Responses API's flattened version of ResponseFormat.
+type ResponseTextFormat struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+type Response struct {
+	ID                string                `json:"id"`
+	Object            string                `json:"object"`
+	CreatedAt         int64                 `json:"created_at"`
+	Model             string                `json:"model"`
+	Status            string                `json:"status"`
+	Error             *RunLastError         `json:"error"`
+	IncompleteDetails *RunIncompleteDetails `json:"incomplete_details"`
+	Output            []ResponseOutputItem  `json:"output"`
+	Usage             *ResponseUsage        `json:"usage"`
+}
+
+type ResponseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type ResponseOutputItem struct {
+	Type    string `json:"type"` // "message", "reasoning", "function_call" ...
+	Role    string `json:"role"`
+	Content []struct {
+		Type string `json:"type"` // "output_text" or "refusal"
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+func NewResponsesClient(openAIKey string, options ...AssistantOption) *ResponsesClient {
+	return &ResponsesClient{openAIClient: newOpenAIClient("Responses", openAIKey, options)}
+}
+
+// textFormatFor converts a chat-style ResponseFormat for the Responses API.
+func textFormatFor(format *ResponseFormat) *ResponseTextConfig {
+	if format == nil {
+		return nil
+	}
+	textFormat := &ResponseTextFormat{Type: format.Type}
+	if schema := format.JSONSchema; schema != nil {
+		textFormat.Name = schema.Name
+		textFormat.Description = schema.Description
+		textFormat.Schema = schema.Schema
+		textFormat.Strict = schema.Strict
+	}
+	return &ResponseTextConfig{Format: textFormat}
+}
+
+// CreateResponse generates a response and returns it once finished. A response that failed or
+// ended incomplete is returned as a *RunError, alongside the response so its usage can still be
+// counted.
+func (c *ResponsesClient) CreateResponse(ctx context.Context, request *ResponseRequest) (*Response, error) {
+	jsonPayload, err := json.Marshal(request)
+	if err != nil {
+		c.logError(fmt.Sprintf("Failed to marshal response payload: %v", err))
+		return nil, fmt.Errorf("failed to marshal response payload: %w", err)
+	}
+
+	resp, err := c.send(ctx, "POST", c.endpoint("/responses"), jsonPayload, false)
+	if err != nil {
+		c.logError(fmt.Sprintf("Error sending request to create response: %v", err))
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(resp)
+		c.logError(fmt.Sprintf("Create response failed: %v", apiErr))
+		return nil, fmt.Errorf("create response failed: %w", apiErr)
+	}
+
+	var response Response
+	if err := json.Unmarshal(resp.Body, &response); err != nil {
+		c.logError(fmt.Sprintf("Failed to unmarshal response: %v, body: %s", err, string(resp.Body)))
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if response.Status != "" && response.Status != RunStatusCompleted {
+		return &response, &RunError{
+			RunID:             response.ID,
+			Status:            response.Status,
+			LastError:         response.Error,
+			IncompleteDetails: response.IncompleteDetails,
+		}
+	}
+	return &response, nil
+}
+
+// OutputText joins the text of every assistant message in the response.
+func (r *Response) OutputText() string {
+	var parts []string
+	for _, item := range r.Output {
+		if item.Type != "message" {
+			continue
+		}
+		for _, content := range item.Content {
+			if content.Type == "output_text" {
+				parts = append(parts, content.Text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,208 @@
+package inbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	RouteActionAssistant string = "assistant" // Hand the email to an assistant (default)
+	RouteActionDrop      string = "drop"      // Discard the email without calling an assistant
+)
+
+// RouteMatch holds the conditions for a route. Every non-empty field must match.
+type RouteMatch struct {
+	Recipient    string `json:"recipient"`     // e.g. sales@example.com, compared without any +tag
+	PlusTag      string `json:"plus_tag"`      // e.g. "urgent" for orders+urgent@example.com
+	SenderDomain string `json:"sender_domain"` // e.g. example.com
+	SubjectRegex string `json:"subject_regex"`
+
+	subjectRe *regexp.Regexp
+}
+
+type Route struct {
+	Name             string     `json:"name"`
+	Match            RouteMatch `json:"match"`
+	Action           string     `json:"action"`
+	Backend          string     `json:"backend"` // Overrides LLM_BACKEND for this route
+	AssistantID      string     `json:"assistant_id"`
+	Model            string     `json:"model"` // Overrides the assistant's model, or the backend's default
+	Instructions     string     `json:"instructions"`
+	StructuredOutput bool       `json:"structured_output"` // Ask for a JSON ProductPick instead of prose
+	ExtractOrder     bool       `json:"extract_order"`     // Read every line item into an Order instead
+	Sinks            []string   `json:"sinks"`
+
+	// Added to the instructions on every run, e.g. "These customers are trade accounts in the EU".
+	AdditionalInstructions string   `json:"additional_instructions"`
+	Temperature            *float64 `json:"temperature"`
+}
+
+type RoutingTable struct {
+	Routes  []Route `json:"routes"`
+	Default Route   `json:"default"`
+}
+
+// LoadRoutingTable reads the routing table from ROUTING_TABLE (inline JSON) or ROUTING_TABLE_FILE.
+// Without either, every email goes to the assistant in ASSISTANT_PRODUCT_PICKER.
+func LoadRoutingTable() (*RoutingTable, error) {
+	raw := []byte(os.Getenv("ROUTING_TABLE"))
+	if len(raw) == 0 {
+		if path := os.Getenv("ROUTING_TABLE_FILE"); path != "" {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read routing table file %s: %w", path, err)
+			}
+			raw = b
+		}
+	}
+
+	table := &RoutingTable{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, table); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal routing table: %w", err)
+		}
+	}
+
+	if table.Default.Name == "" {
+		table.Default.Name = "default"
+	}
+	if table.Default.AssistantID == "" {
+		table.Default.AssistantID = os.Getenv("ASSISTANT_PRODUCT_PICKER")
+	}
+
+	if err := table.compile(); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// compile validates the table and prepares the subject regexes.
+func (t *RoutingTable) compile() error {
+	routes := []*Route{&t.Default}
+	for i := range t.Routes {
+		routes = append(routes, &t.Routes[i])
+	}
+
+	for i, route := range routes {
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("route-%d", i)
+		}
+		switch route.Action {
+		case "":
+			route.Action = RouteActionAssistant
+		case RouteActionAssistant, RouteActionDrop:
+		default:
+			return fmt.Errorf("route %s has unknown action %q", route.Name, route.Action)
+		}
+		if route.StructuredOutput && route.ExtractOrder {
+			return fmt.Errorf("route %s sets both structured_output and extract_order", route.Name)
+		}
+		if route.Backend != "" && !knownBackend(route.Backend) {
+			return fmt.Errorf("route %s has unknown backend %q", route.Name, route.Backend)
+		}
+		if len(route.Sinks) == 0 {
+			route.Sinks = []string{"log"}
+		}
+		for _, name := range route.Sinks {
+			if _, ok := sinks[name]; !ok {
+				return fmt.Errorf("route %s references unknown sink %q", route.Name, name)
+			}
+		}
+		if route.Match.SubjectRegex != "" {
+			re, err := regexp.Compile(route.Match.SubjectRegex)
+			if err != nil {
+				return fmt.Errorf("route %s has invalid subject_regex: %w", route.Name, err)
+			}
+			route.Match.subjectRe = re
+		}
+	}
+	return nil
+}
+
+// Resolve returns the first route matching the email, or the default route.
+// recipients are the SES envelope recipients; the To header is also considered.
+func (t *RoutingTable) Resolve(msg *EmailContent, recipients []string) *Route {
+	addresses := append([]string{}, recipients...)
+	addresses = append(addresses, parseAddressList(msg.To)...)
+
+	for i := range t.Routes {
+		if t.Routes[i].Match.matches(msg, addresses) {
+			return &t.Routes[i]
+		}
+	}
+	return &t.Default
+}
+
+func (m *RouteMatch) matches(msg *EmailContent, addresses []string) bool {
+	if m.Recipient != "" || m.PlusTag != "" {
+		found := false
+		for _, address := range addresses {
+			base, tag := splitPlusAddress(address)
+			if m.Recipient != "" && !strings.EqualFold(base, m.Recipient) {
+				continue
+			}
+			if m.PlusTag != "" && !strings.EqualFold(tag, m.PlusTag) {
+				continue
+			}
+			found = true
+			break
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if m.SenderDomain != "" {
+		senders := parseAddressList(msg.From)
+		if len(senders) == 0 || !strings.EqualFold(addressDomain(senders[0]), m.SenderDomain) {
+			return false
+		}
+	}
+
+	if m.subjectRe != nil && !m.subjectRe.MatchString(msg.Subject) {
+		return false
+	}
+
+	return true
+}
+
+// parseAddressList returns the bare addresses from a header value, falling back to the raw value.
+func parseAddressList(header string) []string {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+	list, err := mail.ParseAddressList(header)
+	if err != nil {
+		return []string{strings.TrimSpace(header)}
+	}
+	addresses := make([]string, 0, len(list))
+	for _, addr := range list {
+		addresses = append(addresses, addr.Address)
+	}
+	return addresses
+}
+
+// splitPlusAddress turns orders+urgent@example.com into orders@example.com and "urgent".
+func splitPlusAddress(address string) (string, string) {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return address, ""
+	}
+	local, domain := address[:at], address[at:]
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		return local[:plus] + domain, local[plus+1:]
+	}
+	return address, ""
+}
+
+func addressDomain(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	return address[at+1:]
+}
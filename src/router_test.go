@@ -0,0 +1,151 @@
+package inbound
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRoutingTable = `{
+	"routes": [
+		{"name": "urgent", "match": {"recipient": "orders@example.com", "plus_tag": "urgent"}, "assistant_id": "asst_urgent"},
+		{"name": "orders", "match": {"recipient": "orders@example.com"}, "assistant_id": "asst_orders", "extract_order": true},
+		{"name": "trade", "match": {"sender_domain": "trade.example.net", "subject_regex": "(?i)^quote"}, "assistant_id": "asst_trade"},
+		{"name": "spam", "match": {"subject_regex": "(?i)unsubscribe"}, "action": "drop"},
+		{"match": {"plus_tag": "test"}, "backend": "local"}
+	],
+	"default": {"assistant_id": "asst_default"}
+}`
+
+func TestRoutingTableResolve(t *testing.T) {
+	t.Setenv("ROUTING_TABLE", testRoutingTable)
+	table, err := LoadRoutingTable()
+	if err != nil {
+		t.Fatalf("LoadRoutingTable() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		msg        EmailContent
+		recipients []string
+		want       string
+	}{
+		{"plus tag beats the plain recipient listed after it", EmailContent{}, []string{"orders+urgent@example.com"}, "urgent"},
+		{"recipient compared without its tag", EmailContent{}, []string{"Orders+other@Example.com"}, "orders"},
+		{"recipient from the To header", EmailContent{To: "Sales <sales@example.com>, orders@example.com"}, nil, "orders"},
+		{"earlier route wins over a later match", EmailContent{Subject: "Unsubscribe me"}, []string{"orders@example.com"}, "orders"},
+		{"sender domain and subject both match", EmailContent{From: "Jo <jo@Trade.Example.net>", Subject: "Quote please"}, nil, "trade"},
+		{"sender domain without the subject", EmailContent{From: "jo@trade.example.net", Subject: "Order"}, nil, "default"},
+		{"subject only", EmailContent{Subject: "please UNSUBSCRIBE"}, []string{"info@example.com"}, "spam"},
+		{"unnamed route", EmailContent{}, []string{"info+test@example.com"}, "route-5"},
+		{"nothing matches", EmailContent{From: "jo@example.org", Subject: "Hello"}, []string{"info@example.com"}, "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table.Resolve(&tt.msg, tt.recipients); got.Name != tt.want {
+				t.Errorf("Resolve() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+
+	spam := table.Resolve(&EmailContent{Subject: "unsubscribe"}, nil)
+	if spam.Action != RouteActionDrop {
+		t.Errorf("spam action = %q, want %q", spam.Action, RouteActionDrop)
+	}
+	if table.Default.Action != RouteActionAssistant || strings.Join(table.Default.Sinks, ",") != "log" {
+		t.Errorf("default route = %+v, want the assistant action and the log sink", table.Default)
+	}
+}
+
+func TestLoadRoutingTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.json")
+	if err := os.WriteFile(path, []byte(`{"default": {"name": "catch-all", "backend": "chat"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantName  string
+		assistant string
+		wantErr   string
+	}{
+		{
+			name:      "no table sends everything to ASSISTANT_PRODUCT_PICKER",
+			env:       map[string]string{"ASSISTANT_PRODUCT_PICKER": "asst_env"},
+			wantName:  "default",
+			assistant: "asst_env",
+		},
+		{
+			name:      "table file",
+			env:       map[string]string{"ROUTING_TABLE_FILE": path, "ASSISTANT_PRODUCT_PICKER": "asst_env"},
+			wantName:  "catch-all",
+			assistant: "asst_env",
+		},
+		{
+			name:      "inline table is preferred to the file",
+			env:       map[string]string{"ROUTING_TABLE": `{"default": {"assistant_id": "asst_inline"}}`, "ROUTING_TABLE_FILE": path},
+			wantName:  "default",
+			assistant: "asst_inline",
+		},
+		{name: "missing file", env: map[string]string{"ROUTING_TABLE_FILE": path + ".missing"}, wantErr: "failed to read routing table file"},
+		{name: "invalid JSON", env: map[string]string{"ROUTING_TABLE": `{`}, wantErr: "failed to unmarshal routing table"},
+		{name: "unknown action", env: map[string]string{"ROUTING_TABLE": `{"routes": [{"name": "x", "action": "forward"}]}`}, wantErr: `route x has unknown action "forward"`},
+		{name: "unknown backend", env: map[string]string{"ROUTING_TABLE": `{"routes": [{"name": "x", "backend": "bard"}]}`}, wantErr: `route x has unknown backend "bard"`},
+		{name: "unknown sink", env: map[string]string{"ROUTING_TABLE": `{"routes": [{"name": "x", "sinks": ["slack"]}]}`}, wantErr: `route x references unknown sink "slack"`},
+		{name: "invalid subject regex", env: map[string]string{"ROUTING_TABLE": `{"routes": [{"name": "x", "match": {"subject_regex": "("}}]}`}, wantErr: "route x has invalid subject_regex"},
+		{
+			name:    "structured output and order extraction together",
+			env:     map[string]string{"ROUTING_TABLE": `{"default": {"structured_output": true, "extract_order": true}}`},
+			wantErr: "route default sets both structured_output and extract_order",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"ROUTING_TABLE", "ROUTING_TABLE_FILE", "ASSISTANT_PRODUCT_PICKER"} {
+				t.Setenv(name, tt.env[name])
+			}
+			table, err := LoadRoutingTable()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadRoutingTable() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadRoutingTable() error = %v", err)
+			}
+			if table.Default.Name != tt.wantName || table.Default.AssistantID != tt.assistant {
+				t.Errorf("default route = %s with assistant %q, want %s with %q", table.Default.Name, table.Default.AssistantID, tt.wantName, tt.assistant)
+			}
+		})
+	}
+}
+
+func TestSplitPlusAddress(t *testing.T) {
+	tests := []struct {
+		address, base, tag string
+	}{
+		{"orders+urgent@example.com", "orders@example.com", "urgent"},
+		{"orders+a+b@example.com", "orders@example.com", "a+b"},
+		{"orders@example.com", "orders@example.com", ""},
+		{"not-an-address", "not-an-address", ""},
+	}
+	for _, tt := range tests {
+		if base, tag := splitPlusAddress(tt.address); base != tt.base || tag != tt.tag {
+			t.Errorf("splitPlusAddress(%q) = %q, %q; want %q, %q", tt.address, base, tag, tt.base, tt.tag)
+		}
+	}
+}
+
+func TestAssistantsPickerNeedsAnAssistant(t *testing.T) {
+	picker := &assistantsPicker{}
+	_, err := picker.Pick(context.Background(), &Route{Name: "orders"}, "m1", &EmailContent{})
+	if err == nil || err.Error() != "route orders has no assistant_id and ASSISTANT_PRODUCT_PICKER is unset" {
+		t.Errorf("Pick() error = %v, want it to name the route", err)
+	}
+}
@@ -0,0 +1,289 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fallback picks are never confident enough to act on without review.
+const maxFallbackConfidence = 0.5
+
+// rulePicker guesses the product from the catalogue's words alone, for when the LLM can't be
+// reached. Its answers are marked Fallback so the email can be put through the LLM again later.
+type rulePicker struct {
+	synonyms []synonym
+	products []ruleProduct
+	idf      map[string]float64 // Rarity of each stemmed catalogue word
+}
+
+// synonym is a stemmed phrase customers use and the stemmed catalogue phrase it stands for.
+type synonym struct {
+	from, to string
+}
+
+// ruleProduct is a product's words, tokenised and stemmed the way emails are.
+type ruleProduct struct {
+	product    *Product
+	sku        string
+	phrases    [][]string // Name and aliases
+	words      map[string]bool
+	attributes map[string]bool
+}
+
+// RulePickerFromEnv builds a rule-based picker over catalogue, with word synonyms from
+// FALLBACK_SYNONYMS (inline JSON) or FALLBACK_SYNONYMS_FILE, e.g. {"tee": ["t-shirt", "tshirt"]}
+// mapping a catalogue word to what customers call it. It returns nil if there is no catalogue.
+func RulePickerFromEnv(catalogue *Catalogue) (ProductPicker, error) {
+	if catalogue == nil {
+		return nil, nil
+	}
+
+	raw := []byte(os.Getenv("FALLBACK_SYNONYMS"))
+	if len(raw) == 0 {
+		if path := os.Getenv("FALLBACK_SYNONYMS_FILE"); path != "" {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read fallback synonyms file %s: %w", path, err)
+			}
+			raw = b
+		}
+	}
+	var synonyms map[string][]string
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &synonyms); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal fallback synonyms: %w", err)
+		}
+	}
+	return newRulePicker(catalogue, synonyms), nil
+}
+
+func newRulePicker(catalogue *Catalogue, synonyms map[string][]string) *rulePicker {
+	p := &rulePicker{idf: map[string]float64{}}
+	for word, alternatives := range synonyms {
+		canonical := strings.Join(tokenise(word), " ")
+		for _, alternative := range alternatives {
+			if from := strings.Join(tokenise(alternative), " "); from != "" && from != canonical {
+				p.synonyms = append(p.synonyms, synonym{from: from, to: canonical})
+			}
+		}
+	}
+	// Longest first, so "t shirt" is replaced before "shirt" is.
+	sort.Slice(p.synonyms, func(i, j int) bool {
+		if len(p.synonyms[i].from) != len(p.synonyms[j].from) {
+			return len(p.synonyms[i].from) > len(p.synonyms[j].from)
+		}
+		return p.synonyms[i].from < p.synonyms[j].from
+	})
+
+	documents := map[string]int{}
+	for i := range catalogue.Products {
+		product := &catalogue.Products[i]
+		rp := ruleProduct{product: product, sku: skuKey(product.SKU), words: map[string]bool{}, attributes: map[string]bool{}}
+		for _, name := range append([]string{product.Name}, product.Aliases...) {
+			if phrase := tokenise(name); len(phrase) > 0 {
+				rp.phrases = append(rp.phrases, phrase)
+				for _, word := range phrase {
+					rp.words[word] = true
+				}
+			}
+		}
+		for _, value := range product.Attributes {
+			for _, word := range tokenise(value) {
+				rp.attributes[word] = true
+			}
+		}
+		for word := range rp.words {
+			documents[word]++
+		}
+		p.products = append(p.products, rp)
+	}
+	for word, n := range documents {
+		p.idf[word] = math.Log(1 + float64(len(p.products))/float64(n))
+	}
+	return p
+}
+
+type ruleScore struct {
+	product *ruleProduct
+	score   float64
+	reasons []string
+}
+
+func (p *rulePicker) Pick(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+	text := msg.Subject + "\n" + msg.PlainText
+	words := p.emailWords(text)
+	present := map[string]bool{}
+	for _, word := range words {
+		present[word] = true
+	}
+	joined := " " + strings.Join(words, " ") + " "
+	skus := skuCandidates(text)
+
+	var scores []ruleScore
+	for i := range p.products {
+		rp := &p.products[i]
+		s := ruleScore{product: rp}
+		if skus[rp.sku] {
+			s.score += 10
+			s.reasons = append(s.reasons, "sku "+rp.product.SKU)
+		} else {
+			for candidate := range skus {
+				if len(candidate) >= 4 && levenshteinRatio(candidate, rp.sku) >= 0.8 {
+					s.score += 5
+					s.reasons = append(s.reasons, fmt.Sprintf("sku %s near %s", rp.product.SKU, candidate))
+					break
+				}
+			}
+		}
+		for _, phrase := range rp.phrases {
+			if len(phrase) > 1 && strings.Contains(joined, " "+strings.Join(phrase, " ")+" ") {
+				s.score += 5
+				s.reasons = append(s.reasons, fmt.Sprintf("phrase %q", strings.Join(phrase, " ")))
+				break
+			}
+		}
+		var matched []string
+		for word := range rp.words {
+			if present[word] {
+				s.score += p.idf[word]
+				matched = append(matched, word)
+			}
+		}
+		for word := range rp.attributes {
+			if present[word] && !rp.words[word] {
+				s.score += 0.3
+			}
+		}
+		if len(matched) > 0 {
+			sort.Strings(matched)
+			s.reasons = append(s.reasons, "words "+strings.Join(matched, ", "))
+		}
+		if s.score > 0 {
+			scores = append(scores, s)
+		}
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+
+	pick := &ProductPick{Quantity: 1}
+	if len(scores) == 0 || scores[0].score < 1 {
+		pick.Rationale = "Fallback: no catalogue product matched the email"
+		pick.ClarifyingQuestion = "Which product do you need, and how many?"
+		return &Answer{Text: pick.ClarifyingQuestion, Pick: structuredOnly(route, pick), Order: fallbackOrder(route, msg, nil, ""), Fallback: true}, nil
+	}
+
+	best := scores[0]
+	runnerUp := 0.0
+	if len(scores) > 1 {
+		runnerUp = scores[1].score
+	}
+	pick.SKU = best.product.product.SKU
+	pick.Quantity = orderQuantity(text)
+	pick.Confidence = maxFallbackConfidence * best.score / (best.score + runnerUp + 1)
+	pick.Rationale = "Fallback match on " + strings.Join(best.reasons, "; ")
+
+	reply := fmt.Sprintf("%s x%d (%s)", pick.SKU, pick.Quantity, best.product.product.Name)
+	return &Answer{Text: reply, Pick: structuredOnly(route, pick), Order: fallbackOrder(route, msg, pick, best.product.product.Name), Fallback: true}, nil
+}
+
+// structuredOnly keeps pick for routes that asked for structured output.
+func structuredOnly(route *Route, pick *ProductPick) *ProductPick {
+	if !route.StructuredOutput {
+		return nil
+	}
+	return pick
+}
+
+// fallbackOrder turns the pick into a one item order for routes that extract orders. Emails
+// that ask for several products need the LLM, or an order form ExtractOrder can read.
+func fallbackOrder(route *Route, msg *EmailContent, pick *ProductPick, name string) *Order {
+	if !route.ExtractOrder {
+		return nil
+	}
+	order := ExtractOrder(msg)
+	if pick != nil && len(order.Items) == 0 {
+		order.Items = []LineItem{{Product: name, SKU: pick.SKU, Quantity: float64(pick.Quantity), Source: "fallback"}}
+	}
+	order.fillDefaults()
+	return order
+}
+
+// emailWords tokenises and stems text, replacing synonyms with the catalogue word they mean.
+func (p *rulePicker) emailWords(text string) []string {
+	words := tokenise(text)
+	if len(p.synonyms) == 0 {
+		return words
+	}
+	joined := " " + strings.Join(words, " ") + " "
+	for _, s := range p.synonyms {
+		joined = strings.ReplaceAll(joined, " "+s.from+" ", " "+s.to+" ")
+	}
+	return strings.Fields(joined)
+}
+
+// tokenise splits text into lowercase, stemmed words.
+func tokenise(text string) []string {
+	words := strings.Fields(normaliseText(text))
+	for i, word := range words {
+		words[i] = stem(word)
+	}
+	return words
+}
+
+// stem strips common English endings so "boxes", "boxed" and "box" compare equal. It is
+// deliberately light: overstemming product words does more harm than missing a match.
+func stem(word string) string {
+	if len(word) <= 3 || strings.IndexFunc(word, func(r rune) bool { return r >= '0' && r <= '9' }) >= 0 {
+		return word
+	}
+	for _, rule := range []struct{ suffix, replacement string }{
+		{"ies", "y"}, {"sses", "ss"}, {"xes", "x"}, {"ches", "ch"}, {"shes", "sh"},
+		{"ing", ""}, {"ed", ""}, {"s", ""},
+	} {
+		if strings.HasSuffix(word, rule.suffix) && !strings.HasSuffix(word, "ss") {
+			stemmed := strings.TrimSuffix(word, rule.suffix) + rule.replacement
+			if len(stemmed) >= 3 {
+				return stemmed
+			}
+		}
+	}
+	return word
+}
+
+// skuPattern finds words that look like SKUs: letters and digits, maybe split by - or _.
+var skuPattern = regexp.MustCompile(`\b[A-Za-z0-9]*\d[A-Za-z0-9]*(?:[-_./][A-Za-z0-9]+)*\b|\b[A-Za-z]+(?:[-_./][A-Za-z0-9]+)+\b`)
+
+// skuCandidates returns the SKU keys of everything in text that could be a SKU.
+func skuCandidates(text string) map[string]bool {
+	candidates := map[string]bool{}
+	for _, match := range skuPattern.FindAllString(text, -1) {
+		if key := skuKey(match); key != "" {
+			candidates[key] = true
+		}
+	}
+	return candidates
+}
+
+var quantityPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(?:qty|quantity)\s*[:=]?\s*(\d{1,5})\b`),
+	regexp.MustCompile(`(?i)\b(\d{1,5})\s*(?:x|pcs|pieces|units|boxes|packs|of)\b`),
+	regexp.MustCompile(`(?i)\bx\s*(\d{1,5})\b`),
+}
+
+// orderQuantity finds how many the email asks for, defaulting to 1.
+func orderQuantity(text string) int {
+	for _, pattern := range quantityPatterns {
+		if m := pattern.FindStringSubmatch(text); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 1
+}
@@ -0,0 +1,144 @@
+package inbound
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	for word, want := range map[string]string{
+		"boxes": "box", "boxed": "box", "box": "box", "batteries": "battery", "glasses": "glass",
+		"brushes": "brush", "fitting": "fitt", "widgets": "widget", "gas": "gas", "bw100s": "bw100s", "class": "class",
+	} {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestSkuCandidates(t *testing.T) {
+	got := skuCandidates("Please send BW-100, 2 x gs_200 and the X/40 bracket by Friday.")
+	want := map[string]bool{"bw100": true, "2": true, "gs200": true, "x40": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("skuCandidates() = %v, want %v", got, want)
+	}
+}
+
+func TestOrderQuantity(t *testing.T) {
+	tests := map[string]int{
+		"Qty: 12 of the blue ones": 12,
+		"we need 3 boxes":          3,
+		"blue widget x 7":          7,
+		"10 pcs please":            10,
+		"a blue widget":            1,
+		"quantity 0":               1,
+	}
+	for text, want := range tests {
+		if got := orderQuantity(text); got != want {
+			t.Errorf("orderQuantity(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestRulePickerPick(t *testing.T) {
+	catalogue, err := NewCatalogue([]Product{
+		{SKU: "BW-100", Name: "Blue Widget", Aliases: []string{"azure widget"}},
+		{SKU: "RW-100", Name: "Red Widget"},
+		{SKU: "GS-200", Name: "Green Sprocket", Attributes: map[string]string{"material": "steel"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	picker := newRulePicker(catalogue, map[string][]string{"sprocket": {"cog", "gear wheel"}})
+	structured := &Route{Name: "orders", StructuredOutput: true}
+
+	tests := []struct {
+		name       string
+		route      *Route
+		email      string
+		wantSKU    string // Empty for a clarifying question
+		wantQty    int
+		wantReason string
+	}{
+		{name: "exact sku", route: structured, email: "Please send 4 x RW-100", wantSKU: "RW-100", wantQty: 4, wantReason: "sku RW-100"},
+		{name: "sku one character off", route: structured, email: "Need BW-10O urgently", wantSKU: "BW-100", wantQty: 1, wantReason: "sku BW-100 near bw10o"},
+		{name: "name phrase", route: structured, email: "Could we get 6 blue widgets?", wantSKU: "BW-100", wantQty: 1, wantReason: `phrase "blue widget"`},
+		{name: "alias phrase", route: structured, email: "qty 2 azure widgets", wantSKU: "BW-100", wantQty: 2, wantReason: `phrase "azure widget"`},
+		{name: "synonym", route: structured, email: "3 boxes of green cogs", wantSKU: "GS-200", wantQty: 3, wantReason: `phrase "green sprocket"`},
+		{name: "multi-word synonym", route: structured, email: "a steel gear wheel", wantSKU: "GS-200", wantQty: 1, wantReason: "words sprocket"},
+		{name: "nothing matches", route: structured, email: "When do you open on Monday?"},
+		{name: "prose route", route: &Route{Name: "default"}, email: "Please send 4 x RW-100", wantSKU: "RW-100", wantQty: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, err := picker.Pick(context.Background(), tt.route, "ses-1", &EmailContent{Subject: "Order", PlainText: tt.email})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !answer.Fallback {
+				t.Error("answer isn't marked as a fallback")
+			}
+			if !tt.route.StructuredOutput {
+				if answer.Pick != nil || !strings.HasPrefix(answer.Text, tt.wantSKU+" x") {
+					t.Errorf("Pick() = %+v, want only a prose reply naming %s", answer, tt.wantSKU)
+				}
+				return
+			}
+
+			pick := answer.Pick
+			if tt.wantSKU == "" {
+				if pick.SKU != "" || pick.ClarifyingQuestion == "" || answer.Text != pick.ClarifyingQuestion {
+					t.Errorf("Pick() = %+v, want a clarifying question", pick)
+				}
+				return
+			}
+			if pick.SKU != tt.wantSKU || pick.Quantity != tt.wantQty {
+				t.Errorf("Pick() = %s x%d, want %s x%d (%s)", pick.SKU, pick.Quantity, tt.wantSKU, tt.wantQty, pick.Rationale)
+			}
+			if pick.Confidence <= 0 || pick.Confidence > maxFallbackConfidence {
+				t.Errorf("confidence = %v, want above 0 and at most %v", pick.Confidence, maxFallbackConfidence)
+			}
+			if !strings.Contains(pick.Rationale, tt.wantReason) {
+				t.Errorf("rationale = %q, want %q", pick.Rationale, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRulePickerOrder(t *testing.T) {
+	catalogue, err := NewCatalogue([]Product{{SKU: "BW-100", Name: "Blue Widget"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := newRulePicker(catalogue, nil).Pick(context.Background(), &Route{Name: "orders", ExtractOrder: true}, "ses-1", &EmailContent{PlainText: "Do you have the blue widget? We would want 5 pcs."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LineItem{{Product: "Blue Widget", SKU: "BW-100", Quantity: 5, Source: "fallback"}}
+	if answer.Pick != nil || answer.Order == nil || !reflect.DeepEqual(answer.Order.Items, want) {
+		t.Errorf("Pick() order = %+v, want a one item order", answer.Order)
+	}
+}
+
+func TestRulePickerFromEnv(t *testing.T) {
+	t.Setenv("FALLBACK_SYNONYMS_FILE", "")
+	t.Setenv("FALLBACK_SYNONYMS", `{"tee": ["t-shirt"]}`)
+	if picker, err := RulePickerFromEnv(nil); picker != nil || err != nil {
+		t.Errorf("RulePickerFromEnv(nil) = %v, %v; want nothing", picker, err)
+	}
+	catalogue, _ := NewCatalogue([]Product{{SKU: "T-1", Name: "Plain Tee"}})
+	picker, err := RulePickerFromEnv(catalogue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synonyms := picker.(*rulePicker).synonyms; !reflect.DeepEqual(synonyms, []synonym{{from: "t shirt", to: "tee"}}) {
+		t.Errorf("synonyms = %+v", synonyms)
+	}
+
+	t.Setenv("FALLBACK_SYNONYMS", `["tee"]`)
+	if _, err := RulePickerFromEnv(catalogue); err == nil {
+		t.Error("RulePickerFromEnv() with bad synonyms succeeded")
+	}
+}
@@ -0,0 +1,57 @@
+package inbound
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// RoutedReply is what a route's sinks receive once an email has been handled.
+type RoutedReply struct {
+	Route     string
+	MessageID string
+	Email     *EmailContent
+	Reply     string
+	Pick      *ProductPick    // Set for routes with structured_output
+	Order     *Order          // Set for routes with extract_order
+	Validated *PickValidation // Set when the pipeline has a catalogue to check picks against
+	Fallback  bool            // The LLM failed and the reply is the rule-based picker's guess
+	Redaction *Redaction      // Set when personal details were masked; Mask them again before logging
+}
+
+type Sink interface {
+	Deliver(ctx context.Context, reply *RoutedReply) error
+}
+
+// sinks holds the sinks that routes can reference by name.
+var sinks = map[string]Sink{
+	"log": logSink{},
+}
+
+type logSink struct{}
+
+func (logSink) Deliver(ctx context.Context, reply *RoutedReply) error {
+	mask := reply.Redaction.Mask
+	if reply.Fallback {
+		log.Printf("[%s] Reply is a fallback guess; put email %s through the assistant again when it is back\n", reply.Route, reply.MessageID)
+	}
+	if v := reply.Validated; v != nil && v.Status != PickAccepted {
+		log.Printf("[%s] Pick %s: %s\n", reply.Route, v.Status, mask(strings.Join(v.Reasons, "; ")))
+	}
+	if order := reply.Order; order != nil {
+		log.Printf("[%s] Customer ordered %d items:\n%s\n", reply.Route, len(order.Items), mask(order.Summary()))
+		if order.DeliveryAddress != "" {
+			log.Printf("[%s] Deliver to: %s\n", reply.Route, mask(order.DeliveryAddress))
+		}
+		return nil
+	}
+	if pick := reply.Pick; pick != nil {
+		log.Printf("[%s] Assistant picked SKU %q x%d (confidence %.2f): %s\n", reply.Route, pick.SKU, pick.Quantity, pick.Confidence, mask(pick.Rationale))
+		if pick.ClarifyingQuestion != "" {
+			log.Printf("[%s] Assistant wants to ask: %s\n", reply.Route, mask(pick.ClarifyingQuestion))
+		}
+		return nil
+	}
+	log.Printf("[%s] Assistant reckons the product required is: %s\n", reply.Route, mask(reply.Reply))
+	return nil
+}
@@ -0,0 +1,161 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// SQSBatchHandler processes SQS batches message by message and reports only the failures,
+// so SQS redelivers just those. The event source mapping must have ReportBatchItemFailures enabled.
+type SQSBatchHandler struct {
+	Pipeline *Pipeline
+	Workers  int // Messages processed concurrently, at least 1
+
+	// DeadLetterQueueURL, when set, receives messages that fail permanently or have been received
+	// MaxReceives times; they are then acknowledged instead of retried. Without it, SQS's own
+	// redrive policy decides when a message is dead-lettered.
+	DeadLetterQueueURL string
+	MaxReceives        int // 0 leaves retries to the queue's redrive policy
+
+	// sendToDeadLetter forwards a failed message; defaults to sqs.SendMessage.
+	sendToDeadLetter func(ctx context.Context, message events.SQSMessage, cause error) error
+}
+
+// NewSQSBatchHandler configures a handler from SQS_WORKERS, SQS_DEAD_LETTER_QUEUE_URL and SQS_MAX_RECEIVES.
+func NewSQSBatchHandler(pipeline *Pipeline, client *sqs.SQS) (*SQSBatchHandler, error) {
+	h := &SQSBatchHandler{
+		Pipeline:           pipeline,
+		Workers:            4,
+		DeadLetterQueueURL: os.Getenv("SQS_DEAD_LETTER_QUEUE_URL"),
+	}
+
+	if v := os.Getenv("SQS_WORKERS"); v != "" {
+		workers, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SQS_WORKERS %q: %w", v, err)
+		}
+		h.Workers = workers
+	}
+	if v := os.Getenv("SQS_MAX_RECEIVES"); v != "" {
+		maxReceives, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SQS_MAX_RECEIVES %q: %w", v, err)
+		}
+		h.MaxReceives = maxReceives
+	}
+
+	if client != nil {
+		h.sendToDeadLetter = func(ctx context.Context, message events.SQSMessage, cause error) error {
+			_, err := client.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+				QueueUrl:    aws.String(h.DeadLetterQueueURL),
+				MessageBody: aws.String(message.Body),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"FailureReason": {
+						DataType:    aws.String("String"),
+						StringValue: aws.String(cause.Error()),
+					},
+					"SourceMessageId": {
+						DataType:    aws.String("String"),
+						StringValue: aws.String(message.MessageId),
+					},
+				},
+			})
+			return err
+		}
+	}
+	return h, nil
+}
+
+// Handle processes every message in the batch and returns the ones SQS should redeliver.
+func (h *SQSBatchHandler) Handle(ctx context.Context, sqsEvent events.SQSEvent) events.SQSEventResponse {
+	workers := h.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		failures = []events.SQSBatchItemFailure{}
+		wg       sync.WaitGroup
+	)
+	queue := make(chan events.SQSMessage)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for message := range queue {
+				if h.handleMessage(ctx, message) {
+					continue
+				}
+				mu.Lock()
+				failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, message := range sqsEvent.Records {
+		queue <- message
+	}
+	close(queue)
+	wg.Wait()
+
+	log.Printf("SQS batch: %d messages, %d to retry", len(sqsEvent.Records), len(failures))
+	return events.SQSEventResponse{BatchItemFailures: failures}
+}
+
+// handleMessage returns true when the message is done with, whether processed or dead-lettered.
+func (h *SQSBatchHandler) handleMessage(ctx context.Context, message events.SQSMessage) bool {
+	err := ctx.Err()
+	if err == nil {
+		var emails []*InboundEmail
+		emails, err = inboundFromSQS(message, "")
+		if err != nil {
+			err = &PermanentError{Err: err}
+		} else {
+			err = h.Pipeline.handleInbound(ctx, emails)
+		}
+	}
+	if err == nil {
+		return true
+	}
+
+	log.Printf("SQS message %s failed: %v", message.MessageId, err)
+	if !h.shouldDeadLetter(message, err) {
+		return false
+	}
+
+	if err := h.sendToDeadLetter(ctx, message, err); err != nil {
+		log.Printf("Failed to forward SQS message %s to dead-letter queue: %v", message.MessageId, err)
+		return false
+	}
+	log.Printf("Forwarded SQS message %s to dead-letter queue %s", message.MessageId, h.DeadLetterQueueURL)
+	return true
+}
+
+func (h *SQSBatchHandler) shouldDeadLetter(message events.SQSMessage, err error) bool {
+	if h.DeadLetterQueueURL == "" || h.sendToDeadLetter == nil {
+		return false
+	}
+
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return true
+	}
+
+	if h.MaxReceives <= 0 {
+		return false
+	}
+	receives, _ := strconv.Atoi(message.Attributes["ApproximateReceiveCount"])
+	return receives >= h.MaxReceives
+}
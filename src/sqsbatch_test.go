@@ -0,0 +1,171 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// sqsMessage wraps an SES notification carrying an email with subject in an SQS message.
+func sqsMessage(t *testing.T, id, subject string, receives string) events.SQSMessage {
+	t.Helper()
+	notification, err := json.Marshal(map[string]interface{}{
+		"notificationType": "Received",
+		"mail":             map[string]interface{}{"messageId": "ses-" + id},
+		"receipt":          map[string]interface{}{"action": map[string]string{"type": "SNS", "encoding": "UTF8"}},
+		"content":          "Subject: " + subject + "\r\n\r\nHi",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events.SQSMessage{
+		MessageId:  id,
+		Body:       string(notification),
+		Attributes: map[string]string{"ApproximateReceiveCount": receives},
+	}
+}
+
+func TestSQSBatchHandlerHandle(t *testing.T) {
+	pipeline := testPipeline(t, func(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+		if msg.Subject == "fail" {
+			return nil, errors.New("assistant unavailable")
+		}
+		return &Answer{Text: "ok"}, nil
+	})
+
+	batch := events.SQSEvent{Records: []events.SQSMessage{
+		sqsMessage(t, "ok-1", "order", "1"),
+		sqsMessage(t, "fail-1", "fail", "1"),
+		sqsMessage(t, "ok-2", "order", "1"),
+		sqsMessage(t, "fail-5", "fail", "5"),
+		{MessageId: "junk", Body: "not json", Attributes: map[string]string{"ApproximateReceiveCount": "1"}},
+		sqsMessage(t, "ok-3", "order", "1"),
+	}}
+
+	tests := []struct {
+		name        string
+		dlq         string
+		maxReceives int
+		dlqErr      error
+		retried     []string
+		deadLetters []string
+	}{
+		{
+			name:    "without a dead-letter queue every failure is retried",
+			retried: []string{"fail-1", "fail-5", "junk"},
+		},
+		{
+			name:        "permanent failures are dead-lettered",
+			dlq:         "https://sqs.example/dlq",
+			retried:     []string{"fail-1", "fail-5"},
+			deadLetters: []string{"junk"},
+		},
+		{
+			name:        "messages received MaxReceives times are dead-lettered",
+			dlq:         "https://sqs.example/dlq",
+			maxReceives: 5,
+			retried:     []string{"fail-1"},
+			deadLetters: []string{"fail-5", "junk"},
+		},
+		{
+			name:        "failing to dead-letter leaves the message to be retried",
+			dlq:         "https://sqs.example/dlq",
+			maxReceives: 5,
+			dlqErr:      errors.New("access denied"),
+			retried:     []string{"fail-1", "fail-5", "junk"},
+			deadLetters: []string{"fail-5", "junk"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var deadLetters []string
+			h := &SQSBatchHandler{
+				Pipeline:           pipeline,
+				Workers:            3,
+				DeadLetterQueueURL: tt.dlq,
+				MaxReceives:        tt.maxReceives,
+				sendToDeadLetter: func(ctx context.Context, message events.SQSMessage, cause error) error {
+					mu.Lock()
+					defer mu.Unlock()
+					deadLetters = append(deadLetters, message.MessageId)
+					return tt.dlqErr
+				},
+			}
+
+			response := h.Handle(context.Background(), batch)
+			var retried []string
+			for _, failure := range response.BatchItemFailures {
+				retried = append(retried, failure.ItemIdentifier)
+			}
+			sort.Strings(retried)
+			sort.Strings(deadLetters)
+			if !reflect.DeepEqual(retried, tt.retried) {
+				t.Errorf("BatchItemFailures = %q, want %q", retried, tt.retried)
+			}
+			if !reflect.DeepEqual(deadLetters, tt.deadLetters) {
+				t.Errorf("dead-lettered %q, want %q", deadLetters, tt.deadLetters)
+			}
+		})
+	}
+}
+
+func TestSQSBatchHandlerCancelled(t *testing.T) {
+	pipeline := testPipeline(t, func(ctx context.Context, route *Route, messageID string, msg *EmailContent) (*Answer, error) {
+		t.Error("picker called after the context was cancelled")
+		return nil, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	h := &SQSBatchHandler{Pipeline: pipeline}
+	response := h.Handle(ctx, events.SQSEvent{Records: []events.SQSMessage{sqsMessage(t, "a", "order", "1"), sqsMessage(t, "b", "order", "1")}})
+	if len(response.BatchItemFailures) != 2 {
+		t.Errorf("BatchItemFailures = %+v, want both messages", response.BatchItemFailures)
+	}
+
+	// An empty list, not null, tells Lambda the whole batch succeeded.
+	response = h.Handle(context.Background(), events.SQSEvent{})
+	if response.BatchItemFailures == nil {
+		t.Errorf("BatchItemFailures is nil for an empty batch")
+	}
+}
+
+func TestNewSQSBatchHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		workers     int
+		maxReceives int
+		wantErr     bool
+	}{
+		{name: "defaults", workers: 4},
+		{name: "configured", env: map[string]string{"SQS_WORKERS": "8", "SQS_MAX_RECEIVES": "3", "SQS_DEAD_LETTER_QUEUE_URL": "https://sqs.example/dlq"}, workers: 8, maxReceives: 3},
+		{name: "bad workers", env: map[string]string{"SQS_WORKERS": "many"}, wantErr: true},
+		{name: "bad max receives", env: map[string]string{"SQS_MAX_RECEIVES": "-"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"SQS_WORKERS", "SQS_MAX_RECEIVES", "SQS_DEAD_LETTER_QUEUE_URL"} {
+				t.Setenv(name, tt.env[name])
+			}
+			h, err := NewSQSBatchHandler(&Pipeline{}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSQSBatchHandler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if h.Workers != tt.workers || h.MaxReceives != tt.maxReceives || h.DeadLetterQueueURL != tt.env["SQS_DEAD_LETTER_QUEUE_URL"] {
+				t.Errorf("NewSQSBatchHandler() = %+v", h)
+			}
+		})
+	}
+}
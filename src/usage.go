@@ -0,0 +1,180 @@
+package inbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Usage is the tokens a run or completion used.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *Usage) add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// ModelUsage is token usage broken down by model, since models are priced differently.
+type ModelUsage map[string]Usage
+
+func (m ModelUsage) Add(model string, usage Usage) {
+	if model == "" {
+		model = "unknown"
+	}
+	total := m[model]
+	total.add(usage)
+	m[model] = total
+}
+
+func (m ModelUsage) Merge(other ModelUsage) {
+	for model, usage := range other {
+		m.Add(model, usage)
+	}
+}
+
+// Total adds up the usage of every model.
+func (m ModelUsage) Total() Usage {
+	var total Usage
+	for _, usage := range m {
+		total.add(usage)
+	}
+	return total
+}
+
+// ModelPrice is what a model costs in US dollars per million tokens.
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// PriceTable maps model names, or prefixes of dated snapshots such as "gpt-4o" for
+// "gpt-4o-2024-08-06", to their prices.
+type PriceTable map[string]ModelPrice
+
+// DefaultPriceTable holds OpenAI's list prices for the models the picker is likely to run.
+// Override it with MODEL_PRICES when they change.
+var DefaultPriceTable = PriceTable{
+	"gpt-4o":       {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini":  {Prompt: 0.15, Completion: 0.60},
+	"gpt-4.1":      {Prompt: 2.00, Completion: 8.00},
+	"gpt-4.1-mini": {Prompt: 0.40, Completion: 1.60},
+	"gpt-4.1-nano": {Prompt: 0.10, Completion: 0.40},
+}
+
+// PriceTableFromEnv reads prices from MODEL_PRICES (inline JSON) or MODEL_PRICES_FILE, e.g.
+// {"gpt-4o": {"prompt": 2.5, "completion": 10}}, on top of DefaultPriceTable.
+func PriceTableFromEnv() (PriceTable, error) {
+	prices := PriceTable{}
+	for model, price := range DefaultPriceTable {
+		prices[model] = price
+	}
+
+	raw := []byte(os.Getenv("MODEL_PRICES"))
+	if len(raw) == 0 {
+		if path := os.Getenv("MODEL_PRICES_FILE"); path != "" {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read model prices file %s: %w", path, err)
+			}
+			raw = b
+		}
+	}
+	if len(raw) > 0 {
+		var overrides PriceTable
+		if err := json.Unmarshal(raw, &overrides); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal model prices: %w", err)
+		}
+		for model, price := range overrides {
+			prices[model] = price
+		}
+	}
+	return prices, nil
+}
+
+// Price finds a model's price by exact name or, failing that, the longest matching prefix.
+func (t PriceTable) Price(model string) (ModelPrice, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+	best := ""
+	for name := range t {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return t[best], true
+}
+
+// Cost prices usage in US dollars. Models without a price are costed at nothing and listed in
+// unpriced.
+func (t PriceTable) Cost(usage ModelUsage) (cost float64, unpriced []string) {
+	for model, u := range usage {
+		price, ok := t.Price(model)
+		if !ok {
+			unpriced = append(unpriced, model)
+			continue
+		}
+		cost += (float64(u.PromptTokens)*price.Prompt + float64(u.CompletionTokens)*price.Completion) / 1e6
+	}
+	sort.Strings(unpriced)
+	return cost, unpriced
+}
+
+// usageTally adds up usage across the emails of an invocation, which may be handled concurrently.
+type usageTally struct {
+	mu     sync.Mutex
+	emails int
+	usage  ModelUsage
+}
+
+func (t *usageTally) add(usage ModelUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.usage == nil {
+		t.usage = ModelUsage{}
+	}
+	t.emails++
+	t.usage.Merge(usage)
+}
+
+func (t *usageTally) snapshot() (int, ModelUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usage := ModelUsage{}
+	usage.Merge(t.usage)
+	return t.emails, usage
+}
+
+// logUsage writes one line per model, and the total cost, prefixed with what the usage was for.
+func logUsage(prefix string, usage ModelUsage, prices PriceTable) float64 {
+	models := make([]string, 0, len(usage))
+	for model := range usage {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	for _, model := range models {
+		u := usage[model]
+		log.Printf("%s used %d prompt and %d completion tokens on %s\n", prefix, u.PromptTokens, u.CompletionTokens, model)
+	}
+	cost, unpriced := prices.Cost(usage)
+	if len(unpriced) > 0 {
+		log.Printf("%s: no price for %s, add it to MODEL_PRICES\n", prefix, strings.Join(unpriced, ", "))
+	}
+	log.Printf("%s cost $%.6f\n", prefix, cost)
+	return cost
+}
@@ -0,0 +1,158 @@
+package inbound
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestModelUsage(t *testing.T) {
+	usage := ModelUsage{}
+	usage.Add("gpt-4o", Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	usage.Add("gpt-4o", Usage{PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30})
+	usage.Add("", Usage{PromptTokens: 1, TotalTokens: 1})
+	usage.Merge(ModelUsage{"gpt-4o-mini": {PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150}})
+
+	want := ModelUsage{
+		"gpt-4o":      {PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45},
+		"unknown":     {PromptTokens: 1, TotalTokens: 1},
+		"gpt-4o-mini": {PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150},
+	}
+	if !reflect.DeepEqual(usage, want) {
+		t.Errorf("usage = %+v, want %+v", usage, want)
+	}
+	if total := usage.Total(); total != (Usage{PromptTokens: 131, CompletionTokens: 65, TotalTokens: 196}) {
+		t.Errorf("Total() = %+v", total)
+	}
+}
+
+func TestPriceTablePrice(t *testing.T) {
+	tests := []struct {
+		model string
+		want  ModelPrice
+		ok    bool
+	}{
+		{model: "gpt-4o", want: ModelPrice{Prompt: 2.50, Completion: 10.00}, ok: true},
+		{model: "gpt-4o-mini", want: ModelPrice{Prompt: 0.15, Completion: 0.60}, ok: true},
+		{model: "gpt-4o-2024-08-06", want: ModelPrice{Prompt: 2.50, Completion: 10.00}, ok: true},
+		{model: "gpt-4o-mini-2024-07-18", want: ModelPrice{Prompt: 0.15, Completion: 0.60}, ok: true},
+		{model: "gpt-4.1-nano-2025-04-14", want: ModelPrice{Prompt: 0.10, Completion: 0.40}, ok: true},
+		{model: "gpt-4omni"},
+		{model: "llama3.1"},
+	}
+	for _, tt := range tests {
+		got, ok := DefaultPriceTable.Price(tt.model)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Price(%s) = %+v, %v; want %+v, %v", tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPriceTableCost(t *testing.T) {
+	cost, unpriced := DefaultPriceTable.Cost(ModelUsage{
+		"gpt-4o-2024-08-06": {PromptTokens: 1_000_000, CompletionTokens: 100_000},
+		"gpt-4o-mini":       {PromptTokens: 2_000_000},
+		"llama3.1":          {PromptTokens: 5_000},
+		"unknown":           {PromptTokens: 5},
+	})
+	if want := 2.50 + 1.00 + 0.30; math.Abs(cost-want) > 1e-9 {
+		t.Errorf("Cost() = %v, want %v", cost, want)
+	}
+	if !reflect.DeepEqual(unpriced, []string{"llama3.1", "unknown"}) {
+		t.Errorf("unpriced = %q", unpriced)
+	}
+}
+
+func TestPriceTableFromEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(file, []byte(`{"llama3.1": {"prompt": 0, "completion": 0}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   map[string]ModelPrice
+		wantErr bool
+	}{
+		{name: "defaults", check: map[string]ModelPrice{"gpt-4o": DefaultPriceTable["gpt-4o"]}},
+		{
+			name:  "inline overrides",
+			env:   map[string]string{"MODEL_PRICES": `{"gpt-4o": {"prompt": 2, "completion": 8}, "o3": {"prompt": 10, "completion": 40}}`, "MODEL_PRICES_FILE": file},
+			check: map[string]ModelPrice{"gpt-4o": {Prompt: 2, Completion: 8}, "o3": {Prompt: 10, Completion: 40}, "gpt-4o-mini": DefaultPriceTable["gpt-4o-mini"]},
+		},
+		{name: "file", env: map[string]string{"MODEL_PRICES_FILE": file}, check: map[string]ModelPrice{"llama3.1": {}}},
+		{name: "bad JSON", env: map[string]string{"MODEL_PRICES": `{"gpt-4o": 2}`}, wantErr: true},
+		{name: "missing file", env: map[string]string{"MODEL_PRICES_FILE": file + ".missing"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MODEL_PRICES", tt.env["MODEL_PRICES"])
+			t.Setenv("MODEL_PRICES_FILE", tt.env["MODEL_PRICES_FILE"])
+			prices, err := PriceTableFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PriceTableFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for model, want := range tt.check {
+				if got, ok := prices[model]; !ok || got != want {
+					t.Errorf("price of %s = %+v, %v; want %+v", model, got, ok, want)
+				}
+			}
+		})
+	}
+	if DefaultPriceTable["gpt-4o"].Prompt != 2.50 {
+		t.Error("PriceTableFromEnv() changed DefaultPriceTable")
+	}
+}
+
+func TestUsageTally(t *testing.T) {
+	var tally usageTally
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tally.add(ModelUsage{"gpt-4o": {PromptTokens: 10, CompletionTokens: 1, TotalTokens: 11}})
+		}()
+	}
+	wg.Wait()
+
+	emails, usage := tally.snapshot()
+	if emails != 10 || usage["gpt-4o"].TotalTokens != 110 {
+		t.Errorf("snapshot() = %d emails, %+v", emails, usage)
+	}
+	usage.Add("gpt-4o", Usage{TotalTokens: 1})
+	if _, again := tally.snapshot(); again["gpt-4o"].TotalTokens != 110 {
+		t.Error("changing a snapshot changed the tally")
+	}
+}
+
+func TestUsageMetrics(t *testing.T) {
+	metrics := usageMetrics(ModelUsage{"gpt-4o": {PromptTokens: 10, CompletionTokens: 5}, "gpt-4o-mini": {PromptTokens: 1}}, 0.25)
+	want := []Metric{
+		{Name: "PromptTokens", Value: 11, Unit: "Count"},
+		{Name: "CompletionTokens", Value: 5, Unit: "Count"},
+		{Name: "CostUSD", Value: 0.25, Unit: "None"},
+	}
+	if !reflect.DeepEqual(metrics, want) {
+		t.Errorf("usageMetrics() = %+v, want %+v", metrics, want)
+	}
+}
+
+func TestRunUsageIsRecorded(t *testing.T) {
+	f := newFakeOpenAI(t)
+	f.fakeRun("completed")
+	a := f.assistant(PollRuns)
+	for i := 0; i < 2; i++ {
+		if _, err := a.AddMessageToThreadContext(context.Background(), "hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := a.Usage()["gpt-4o"]; got != (Usage{PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30}) {
+		t.Errorf("usage after two runs = %+v, want both counted once", got)
+	}
+}
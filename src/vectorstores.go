@@ -0,0 +1,248 @@
+package inbound
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Vector store, file and file batch statuses.
+const (
+	VectorStoreStatusInProgress string = "in_progress"
+	VectorStoreStatusCompleted  string = "completed"
+	VectorStoreStatusFailed     string = "failed"
+	VectorStoreStatusCancelled  string = "cancelled"
+)
+
+// maxFileBatch is the most files one file batch can add.
+const maxFileBatch = 500
+
+// IngestionPollOptions waits for file batches, which take far longer than runs to finish.
+var IngestionPollOptions = PollOptions{
+	Timeout:         15 * time.Minute,
+	InitialInterval: time.Second,
+	MaxInterval:     15 * time.Second,
+	Multiplier:      2,
+}
+
+// VectorStore indexes files for the file_search tool.
+type VectorStore struct {
+	ID         string            `json:"id"`
+	Object     string            `json:"object"`
+	CreatedAt  int64             `json:"created_at"`
+	Name       string            `json:"name"`
+	Status     string            `json:"status"`
+	UsageBytes int64             `json:"usage_bytes"`
+	FileCounts FileCounts        `json:"file_counts"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+type FileCounts struct {
+	InProgress int `json:"in_progress"`
+	Completed  int `json:"completed"`
+	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+	Total      int `json:"total"`
+}
+
+// VectorStoreFile is a file's membership of a vector store. Its ID is the file's ID.
+type VectorStoreFile struct {
+	ID            string        `json:"id"`
+	Object        string        `json:"object"`
+	CreatedAt     int64         `json:"created_at"`
+	VectorStoreID string        `json:"vector_store_id"`
+	Status        string        `json:"status"`
+	LastError     *RunLastError `json:"last_error"`
+}
+
+type VectorStoreFileBatch struct {
+	ID            string     `json:"id"`
+	Object        string     `json:"object"`
+	CreatedAt     int64      `json:"created_at"`
+	VectorStoreID string     `json:"vector_store_id"`
+	Status        string     `json:"status"`
+	FileCounts    FileCounts `json:"file_counts"`
+}
+
+type createVectorStorePayload struct {
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type createFileBatchPayload struct {
+	FileIDs []string `json:"file_ids"`
+}
+
+// listPage is one page of any list endpoint.
+type listPage[T any] struct {
+	Data    []T    `json:"data"`
+	LastID  string `json:"last_id"`
+	HasMore bool   `json:"has_more"`
+}
+
+// listAll fetches every page of a list endpoint. id gives an item's ID, for endpoints that don't
+// report last_id.
+func listAll[T any](ctx context.Context, c *openAIClient, requestURL string, query url.Values, action string, id func(T) string) ([]T, error) {
+	var all []T
+	for {
+		var page listPage[T]
+		if err := c.callJSON(ctx, "GET", withQuery(requestURL, query), nil, &page, true, action); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Data...)
+
+		after := page.LastID
+		if after == "" && len(page.Data) > 0 {
+			after = id(page.Data[len(page.Data)-1])
+		}
+		if !page.HasMore || after == "" {
+			return all, nil
+		}
+		query.Set("after", after)
+	}
+}
+
+// ListFiles lists every uploaded file with the given purpose, or all files if purpose is empty.
+func (c *openAIClient) ListFiles(ctx context.Context, purpose string) ([]File, error) {
+	query := url.Values{"limit": {"10000"}}
+	if purpose != "" {
+		query.Set("purpose", purpose)
+	}
+	return listAll(ctx, c, c.endpoint("/files"), query, "list files", func(f File) string { return f.ID })
+}
+
+func (c *AssistantsClient) CreateVectorStore(ctx context.Context, name string, metadata map[string]string) (*VectorStore, error) {
+	var store VectorStore
+	payload := createVectorStorePayload{Name: name, Metadata: metadata}
+	if err := c.callJSON(ctx, "POST", c.endpoint("/vector_stores"), payload, &store, false, "create vector store"); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+func (c *AssistantsClient) GetVectorStore(ctx context.Context, vectorStoreID string) (*VectorStore, error) {
+	var store VectorStore
+	if err := c.callJSON(ctx, "GET", c.endpoint("/vector_stores/%s", vectorStoreID), nil, &store, true, "get vector store"); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// FindVectorStore looks through every vector store for one called name, returning nil if there
+// is none and an error if the name is ambiguous.
+func (c *AssistantsClient) FindVectorStore(ctx context.Context, name string) (*VectorStore, error) {
+	stores, err := listAll(ctx, &c.openAIClient, c.endpoint("/vector_stores"), url.Values{"limit": {"100"}}, "list vector stores", func(s VectorStore) string { return s.ID })
+	if err != nil {
+		return nil, err
+	}
+
+	var found *VectorStore
+	for i := range stores {
+		if stores[i].Name != name {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("vector stores %s and %s are both called %q; pass the ID to use", found.ID, stores[i].ID, name)
+		}
+		found = &stores[i]
+	}
+	return found, nil
+}
+
+// ListVectorStoreFiles lists every file in a vector store, whatever its ingestion status.
+func (c *AssistantsClient) ListVectorStoreFiles(ctx context.Context, vectorStoreID string) ([]VectorStoreFile, error) {
+	return listAll(ctx, &c.openAIClient, c.endpoint("/vector_stores/%s/files", vectorStoreID), url.Values{"limit": {"100"}}, "list vector store files", func(f VectorStoreFile) string { return f.ID })
+}
+
+// RemoveVectorStoreFile takes a file out of a vector store. The file itself is kept; use
+// DeleteFile to delete it.
+func (c *AssistantsClient) RemoveVectorStoreFile(ctx context.Context, vectorStoreID, fileID string) error {
+	var deleted deleteResponse
+	if err := c.callJSON(ctx, "DELETE", c.endpoint("/vector_stores/%s/files/%s", vectorStoreID, fileID), nil, &deleted, true, "remove vector store file"); err != nil {
+		return err
+	}
+	if !deleted.Deleted {
+		return fmt.Errorf("file %s was not removed from vector store %s", fileID, vectorStoreID)
+	}
+	return nil
+}
+
+// CreateFileBatch adds up to 500 uploaded files to a vector store. Ingestion carries on after it
+// returns; use WaitForFileBatch to wait for it.
+func (c *AssistantsClient) CreateFileBatch(ctx context.Context, vectorStoreID string, fileIDs []string) (*VectorStoreFileBatch, error) {
+	if len(fileIDs) > maxFileBatch {
+		return nil, fmt.Errorf("file batch of %d files is over the limit of %d", len(fileIDs), maxFileBatch)
+	}
+
+	var batch VectorStoreFileBatch
+	payload := createFileBatchPayload{FileIDs: fileIDs}
+	if err := c.callJSON(ctx, "POST", c.endpoint("/vector_stores/%s/file_batches", vectorStoreID), payload, &batch, false, "create file batch"); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func (c *AssistantsClient) GetFileBatch(ctx context.Context, vectorStoreID, batchID string) (*VectorStoreFileBatch, error) {
+	var batch VectorStoreFileBatch
+	if err := c.callJSON(ctx, "GET", c.endpoint("/vector_stores/%s/file_batches/%s", vectorStoreID, batchID), nil, &batch, true, "get file batch"); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// WaitForFileBatch polls a file batch until its files are ingested, returning its final state.
+// Files that failed are counted in FileCounts.Failed rather than returned as an error.
+func (c *AssistantsClient) WaitForFileBatch(ctx context.Context, vectorStoreID, batchID string, options PollOptions) (*VectorStoreFileBatch, error) {
+	pollCtx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	interval := options.InitialInterval
+	for {
+		batch, err := c.GetFileBatch(pollCtx, vectorStoreID, batchID)
+		if err == nil && batch.Status != VectorStoreStatusInProgress {
+			return batch, nil
+		}
+		if err != nil && !retryablePollError(err) && pollCtx.Err() == nil {
+			return nil, err
+		}
+
+		select {
+		case <-pollCtx.Done():
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("timed out after %s waiting for file batch %s", options.Timeout, batchID)
+		case <-time.After(interval):
+			interval = options.next(interval)
+		}
+	}
+}
+
+// AttachVectorStore gives an assistant's file_search tool the vector store, adding the tool if
+// the assistant lacks it. An assistant searches one vector store, so this replaces any other.
+// If the assistant is managed with an AssistantDefinition, set vector_store_ids there instead.
+func (c *AssistantsClient) AttachVectorStore(ctx context.Context, assistantID, vectorStoreID string) error {
+	assistant, err := c.GetAssistant(ctx, assistantID)
+	if err != nil {
+		return err
+	}
+
+	tools := assistant.Tools
+	hasFileSearch := false
+	for _, tool := range tools {
+		hasFileSearch = hasFileSearch || tool.Type == "file_search"
+	}
+	if !hasFileSearch {
+		tools = append(tools, Tool{Type: "file_search"})
+	}
+
+	payload := struct {
+		Tools         []Tool        `json:"tools"`
+		ToolResources ToolResources `json:"tool_resources"`
+	}{
+		Tools:         tools,
+		ToolResources: ToolResources{FileSearch: &FileSearchResources{VectorStoreIDs: []string{vectorStoreID}}},
+	}
+	return c.callJSON(ctx, "POST", c.endpoint("/assistants/%s", assistantID), payload, nil, true, "attach vector store")
+}